@@ -18,7 +18,7 @@ cd "$PROJECT_DIR"
 
 # Service definitions
 declare -A SERVICES=(
-    ["whatsapp-bridge"]="cd services/whatsapp-bridge && go run main.go"
+    ["whatsapp-bridge"]="cd services/whatsapp-bridge && go run ."
     ["drop-monitor"]="python3 services/realtime_drop_monitor.py"
     ["qa-feedback"]="python3 services/qa_feedback_communicator.py" 
     ["done-detector"]="python3 services/done_message_detector.py"
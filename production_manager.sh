@@ -264,8 +264,8 @@ health_check() {
     
     local all_healthy=true
     
-    # Check WhatsApp Bridge API
-    if curl -s -f "http://localhost:8080/api/send" -X POST -H "Content-Type: application/json" -d '{"recipient":"test","message":"test"}' | grep -q "success"; then
+    # Check WhatsApp Bridge readiness (503 while a critical component is down; no message is sent)
+    if curl -s -f "http://localhost:8080/ready" > /dev/null; then
         success "WhatsApp Bridge API: HEALTHY"
     else
         error "WhatsApp Bridge API: UNHEALTHY"
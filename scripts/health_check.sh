@@ -243,7 +243,7 @@ check_service "QA Feedback (pgrep)" "pgrep -f qa_feedback_communicator.py" "" ""
 
 check_service "Done Detector (pgrep)" "pgrep -f done_message_detector.py" "" "" "Python done detection process"
 
-check_service "WhatsApp Bridge (pgrep)" "pgrep -f 'go run main.go'" "" "" "Go WhatsApp bridge process"
+check_service "WhatsApp Bridge (pgrep)" "pgrep -f 'go run .'" "" "" "Go WhatsApp bridge process"
 
 echo ""
 echo -e "${YELLOW}🌐 External Service Checks${NC}"
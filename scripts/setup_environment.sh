@@ -206,7 +206,7 @@ if [ -d "services/whatsapp-bridge" ]; then
 
     # Test build
     echo -e "${YELLOW}🔨 Testing Go build...${NC}"
-    go build -o whatsapp-bridge main.go
+    go build -tags sqlite_fts5 -o whatsapp-bridge .
 
     if [ -f "whatsapp-bridge" ]; then
         echo -e "${GREEN}✅ Go build successful${NC}"
@@ -96,7 +96,7 @@ if ! check_port 8080; then
 fi
 
 cd services/whatsapp-bridge
-nohup go run main.go > ../logs/whatsapp_bridge.log 2>&1 &
+nohup go run . > ../logs/whatsapp_bridge.log 2>&1 &
 WHATSAPP_PID=$!
 echo $WHATSAPP_PID > ../logs/whatsapp_bridge.pid
 cd ../..
@@ -98,7 +98,7 @@ fi
 # Fallback: Stop services by process name
 echo -e "${BLUE}🔄 Fallback: Checking for any remaining processes...${NC}"
 
-stop_service_by_name "WhatsApp Bridge" "go run main.go"
+stop_service_by_name "WhatsApp Bridge" "go run ."
 stop_service_by_name "Drop Monitor" "realtime_drop_monitor.py"
 stop_service_by_name "QA Feedback Communicator" "qa_feedback_communicator.py"
 stop_service_by_name "Done Message Detector" "done_message_detector.py"
@@ -151,7 +151,7 @@ echo -e "${BLUE}🔍 Final verification - checking for any remaining processes..
 remaining_processes=""
 
 # Check Go processes
-go_processes=$(pgrep -f "go run main.go" 2>/dev/null || true)
+go_processes=$(pgrep -f "go run ." 2>/dev/null || true)
 if [ -n "$go_processes" ]; then
     remaining_processes="$remaining_processes Go:$go_processes"
 fi
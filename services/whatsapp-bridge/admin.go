@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// Phone numbers or JIDs allowed to run admin commands over direct message
+var ADMIN_JIDS = getEnv("ADMIN_JIDS", "")
+
+var adminJIDs = parseJIDList(ADMIN_JIDS)
+
+// Full JIDs to send admin alerts to: entries written as JIDs (including @lid) are used
+// as they are, bare phone numbers go to their @s.whatsapp.net address
+var adminAlertJIDs = func() []string {
+	var jids []string
+	for _, entry := range strings.Split(ADMIN_JIDS, ",") {
+		entry = strings.TrimPrefix(strings.TrimSpace(entry), "+")
+		switch {
+		case entry == "":
+		case strings.Contains(entry, "@"):
+			jids = append(jids, entry)
+		default:
+			jids = append(jids, entry+"@"+types.DefaultUserServer)
+		}
+	}
+	return jids
+}()
+
+const adminHelp = `Admin commands:
+• approve DR1234567 [DR...]
+• reopen DR1234567 [DR...]
+• resend feedback DR1234567 [DR...]
+• reprocess <message id>
+• pause project <name>
+• resume project <name>`
+
+// Check whether a message is a direct message to the bridge from an admin
+func isAdminDM(info types.MessageInfo) bool {
+	server := info.Chat.Server
+	if server != types.DefaultUserServer && server != types.HiddenUserServer {
+		return false
+	}
+	return !info.IsFromMe && senderAllowed(adminJIDs, info)
+}
+
+// Run an admin command received by direct message, reply with the outcome and
+// record it in the audit trail
+func handleAdminCommand(client *whatsmeow.Client, messageStore *MessageStore, msg *events.Message, logger waLog.Logger) {
+	content := strings.TrimSpace(extractTextContent(msg.Message))
+	if content == "" {
+		return
+	}
+	admin := canonicalSender(client, msg.Info.Sender, msg.Info.SenderAlt)
+	fields := strings.Fields(strings.TrimLeft(content, "!/"))
+	command := ""
+	if len(fields) > 0 {
+		command = strings.ToLower(fields[0])
+	}
+	fmt.Printf("🛠️  Admin command from %s: %q\n", admin, content)
+
+	audit := func(dropNumber, projectName, result string) {
+		if err := messageStore.RecordAudit(AuditEntry{
+			DropNumber:  dropNumber,
+			ProjectName: projectName,
+			Action:      "admin_" + command,
+			Actor:       admin,
+			Source:      "admin_dm",
+			Details:     fmt.Sprintf("%s -> %s", content, result),
+			CreatedAt:   msg.Info.Timestamp,
+		}); err != nil {
+			logger.Warnf("Failed to record admin audit entry: %v", err)
+		}
+	}
+
+	var replies []string
+	switch command {
+	case "approve", "reopen":
+		state := DROP_STATE_APPROVED
+		if command == "reopen" {
+			state = DROP_STATE_REOPENED
+		}
+		dropNumbers := dropNumbersIn(strings.Join(fields[1:], " "))
+		if len(dropNumbers) == 0 {
+			replies = append(replies, fmt.Sprintf("Usage: %s DR1234567", command))
+			audit("", "", "missing drop number")
+			break
+		}
+		for _, dropNumber := range dropNumbers {
+			projectName := messageStore.GetDropProject(dropNumber)
+			if projectName == "" {
+				replies = append(replies, fmt.Sprintf("❓ %s not found", dropNumber))
+				audit(dropNumber, "", "drop not found")
+				continue
+			}
+			err := setDropState(messageStore, dropNumber, projectName, state, admin, "admin_dm", content, msg.Info.Timestamp)
+			if err != nil {
+				replies = append(replies, fmt.Sprintf("❌ %s: %v", dropNumber, err))
+				audit(dropNumber, projectName, err.Error())
+				continue
+			}
+			// setDropState records the state change in the audit trail
+			replies = append(replies, fmt.Sprintf("✅ %s (%s) is now %s", dropNumber, projectName, dropStateSheetStatus[state]))
+		}
+
+	case "resend":
+		dropNumbers := dropNumbersIn(strings.Join(fields[1:], " "))
+		if len(fields) < 2 || strings.ToLower(fields[1]) != "feedback" || len(dropNumbers) == 0 {
+			replies = append(replies, "Usage: resend feedback DR1234567")
+			audit("", "", "invalid arguments")
+			break
+		}
+		for _, dropNumber := range dropNumbers {
+			projectName := messageStore.GetDropProject(dropNumber)
+			incomplete, err := requestQAFeedbackResend(dropNumber)
+			result := ""
+			switch {
+			case err != nil:
+				result = fmt.Sprintf("❌ %s: %v", dropNumber, err)
+			case !incomplete:
+				result = fmt.Sprintf("⚠️ %s queued, but it isn't marked incomplete so no feedback will be sent", dropNumber)
+			default:
+				result = fmt.Sprintf("📤 Feedback for %s queued for resend", dropNumber)
+			}
+			replies = append(replies, result)
+			audit(dropNumber, projectName, result)
+		}
+
+	case "reprocess":
+		if len(fields) < 2 {
+			replies = append(replies, "Usage: reprocess <message id>")
+			audit("", "", "missing message id")
+			break
+		}
+		result := reprocessMessage(client, messageStore, fields[1], logger)
+		replies = append(replies, result)
+		audit("", "", result)
+
+	case "pause", "resume":
+		if len(fields) < 3 || strings.ToLower(fields[1]) != "project" {
+			replies = append(replies, fmt.Sprintf("Usage: %s project <name>", command))
+			audit("", "", "invalid arguments")
+			break
+		}
+		projectName := findProjectName(strings.Join(fields[2:], " "))
+		if projectName == "" {
+			result := fmt.Sprintf("❓ Unknown project %q", strings.Join(fields[2:], " "))
+			replies = append(replies, result)
+			audit("", "", result)
+			break
+		}
+		var err error
+		if command == "pause" {
+			err = messageStore.PauseProject(projectName, admin)
+		} else {
+			err = messageStore.ResumeProject(projectName)
+		}
+		result := fmt.Sprintf("⏸️ %s paused: drops, serials and commands are no longer processed", projectName)
+		if command == "resume" {
+			result = fmt.Sprintf("▶️ %s resumed", projectName)
+		}
+		if err != nil {
+			result = fmt.Sprintf("❌ Failed to %s %s: %v", command, projectName, err)
+		}
+		replies = append(replies, result)
+		audit("", projectName, result)
+
+	default:
+		replies = append(replies, adminHelp)
+		audit("", "", "unknown command")
+	}
+
+	reply := strings.Join(replies, "\n")
+	if success, result := sendWhatsAppMessage(client, msg.Info.Chat.String(), reply, ""); !success {
+		logger.Warnf("Failed to reply to admin %s: %s", admin, result)
+	}
+}
+
+// Re-run drop processing for a stored tracked-group message
+func reprocessMessage(client *whatsmeow.Client, messageStore *MessageStore, messageID string, logger waLog.Logger) string {
+	chatJID, message, err := messageStore.FindMessage(messageID)
+	if err != nil {
+		return fmt.Sprintf("❓ Message %s not found", messageID)
+	}
+	projectName := getProjectNameByJID(chatJID)
+	if projectName == "" {
+		return fmt.Sprintf("⚠️ Message %s is not from a tracked group", messageID)
+	}
+
+	if message.MediaType != "" && mediaArchiver != nil {
+		mediaArchiver.EnqueueMessage(messageID, chatJID)
+	}
+	if message.Content != "" {
+		processMessageContent(client, messageStore, messageID, chatJID, message.Sender, message.Content, message.Time, logger)
+	}
+	return fmt.Sprintf("🔄 Reprocessed message %s (%s)", messageID, projectName)
+}
+
+// Find a configured project by name, ignoring case
+func findProjectName(name string) string {
+	for projectName := range projectGroupJIDs() {
+		if strings.EqualFold(projectName, strings.TrimSpace(name)) {
+			return projectName
+		}
+	}
+	return ""
+}
+
+// Find a stored message by ID in any chat
+func (store *MessageStore) FindMessage(id string) (string, Message, error) {
+	var chatJID string
+	var msg Message
+	err := store.db.QueryRow(`
+		SELECT chat_jid, sender, content, timestamp, is_from_me, media_type, filename
+		FROM messages WHERE id = ? ORDER BY timestamp DESC LIMIT 1
+	`, id).Scan(&chatJID, &msg.Sender, &msg.Content, &msg.Time, &msg.IsFromMe, &msg.MediaType, &msg.Filename)
+	return chatJID, msg, err
+}
+
+// Work out which project a drop belongs to from its QA state or the messages that mention it
+func (store *MessageStore) GetDropProject(dropNumber string) string {
+	var projectName string
+	err := store.db.QueryRow("SELECT project_name FROM drop_states WHERE drop_number = ?", dropNumber).Scan(&projectName)
+	if err == nil && projectName != "" {
+		return projectName
+	}
+
+	rows, err := store.db.Query(`
+		SELECT chat_jid, content FROM messages
+		WHERE UPPER(content) LIKE ? ORDER BY timestamp DESC LIMIT 50
+	`, "%"+dropNumber+"%")
+	if err != nil {
+		return ""
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chatJID, content string
+		if err := rows.Scan(&chatJID, &content); err != nil {
+			continue
+		}
+		if projectName := getProjectNameByJID(chatJID); projectName != "" {
+			for _, mentioned := range dropNumbersIn(content) {
+				if mentioned == dropNumber {
+					return projectName
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Pause automation for a project
+func (store *MessageStore) PauseProject(projectName, pausedBy string) error {
+	_, err := store.db.Exec(`
+		INSERT OR REPLACE INTO paused_projects (project_name, paused_by, paused_at) VALUES (?, ?, ?)
+	`, projectName, pausedBy, time.Now())
+	return err
+}
+
+// Resume automation for a paused project
+func (store *MessageStore) ResumeProject(projectName string) error {
+	_, err := store.db.Exec("DELETE FROM paused_projects WHERE project_name = ?", projectName)
+	return err
+}
+
+// Check whether a project is paused
+func (store *MessageStore) IsProjectPaused(projectName string) bool {
+	var count int
+	err := store.db.QueryRow("SELECT COUNT(*) FROM paused_projects WHERE project_name = ?", projectName).Scan(&count)
+	return err == nil && count > 0
+}
+
+// Get the most recent audit entries, optionally only those from one source
+func (store *MessageStore) GetRecentAudit(source string, limit int) ([]AuditEntry, error) {
+	query := `SELECT drop_number, project_name, action, actor, source, details, created_at FROM audit_log`
+	var args []interface{}
+	if source != "" {
+		query += " WHERE source = ?"
+		args = append(args, source)
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		if err := rows.Scan(&entry.DropNumber, &entry.ProjectName, &entry.Action, &entry.Actor, &entry.Source,
+			&entry.Details, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
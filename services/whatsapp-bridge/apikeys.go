@@ -0,0 +1,372 @@
+package main
+
+import (
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API authentication configuration (overridable through the environment)
+var (
+	API_AUTH_ENABLED         = getEnvBool("API_AUTH_ENABLED", true)
+	API_KEY_RATE_LIMIT       = getEnvInt("API_KEY_RATE_LIMIT", 120) // default requests per key per window
+	API_KEY_RATE_WINDOW_SECS = getEnvInt("API_KEY_RATE_WINDOW_SECS", 60)
+)
+
+// API key scopes. admin grants every scope.
+const (
+	API_SCOPE_SEND  = "send"
+	API_SCOPE_READ  = "read"
+	API_SCOPE_ADMIN = "admin"
+)
+
+// Prefix of generated API keys, so leaked keys are easy to recognise
+const API_KEY_PREFIX = "wab_"
+
+// APIKey is an API key's stored record (the key itself is only kept as a hash)
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	RateLimit  int        `json:"rate_limit"` // requests per window, 0 for API_KEY_RATE_LIMIT
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Check whether the key grants a scope
+func (key APIKey) HasScope(scope string) bool {
+	for _, s := range key.Scopes {
+		if s == scope || s == API_SCOPE_ADMIN {
+			return true
+		}
+	}
+	return false
+}
+
+var apiKeyRequests = &rateLimiter{seen: make(map[string][]time.Time)}
+
+// Hash an API key for storage and lookup
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Random hex string of n bytes from the system CSPRNG
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Parse and validate a comma-separated scope list
+func parseAPIScopes(value string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(value, ",") {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		switch scope {
+		case "":
+		case API_SCOPE_SEND, API_SCOPE_READ, API_SCOPE_ADMIN:
+			scopes = append(scopes, scope)
+		default:
+			return nil, fmt.Errorf("unknown scope %q (use send, read or admin)", scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	return scopes, nil
+}
+
+// Read-only routes that still need the admin scope
+var adminReadPaths = map[string]bool{
+	"/api/access-log": true,
+}
+
+// Scope a request needs: send for /api/send and /api/download, read for other GETs, admin for other changes
+func requiredAPIScope(r *http.Request) string {
+	switch {
+	case r.URL.Path == "/api/send", r.URL.Path == "/api/download":
+		// Downloading media is a POST but only reads, so send-scoped service keys may use it
+		return API_SCOPE_SEND
+	case adminReadPaths[r.URL.Path]:
+		return API_SCOPE_ADMIN
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return API_SCOPE_READ
+	default:
+		return API_SCOPE_ADMIN
+	}
+}
+
+// Get the API key presented as a bearer token or X-API-Key header
+func requestAPIKey(r *http.Request) string {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return strings.TrimSpace(token)
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Require a valid, unrevoked API key with the right scope for /api/ routes, apply the
+// key's rate limit, and record every authenticated call in the access log
+func requireAPIKey(messageStore *MessageStore, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !API_AUTH_ENABLED || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := requestAPIKey(r)
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="whatsapp-bridge"`)
+			writeAPIError(w, "API key required", http.StatusUnauthorized)
+			return
+		}
+		key, err := messageStore.GetAPIKeyByHash(hashAPIKey(token))
+		if err != nil || key.RevokedAt != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="whatsapp-bridge", error="invalid_token"`)
+			writeAPIError(w, "Invalid or revoked API key", http.StatusUnauthorized)
+			return
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		scope := requiredAPIScope(r)
+		limit := key.RateLimit
+		if limit <= 0 {
+			limit = API_KEY_RATE_LIMIT
+		}
+		switch {
+		case !key.HasScope(scope):
+			writeAPIError(rec, fmt.Sprintf("API key lacks the %s scope", scope), http.StatusForbidden)
+		case !apiKeyRequests.allow(key.ID, start, limit, time.Duration(API_KEY_RATE_WINDOW_SECS)*time.Second):
+			rec.Header().Set("Retry-After", strconv.Itoa(API_KEY_RATE_WINDOW_SECS))
+			writeAPIError(rec, "Rate limit exceeded", http.StatusTooManyRequests)
+		default:
+			next.ServeHTTP(rec, r)
+		}
+
+		if err := messageStore.RecordAPIAccess(key.ID, w.Header().Get(REQUEST_ID_HEADER), r.Method, r.URL.RequestURI(), rec.status, r.RemoteAddr, time.Since(start), start); err != nil {
+			fmt.Printf("⚠️  Failed to record API access: %v\n", err)
+		}
+	})
+}
+
+// Handle the "apikey" command line: create, revoke or list API keys
+func runAPIKeyCommand(args []string) error {
+	usage := "usage: whatsapp-bridge apikey create -name NAME -scopes send,read,admin [-rate N] | revoke ID | list"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	messageStore, err := NewMessageStore()
+	if err != nil {
+		return err
+	}
+	defer messageStore.Close()
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		name := flags.String("name", "", "who or what uses the key")
+		scopes := flags.String("scopes", API_SCOPE_READ, "comma-separated scopes: send, read, admin")
+		rate := flags.Int("rate", 0, "requests per window (0 for API_KEY_RATE_LIMIT)")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *name == "" {
+			return fmt.Errorf("-name is required")
+		}
+		scopeList, err := parseAPIScopes(*scopes)
+		if err != nil {
+			return err
+		}
+		key, token, err := messageStore.CreateAPIKey(*name, scopeList, *rate)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created API key %s (%s) with scopes %s\n", key.ID, key.Name, strings.Join(key.Scopes, ","))
+		fmt.Printf("Key (shown once, store it now): %s\n", token)
+
+	case "revoke":
+		if len(args) < 2 {
+			return errors.New(usage)
+		}
+		revoked, err := messageStore.RevokeAPIKey(args[1])
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return fmt.Errorf("no active API key with ID %s", args[1])
+		}
+		fmt.Printf("Revoked API key %s\n", args[1])
+
+	case "list":
+		keys, err := messageStore.ListAPIKeys()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			status := "active"
+			if key.RevokedAt != nil {
+				status = "revoked " + key.RevokedAt.Format("2006-01-02 15:04")
+			}
+			lastUsed := "never"
+			if key.LastUsedAt != nil {
+				lastUsed = key.LastUsedAt.Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%s  %-20s  %-16s  rate=%d  last used %s  %s\n",
+				key.ID, key.Name, strings.Join(key.Scopes, ","), key.RateLimit, lastUsed, status)
+		}
+
+	default:
+		return errors.New(usage)
+	}
+	return nil
+}
+
+// Create an API key, returning its record and the key itself (only the hash is stored)
+func (store *MessageStore) CreateAPIKey(name string, scopes []string, rateLimit int) (APIKey, string, error) {
+	id, err := randomHex(4)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	token := API_KEY_PREFIX + id + "_" + secret
+
+	key := APIKey{ID: id, Name: name, Scopes: scopes, RateLimit: rateLimit, CreatedAt: time.Now()}
+	_, err = store.db.Exec(`
+		INSERT INTO api_keys (id, name, key_hash, scopes, rate_limit, created_at) VALUES (?, ?, ?, ?, ?, ?)
+	`, key.ID, key.Name, hashAPIKey(token), strings.Join(scopes, ","), key.RateLimit, key.CreatedAt)
+	return key, token, err
+}
+
+// Revoke an API key, reporting whether an active key was revoked
+func (store *MessageStore) RevokeAPIKey(id string) (bool, error) {
+	result, err := store.db.Exec("UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+const apiKeyColumns = "id, name, scopes, rate_limit, created_at, revoked_at, last_used_at"
+
+// Scan apiKeyColumns into an APIKey
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	var revokedAt, lastUsedAt sql.NullTime
+	if err := row.Scan(&key.ID, &key.Name, &scopes, &key.RateLimit, &key.CreatedAt, &revokedAt, &lastUsedAt); err != nil {
+		return key, err
+	}
+	key.Scopes = strings.Split(scopes, ",")
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	return key, nil
+}
+
+// Look up an API key by the hash of the presented key
+func (store *MessageStore) GetAPIKeyByHash(keyHash string) (APIKey, error) {
+	return scanAPIKey(store.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", keyHash))
+}
+
+// List all API keys, newest first
+func (store *MessageStore) ListAPIKeys() ([]APIKey, error) {
+	rows, err := store.db.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Record an authenticated API call and mark the key as used
+func (store *MessageStore) RecordAPIAccess(keyID, requestID, method, path string, status int, remoteAddr string, duration time.Duration, at time.Time) error {
+	if _, err := store.db.Exec(`
+		INSERT INTO api_access_log (key_id, request_id, method, path, status, remote_addr, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, keyID, requestID, method, path, status, remoteAddr, duration.Milliseconds(), at); err != nil {
+		return err
+	}
+	_, err := store.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", at, keyID)
+	return err
+}
+
+// APIAccess is one authenticated API call
+type APIAccess struct {
+	KeyID      string    `json:"key_id"`
+	RequestID  string    `json:"request_id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	RemoteAddr string    `json:"remote_addr"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Get the most recent API calls, optionally only one key's
+func (store *MessageStore) GetAPIAccessLog(keyID string, limit int) ([]APIAccess, error) {
+	query := "SELECT key_id, COALESCE(request_id, ''), method, path, status, remote_addr, duration_ms, created_at FROM api_access_log"
+	var args []interface{}
+	if keyID != "" {
+		query += " WHERE key_id = ?"
+		args = append(args, keyID)
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []APIAccess{}
+	for rows.Next() {
+		var entry APIAccess
+		if err := rows.Scan(&entry.KeyID, &entry.RequestID, &entry.Method, &entry.Path, &entry.Status, &entry.RemoteAddr,
+			&entry.DurationMs, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
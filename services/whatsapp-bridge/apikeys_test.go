@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequiredAPIScope(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{http.MethodPost, "/api/send", API_SCOPE_SEND},
+		{http.MethodPost, "/api/download", API_SCOPE_SEND},
+		{http.MethodGet, "/api/chats", API_SCOPE_READ},
+		{http.MethodHead, "/api/files/ab/cd/abcd.jpg", API_SCOPE_READ},
+		{http.MethodGet, "/api/search", API_SCOPE_READ},
+		{http.MethodGet, "/api/access-log", API_SCOPE_ADMIN},
+		{http.MethodPost, "/api/contractors", API_SCOPE_ADMIN},
+		{http.MethodDelete, "/api/contractors", API_SCOPE_ADMIN},
+		{http.MethodPost, "/api/groups/bind", API_SCOPE_ADMIN},
+		{http.MethodPost, "/api/drops/expected-locations", API_SCOPE_ADMIN},
+		{http.MethodPut, "/api/chats", API_SCOPE_ADMIN},
+	}
+	for _, tt := range tests {
+		if got := requiredAPIScope(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.want {
+			t.Errorf("requiredAPIScope(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+// Each key gets its own rate limit; requests refused for scope don't use it up
+func TestRequireAPIKeyRateLimit(t *testing.T) {
+	messageStore := newTestMessageStore(t)
+	authEnabled, window := API_AUTH_ENABLED, API_KEY_RATE_WINDOW_SECS
+	defer func() { API_AUTH_ENABLED, API_KEY_RATE_WINDOW_SECS = authEnabled, window }()
+	API_AUTH_ENABLED, API_KEY_RATE_WINDOW_SECS = true, 60
+
+	limited, limitedToken, err := messageStore.CreateAPIKey("limited", []string{API_SCOPE_READ}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherToken, err := messageStore.CreateAPIKey("other", []string{API_SCOPE_READ}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedToken, err := messageStore.CreateAPIKey("revoked", []string{API_SCOPE_ADMIN}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := messageStore.RevokeAPIKey(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := requireAPIKey(messageStore, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(method, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/chats", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	steps := []struct {
+		name, method, token string
+		want                int
+	}{
+		{"no key", http.MethodGet, "", http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "wab_00000000_nope", http.StatusUnauthorized},
+		{"revoked key", http.MethodGet, revokedToken, http.StatusUnauthorized},
+		{"missing scope", http.MethodPost, limitedToken, http.StatusForbidden},
+		{"first request", http.MethodGet, limitedToken, http.StatusNoContent},
+		{"second request", http.MethodGet, limitedToken, http.StatusNoContent},
+		{"over the limit", http.MethodGet, limitedToken, http.StatusTooManyRequests},
+		{"still over the limit", http.MethodGet, limitedToken, http.StatusTooManyRequests},
+		{"another key", http.MethodGet, otherToken, http.StatusNoContent},
+	}
+	for _, step := range steps {
+		resp := serve(step.method, step.token)
+		if resp.Code != step.want {
+			t.Errorf("%s: status %d, want %d", step.name, resp.Code, step.want)
+		}
+		if step.want == http.StatusTooManyRequests && resp.Header().Get("Retry-After") != "60" {
+			t.Errorf("%s: Retry-After %q, want 60", step.name, resp.Header().Get("Retry-After"))
+		}
+	}
+
+	// Every authenticated call is in the access log, refused ones included
+	access, err := messageStore.GetAPIAccessLog(limited.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(access) != 5 {
+		t.Errorf("access log has %d entries for the limited key, want 5", len(access))
+	}
+
+	// Requests age out of the window
+	now := time.Now()
+	limiter := &rateLimiter{seen: make(map[string][]time.Time)}
+	for i, want := range []bool{true, true, false} {
+		if got := limiter.allow("key", now.Add(time.Duration(i)*time.Second), 2, time.Minute); got != want {
+			t.Errorf("request %d: allow = %v, want %v", i+1, got, want)
+		}
+	}
+	if !limiter.allow("key", now.Add(time.Minute), 2, time.Minute) {
+		t.Errorf("request after the first aged out was refused")
+	}
+	if limiter.allow("key", now.Add(time.Minute+time.Second/2), 2, time.Minute) {
+		t.Errorf("third request within the window was allowed")
+	}
+}
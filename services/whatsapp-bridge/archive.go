@@ -0,0 +1,379 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+)
+
+// Media archive configuration (overridable through the environment)
+var (
+	MEDIA_ARCHIVE_ENABLED        = getEnvBool("MEDIA_ARCHIVE_ENABLED", true)
+	MEDIA_ARCHIVE_WORKERS        = getEnvInt("MEDIA_ARCHIVE_WORKERS", 2)
+	MEDIA_ARCHIVE_QUEUE_SIZE     = getEnvInt("MEDIA_ARCHIVE_QUEUE_SIZE", 200)
+	MEDIA_ARCHIVE_QUOTA_MB       = getEnvInt("MEDIA_ARCHIVE_QUOTA_MB", 5120)
+	MEDIA_ARCHIVE_BACKFILL_HOURS = getEnvInt("MEDIA_ARCHIVE_BACKFILL_HOURS", 48)
+	MEDIA_DROP_LINK_WINDOW_HOURS = getEnvInt("MEDIA_DROP_LINK_WINDOW_HOURS", 12)
+)
+
+// Background media archiver, set up in main when archival is enabled
+var mediaArchiver *MediaArchiver
+
+// MediaArchiveJob describes a media message waiting to be archived
+type MediaArchiveJob struct {
+	MessageID   string
+	ChatJID     string
+	Sender      string
+	ProjectName string
+	DropNumber  string
+	Timestamp   time.Time
+}
+
+// MediaArchiver downloads tracked-group media in the background into the
+// media store, using a content-addressed layout keyed by the file SHA256
+type MediaArchiver struct {
+	client       *whatsmeow.Client
+	messageStore *MessageStore
+	quotaBytes   int64
+	jobs         chan MediaArchiveJob
+	wg           sync.WaitGroup
+
+	mu        sync.Mutex
+	usedBytes int64 // archived bytes plus space reserved by in-flight downloads
+	closed    bool  // set by Close; Enqueue drops jobs after that
+}
+
+// Create a media archiver and start its worker pool
+func NewMediaArchiver(client *whatsmeow.Client, messageStore *MessageStore, workers, queueSize, quotaMB int) (*MediaArchiver, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	usedBytes, err := messageStore.GetArchivedMediaBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read media archive usage: %v", err)
+	}
+
+	archiver := &MediaArchiver{
+		client:       client,
+		messageStore: messageStore,
+		quotaBytes:   int64(quotaMB) * 1024 * 1024,
+		usedBytes:    usedBytes,
+		jobs:         make(chan MediaArchiveJob, queueSize),
+	}
+
+	for i := 0; i < workers; i++ {
+		archiver.wg.Add(1)
+		go archiver.worker()
+	}
+
+	fmt.Printf("🗄️  Media archiver started: workers=%d, quota=%dMB, used=%.1fMB\n",
+		workers, quotaMB, float64(usedBytes)/(1024*1024))
+	return archiver, nil
+}
+
+// Queue a media message for archival without blocking the event handler
+func (a *MediaArchiver) Enqueue(job MediaArchiveJob) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return false
+	}
+	select {
+	case a.jobs <- job:
+		return true
+	default:
+		fmt.Printf("⚠️  Media archive queue full, skipping %s in %s (will be picked up by backfill)\n", job.MessageID, job.ChatJID)
+		return false
+	}
+}
+
+// Queue a stored media message for archival, resolving its drop from the message store
+func (a *MediaArchiver) EnqueueMessage(messageID, chatJID string) bool {
+	var job MediaArchiveJob
+	var content string
+	err := a.messageStore.db.QueryRow(
+		"SELECT id, chat_jid, sender, content, timestamp FROM messages WHERE id = ? AND chat_jid = ?",
+		messageID, chatJID,
+	).Scan(&job.MessageID, &job.ChatJID, &job.Sender, &content, &job.Timestamp)
+	if err != nil {
+		return false
+	}
+	job.ProjectName = getProjectNameByJID(chatJID)
+	job.DropNumber = a.messageStore.ResolveDropForMedia(chatJID, job.Sender, content, job.Timestamp)
+	return a.Enqueue(job)
+}
+
+// Stop accepting jobs and wait for in-flight downloads to finish
+func (a *MediaArchiver) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.jobs)
+	}
+	a.mu.Unlock()
+	a.wg.Wait()
+}
+
+// Reserve quota for a download; false when it would exceed the quota
+func (a *MediaArchiver) reserveQuota(bytes int64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.quotaBytes > 0 && a.usedBytes+bytes > a.quotaBytes {
+		return false
+	}
+	a.usedBytes += bytes
+	return true
+}
+
+// Replace a reservation with the bytes actually stored (0 when nothing was written)
+func (a *MediaArchiver) settleQuota(reserved, stored int64) {
+	a.mu.Lock()
+	a.usedBytes += stored - reserved
+	a.mu.Unlock()
+}
+
+func (a *MediaArchiver) worker() {
+	defer a.wg.Done()
+	for job := range a.jobs {
+		if err := a.archive(job); errors.Is(err, errMediaRetryRequested) {
+			fmt.Printf("🔁 Media %s in %s expired, archiving once the sender's phone re-uploads it\n", job.MessageID, job.ChatJID)
+		} else if err != nil {
+			fmt.Printf("❌ Failed to archive media %s in %s: %v\n", job.MessageID, job.ChatJID, err)
+		}
+	}
+}
+
+// Download a single media message into the archive and index it against its drop
+func (a *MediaArchiver) archive(job MediaArchiveJob) error {
+	_, _, _, _, _, fileSHA256, _, fileLength, err := a.messageStore.GetMediaInfo(job.MessageID, job.ChatJID)
+	if err != nil {
+		return fmt.Errorf("failed to load media info: %v", err)
+	}
+	if len(fileSHA256) == 0 {
+		return fmt.Errorf("message has no file SHA256")
+	}
+	shaHex := hex.EncodeToString(fileSHA256)
+
+	// Files that are already archived don't count against the quota again
+	var reserved int64
+	if _, _, err := a.messageStore.GetArchivedMedia(shaHex); err != nil {
+		reserved = int64(fileLength)
+		if !a.reserveQuota(reserved) {
+			return fmt.Errorf("media archive quota of %dMB reached", a.quotaBytes/(1024*1024))
+		}
+	}
+
+	mediaType, filename, key, size, downloaded, err := storeMediaMessage(a.client, a.messageStore, job.MessageID, job.ChatJID)
+	if !downloaded {
+		size = 0
+	}
+	a.settleQuota(reserved, size)
+	if err != nil {
+		return err
+	}
+	if downloaded {
+		fmt.Printf("🗄️  Archived %s media %s (%d bytes) -> %s\n", mediaType, job.MessageID, size, key)
+	}
+
+	if err := a.indexDrop(job, shaHex); err != nil {
+		return err
+	}
+
+	// Photo checks run per message, even when the same file was archived before
+	if isJPEGMedia(mediaType, filename) {
+		analyzeArchivedPhoto(a.client, a.messageStore, job, mediaType, shaHex, key)
+	}
+	return nil
+}
+
+// Record the archived file in the per-drop index when the message belongs to a drop
+func (a *MediaArchiver) indexDrop(job MediaArchiveJob, shaHex string) error {
+	if job.DropNumber == "" {
+		return nil
+	}
+	return a.messageStore.StoreDropMedia(job.DropNumber, job.MessageID, job.ChatJID, job.ProjectName, job.Sender, shaHex, job.Timestamp)
+}
+
+// Queue recent tracked-group media that never made it into the archive
+// (e.g. the bridge was down or the queue was full)
+func (a *MediaArchiver) Backfill(since time.Time) {
+	rows, err := a.messageStore.db.Query(`
+		SELECT m.id, m.chat_jid, m.sender, m.content, m.timestamp, m.file_sha256
+		FROM messages m
+		JOIN chats c ON c.jid = m.chat_jid
+		WHERE m.media_type != '' AND c.project_name != '' AND m.timestamp > ?
+		ORDER BY m.timestamp ASC
+	`, since)
+	if err != nil {
+		fmt.Printf("⚠️  Media archive backfill query failed: %v\n", err)
+		return
+	}
+
+	var jobs []MediaArchiveJob
+	var hashes [][]byte
+	for rows.Next() {
+		var job MediaArchiveJob
+		var content string
+		var fileSHA256 []byte
+		if err := rows.Scan(&job.MessageID, &job.ChatJID, &job.Sender, &content, &job.Timestamp, &fileSHA256); err != nil {
+			continue
+		}
+		job.ProjectName = getProjectNameByJID(job.ChatJID)
+		job.DropNumber = a.messageStore.ResolveDropForMedia(job.ChatJID, job.Sender, content, job.Timestamp)
+		jobs = append(jobs, job)
+		hashes = append(hashes, fileSHA256)
+	}
+	rows.Close()
+
+	queued := 0
+	for i, job := range jobs {
+		if len(hashes[i]) == 0 {
+			continue
+		}
+		if _, _, err := a.messageStore.GetArchivedMedia(hex.EncodeToString(hashes[i])); err == nil {
+			continue
+		}
+		if a.Enqueue(job) {
+			queued++
+		}
+	}
+	fmt.Printf("🗄️  Media archive backfill queued %d of %d recent media messages\n", queued, len(jobs))
+}
+
+// Extract the caption of a media message (used to link media to a drop)
+func extractMediaCaption(msg *waProto.Message) string {
+	if msg == nil {
+		return ""
+	}
+	if img := msg.GetImageMessage(); img != nil {
+		return img.GetCaption()
+	}
+	if vid := msg.GetVideoMessage(); vid != nil {
+		return vid.GetCaption()
+	}
+	if doc := msg.GetDocumentMessage(); doc != nil {
+		return doc.GetCaption()
+	}
+	return ""
+}
+
+// SQL condition on the messages table that leaves out in-group bot commands (!status DR...),
+// which mention drops without being posts about them
+const notBotCommand = "LTRIM(content) NOT LIKE '!%'"
+
+// Work out which drop a media message belongs to: a drop number in the caption
+// wins, otherwise the sender's most recent drop number in the same chat
+func (store *MessageStore) ResolveDropForMedia(chatJID, sender, caption string, timestamp time.Time) string {
+	if dropNumber := dropPattern.FindString(strings.ToUpper(caption)); dropNumber != "" {
+		return dropNumber
+	}
+
+	since := timestamp.Add(-time.Duration(MEDIA_DROP_LINK_WINDOW_HOURS) * time.Hour)
+	rows, err := store.db.Query(`
+		SELECT content FROM messages
+		WHERE chat_jid = ? AND sender = ? AND timestamp <= ? AND timestamp > ? AND content LIKE '%DR%'
+			AND `+notBotCommand+`
+		ORDER BY timestamp DESC LIMIT 20
+	`, chatJID, sender, timestamp, since)
+	if err != nil {
+		return ""
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			continue
+		}
+		if dropNumber := dropPattern.FindString(strings.ToUpper(content)); dropNumber != "" {
+			return dropNumber
+		}
+	}
+	return ""
+}
+
+// Record a file in the content-addressed media archive
+func (store *MessageStore) StoreArchivedMedia(shaHex, mediaType, storageKey string, size int64) error {
+	_, err := store.db.Exec(
+		"INSERT OR REPLACE INTO media_archive (file_sha256, media_type, storage_key, size, archived_at) VALUES (?, ?, ?, ?, ?)",
+		shaHex, mediaType, storageKey, size, time.Now(),
+	)
+	return err
+}
+
+// Get the media store key and size for a file SHA256 (hex encoded)
+func (store *MessageStore) GetArchivedMedia(shaHex string) (string, int64, error) {
+	var storageKey string
+	var size int64
+	err := store.db.QueryRow("SELECT storage_key, size FROM media_archive WHERE file_sha256 = ?", shaHex).Scan(&storageKey, &size)
+	return storageKey, size, err
+}
+
+// Get the total number of bytes held in the media archive
+func (store *MessageStore) GetArchivedMediaBytes() (int64, error) {
+	var total sql.NullInt64
+	err := store.db.QueryRow("SELECT SUM(size) FROM media_archive").Scan(&total)
+	return total.Int64, err
+}
+
+// Link an archived file to a drop in the per-drop media index
+func (store *MessageStore) StoreDropMedia(dropNumber, messageID, chatJID, projectName, sender, shaHex string, timestamp time.Time) error {
+	_, err := store.db.Exec(
+		`INSERT OR REPLACE INTO drop_media
+		(drop_number, message_id, chat_jid, project_name, sender, file_sha256, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		dropNumber, messageID, chatJID, projectName, sender, shaHex, timestamp,
+	)
+	return err
+}
+
+// DropMediaEntry is one archived file in a drop's media index
+type DropMediaEntry struct {
+	DropNumber  string    `json:"drop_number"`
+	MessageID   string    `json:"message_id"`
+	ChatJID     string    `json:"chat_jid"`
+	ProjectName string    `json:"project_name"`
+	Sender      string    `json:"sender"`
+	FileSHA256  string    `json:"file_sha256"`
+	MediaType   string    `json:"media_type"`
+	Size        int64     `json:"size"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Get the archived media index for a drop
+func (store *MessageStore) GetDropMedia(dropNumber string) ([]DropMediaEntry, error) {
+	rows, err := store.db.Query(`
+		SELECT d.drop_number, d.message_id, d.chat_jid, d.project_name, d.sender, d.file_sha256,
+			COALESCE(a.media_type, ''), COALESCE(a.size, 0), d.timestamp
+		FROM drop_media d
+		LEFT JOIN media_archive a ON a.file_sha256 = d.file_sha256
+		WHERE d.drop_number = ?
+		ORDER BY d.timestamp ASC
+	`, dropNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []DropMediaEntry
+	for rows.Next() {
+		var entry DropMediaEntry
+		if err := rows.Scan(&entry.DropNumber, &entry.MessageID, &entry.ChatJID, &entry.ProjectName, &entry.Sender,
+			&entry.FileSHA256, &entry.MediaType, &entry.Size, &entry.Timestamp); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
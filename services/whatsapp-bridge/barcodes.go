@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/datamatrix"
+	multiqrcode "github.com/makiuchi-d/gozxing/multi/qrcode"
+	"github.com/makiuchi-d/gozxing/oned"
+)
+
+// Label decoding configuration (overridable through the environment). The default
+// serial patterns cover the ONT vendor prefixes and Gizzu UPS serials seen on site.
+var (
+	LABEL_DECODE_ENABLED     = getEnvBool("LABEL_DECODE_ENABLED", true)
+	LABEL_MAX_DIMENSION      = getEnvInt("LABEL_MAX_DIMENSION", 2400) // photos are downscaled to this before decoding
+	LABEL_ONT_SERIAL_PATTERN = getEnv("LABEL_ONT_SERIAL_PATTERN", `^(HWTC|ZTEG|ALCL|FHTT|DSNW|48575443|5A544547)[0-9A-F]{8}$`)
+	LABEL_UPS_SERIAL_PATTERN = getEnv("LABEL_UPS_SERIAL_PATTERN", `^GZ[A-Z0-9]{8,18}$`)
+)
+
+// Kinds of serial number read off label photos
+const (
+	LABEL_KIND_ONT = "ont"
+	LABEL_KIND_UPS = "ups"
+)
+
+// QAStep is one of the 14 installation steps, as tracked in Sheets and Neon
+type QAStep struct {
+	Step       int
+	Name       string
+	NeonColumn string
+}
+
+var labelSteps = map[string]QAStep{
+	LABEL_KIND_ONT: {9, "ONT serial", "step_09_ont_barcode_scan"},
+	LABEL_KIND_UPS: {10, "UPS serial", "step_10_ups_serial_number"},
+}
+
+var (
+	ontSerialPattern   = regexp.MustCompile("(?i)" + LABEL_ONT_SERIAL_PATTERN)
+	upsSerialPattern   = regexp.MustCompile("(?i)" + LABEL_UPS_SERIAL_PATTERN)
+	labelTokenSplitter = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+)
+
+// DecodedBarcode is one barcode or QR code found in a photo
+type DecodedBarcode struct {
+	Format string
+	Text   string
+}
+
+// DropSerial is a serial number decoded from one of a drop's photos
+type DropSerial struct {
+	MessageID     string    `json:"message_id"`
+	ChatJID       string    `json:"chat_jid"`
+	DropNumber    string    `json:"drop_number"`
+	ProjectName   string    `json:"project_name,omitempty"`
+	Kind          string    `json:"kind"`
+	Serial        string    `json:"serial"`
+	BarcodeFormat string    `json:"barcode_format"`
+	DecodedAt     time.Time `json:"decoded_at"`
+}
+
+// Find every barcode and QR code in a photo. 1D readers only return one code per
+// pass, so they are also run over overlapping horizontal bands to pick up labels
+// that carry several barcodes (serial, MAC, part number).
+func decodeBarcodes(img image.Image) []DecodedBarcode {
+	pix, w, h := grayscaleSample(img, LABEL_MAX_DIMENSION)
+	if w == 0 || h == 0 {
+		return nil
+	}
+	gray := image.NewGray(image.Rect(0, 0, w, h))
+	for i, v := range pix {
+		gray.Pix[i] = uint8(v)
+	}
+
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true}
+	found := map[string]bool{}
+	var results []DecodedBarcode
+	add := func(result *gozxing.Result) {
+		text := strings.TrimSpace(result.GetText())
+		if text == "" || found[text] {
+			return
+		}
+		found[text] = true
+		results = append(results, DecodedBarcode{Format: result.GetBarcodeFormat().String(), Text: text})
+	}
+
+	bitmap := func(region image.Image) *gozxing.BinaryBitmap {
+		bmp, err := gozxing.NewBinaryBitmapFromImage(region)
+		if err != nil {
+			return nil
+		}
+		return bmp
+	}
+
+	full := bitmap(gray)
+	if full == nil {
+		return nil
+	}
+	if codes, err := multiqrcode.NewQRCodeMultiReader().DecodeMultiple(full, hints); err == nil {
+		for _, code := range codes {
+			add(code)
+		}
+	}
+	if code, err := datamatrix.NewDataMatrixReader().Decode(full, hints); err == nil {
+		add(code)
+	}
+
+	readers := []gozxing.Reader{
+		oned.NewCode128Reader(),
+		oned.NewCode39Reader(),
+		oned.NewCode93Reader(),
+		oned.NewMultiFormatUPCEANReader(hints),
+	}
+	regions := []*gozxing.BinaryBitmap{full}
+	// Overlapping horizontal bands, half a band apart (at least a pixel, so tiny images terminate)
+	bandHeight := h / 4
+	for top := 0; bandHeight > 0 && top+bandHeight <= h; top += max(1, bandHeight/2) {
+		if band := bitmap(gray.SubImage(image.Rect(0, top, w, top+bandHeight))); band != nil {
+			regions = append(regions, band)
+		}
+	}
+	for _, region := range regions {
+		for _, reader := range readers {
+			if code, err := reader.Decode(region, hints); err == nil {
+				add(code)
+			}
+		}
+	}
+	return results
+}
+
+// Pick the ONT and UPS serial numbers out of decoded barcode or message text.
+// QR codes often carry several fields (e.g. "SN:HWTC1234ABCD;MAC:..."), so each
+// token is checked on its own.
+func classifySerials(text string) map[string]string {
+	serials := map[string]string{}
+	for _, token := range labelTokenSplitter.Split(text, -1) {
+		token = strings.ToUpper(token)
+		switch {
+		case token == "":
+		case ontSerialPattern.MatchString(token):
+			serials[token] = LABEL_KIND_ONT
+		case upsSerialPattern.MatchString(token):
+			serials[token] = LABEL_KIND_UPS
+		}
+	}
+	return serials
+}
+
+// Decode label barcodes on a drop photo, record the serials against the drop and
+// pre-tick the matching QA step in Google Sheets and Neon
+func decodeLabelPhoto(messageStore *MessageStore, job MediaArchiveJob, img image.Image) {
+	if !LABEL_DECODE_ENABLED || job.DropNumber == "" {
+		return
+	}
+
+	for _, code := range decodeBarcodes(img) {
+		for serial, kind := range classifySerials(code.Text) {
+			entry := DropSerial{
+				MessageID:     job.MessageID,
+				ChatJID:       job.ChatJID,
+				DropNumber:    job.DropNumber,
+				ProjectName:   job.ProjectName,
+				Kind:          kind,
+				Serial:        serial,
+				BarcodeFormat: code.Format,
+				DecodedAt:     time.Now(),
+			}
+			isNew, err := messageStore.StoreDropSerial(entry)
+			if err != nil {
+				fmt.Printf("⚠️  Failed to store %s serial for %s: %v\n", kind, job.DropNumber, err)
+				continue
+			}
+			if !isNew {
+				continue
+			}
+
+			step := labelSteps[kind]
+			fmt.Printf("🏷️  Decoded %s %s from photo %s for %s (%s)\n", step.Name, serial, job.MessageID, job.DropNumber, code.Format)
+
+			note := fmt.Sprintf("%s: %s (decoded from photo %s)", step.Name, serial, photoRef(job.MessageID))
+			if err := appendSheetsQANote(job.DropNumber, job.ProjectName, note); err != nil {
+				fmt.Printf("⚠️  Failed to add QA note for %s: %v\n", job.DropNumber, err)
+			}
+			if err := tickSheetsStep(job.DropNumber, job.ProjectName, step.Step); err != nil {
+				fmt.Printf("⚠️  Failed to tick step %d for %s: %v\n", step.Step, job.DropNumber, err)
+			}
+			if err := updateQAReviewStep(job.DropNumber, step, serial+" (decoded from photo)"); err != nil {
+				fmt.Printf("⚠️  Failed to update Neon QA review for %s: %v\n", job.DropNumber, err)
+			}
+
+			registerSerial(messageStore, SerialRegistration{
+				Serial:       serial,
+				Kind:         kind,
+				DropNumber:   job.DropNumber,
+				ProjectName:  job.ProjectName,
+				ChatJID:      job.ChatJID,
+				MessageID:    job.MessageID,
+				Source:       "label",
+				InstalledAt:  job.Timestamp,
+				RegisteredAt: time.Now(),
+			})
+		}
+	}
+}
+
+// Store a decoded serial, reporting whether it was new for this photo
+func (store *MessageStore) StoreDropSerial(s DropSerial) (bool, error) {
+	result, err := store.db.Exec(`
+		INSERT OR IGNORE INTO drop_serials
+		(message_id, chat_jid, drop_number, project_name, kind, serial, barcode_format, decoded_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.MessageID, s.ChatJID, s.DropNumber, s.ProjectName, s.Kind, s.Serial, s.BarcodeFormat, s.DecodedAt)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Get the serial numbers decoded from a drop's photos
+func (store *MessageStore) GetDropSerials(dropNumber string) ([]DropSerial, error) {
+	rows, err := store.db.Query(`
+		SELECT message_id, chat_jid, drop_number, project_name, kind, serial, barcode_format, decoded_at
+		FROM drop_serials WHERE drop_number = ? ORDER BY decoded_at ASC
+	`, dropNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	serials := []DropSerial{}
+	for rows.Next() {
+		var s DropSerial
+		if err := rows.Scan(&s.MessageID, &s.ChatJID, &s.DropNumber, &s.ProjectName, &s.Kind, &s.Serial,
+			&s.BarcodeFormat, &s.DecodedAt); err != nil {
+			return nil, err
+		}
+		serials = append(serials, s)
+	}
+	return serials, nil
+}
+
+// SerialRegistration records a serial number against the drop it was installed on
+type SerialRegistration struct {
+	Serial       string    `json:"serial"`
+	Kind         string    `json:"kind"`
+	DropNumber   string    `json:"drop_number"`
+	ProjectName  string    `json:"project_name,omitempty"`
+	ChatJID      string    `json:"chat_jid"`
+	MessageID    string    `json:"message_id"`
+	Source       string    `json:"source"` // "label" (decoded photo) or "message" (typed)
+	InstalledAt  time.Time `json:"installed_at"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+// Add a serial to the registry and alert QA when it is already registered on another drop
+func registerSerial(messageStore *MessageStore, reg SerialRegistration) {
+	isNew, others, err := messageStore.RegisterSerial(reg)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to register serial %s for %s: %v\n", reg.Serial, reg.DropNumber, err)
+		return
+	}
+	if !isNew || len(others) == 0 {
+		return
+	}
+
+	name := labelSteps[reg.Kind].Name
+	var drops []string
+	for _, other := range others {
+		drops = append(drops, other.DropNumber)
+	}
+	fmt.Printf("🚩 %s %s on %s was already registered on %s\n", name, reg.Serial, reg.DropNumber, strings.Join(drops, ", "))
+
+	for _, other := range others {
+		note := fmt.Sprintf("%s %s reused: also recorded on %s (%s)",
+			name, reg.Serial, other.DropNumber, other.InstalledAt.Format("2006-01-02"))
+		if err := appendSheetsQANote(reg.DropNumber, reg.ProjectName, note); err != nil {
+			fmt.Printf("⚠️  Failed to add QA note for %s: %v\n", reg.DropNumber, err)
+		}
+
+		note = fmt.Sprintf("%s %s reused: also recorded on %s (%s)",
+			name, reg.Serial, reg.DropNumber, reg.InstalledAt.Format("2006-01-02"))
+		if err := appendSheetsQANote(other.DropNumber, other.ProjectName, note); err != nil {
+			fmt.Printf("⚠️  Failed to add QA note for %s: %v\n", other.DropNumber, err)
+		}
+	}
+}
+
+// Register ONT and UPS serials typed into a tracked-group message against the sender's drop
+func registerTypedSerials(messageStore *MessageStore, messageID, chatJID, sender, content string, timestamp time.Time) {
+	projectName := getProjectNameByJID(chatJID)
+	if projectName == "" {
+		return
+	}
+
+	serials := classifySerials(content)
+	if len(serials) == 0 {
+		return
+	}
+	dropNumber := messageStore.ResolveDropForMedia(chatJID, sender, content, timestamp)
+	if dropNumber == "" {
+		fmt.Printf("⚠️  Serial(s) in message %s could not be linked to a drop\n", messageID)
+		return
+	}
+
+	for serial, kind := range serials {
+		registerSerial(messageStore, SerialRegistration{
+			Serial:       serial,
+			Kind:         kind,
+			DropNumber:   dropNumber,
+			ProjectName:  projectName,
+			ChatJID:      chatJID,
+			MessageID:    messageID,
+			Source:       "message",
+			InstalledAt:  timestamp,
+			RegisteredAt: time.Now(),
+		})
+	}
+}
+
+// Add a serial to the registry. Returns whether the serial/drop pair is new and
+// the registrations of the same serial on other drops.
+func (store *MessageStore) RegisterSerial(reg SerialRegistration) (bool, []SerialRegistration, error) {
+	result, err := store.db.Exec(`
+		INSERT OR IGNORE INTO serial_registry
+		(serial, kind, drop_number, project_name, chat_jid, message_id, source, installed_at, registered_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, reg.Serial, reg.Kind, reg.DropNumber, reg.ProjectName, reg.ChatJID, reg.MessageID, reg.Source,
+		reg.InstalledAt, reg.RegisteredAt)
+	if err != nil {
+		return false, nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, nil, err
+	}
+
+	registrations, err := store.LookupSerial(reg.Serial)
+	if err != nil {
+		return true, nil, err
+	}
+	var others []SerialRegistration
+	for _, other := range registrations {
+		if other.DropNumber != reg.DropNumber {
+			others = append(others, other)
+		}
+	}
+	return true, others, nil
+}
+
+// Get every drop a serial number has been registered on, oldest install first
+func (store *MessageStore) LookupSerial(serial string) ([]SerialRegistration, error) {
+	rows, err := store.db.Query(`
+		SELECT serial, kind, drop_number, project_name, chat_jid, message_id, source, installed_at, registered_at
+		FROM serial_registry WHERE serial = ? ORDER BY installed_at ASC
+	`, strings.ToUpper(serial))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	registrations := []SerialRegistration{}
+	for rows.Next() {
+		var reg SerialRegistration
+		if err := rows.Scan(&reg.Serial, &reg.Kind, &reg.DropNumber, &reg.ProjectName, &reg.ChatJID, &reg.MessageID,
+			&reg.Source, &reg.InstalledAt, &reg.RegisteredAt); err != nil {
+			return nil, err
+		}
+		registrations = append(registrations, reg)
+	}
+	return registrations, nil
+}
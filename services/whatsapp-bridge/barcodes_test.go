@@ -0,0 +1,30 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestClassifySerials(t *testing.T) {
+	tests := []struct {
+		text string
+		want map[string]string
+	}{
+		{"HWTC1234ABCD", map[string]string{"HWTC1234ABCD": LABEL_KIND_ONT}},
+		{"sn:hwtc1234abcd;MAC:00-11-22-33-44-55", map[string]string{"HWTC1234ABCD": LABEL_KIND_ONT}},
+		{"ZTEG0A1B2C3D GZ20240517A1", map[string]string{"ZTEG0A1B2C3D": LABEL_KIND_ONT, "GZ20240517A1": LABEL_KIND_UPS}},
+		{"485754430A1B2C3D", map[string]string{"485754430A1B2C3D": LABEL_KIND_ONT}},
+		{"ONT ALCLF00D1234 installed, UPS gz12345678", map[string]string{"ALCLF00D1234": LABEL_KIND_ONT, "GZ12345678": LABEL_KIND_UPS}},
+		{"HWTC1234ABC", map[string]string{}},   // one hex digit short
+		{"HWTC1234ABCDE", map[string]string{}}, // one too many
+		{"HWTC1234ABCG", map[string]string{}},  // not hex
+		{"GZ1234567", map[string]string{}},     // UPS serial too short
+		{"XHWTC1234ABCD", map[string]string{}}, // patterns are anchored to the token
+		{"", map[string]string{}},
+	}
+	for _, tt := range tests {
+		if got := classifySerials(tt.text); !maps.Equal(got, tt.want) {
+			t.Errorf("classifySerials(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// Bot command configuration (overridable through the environment). Projects can
+// set "commands" in PROJECTS to a comma-separated subset, or "off".
+var (
+	BOT_COMMANDS            = getEnv("BOT_COMMANDS", "status,missing,mydrops")
+	BOT_COMMAND_LIMIT       = getEnvInt("BOT_COMMAND_LIMIT", 5)         // commands per sender per window
+	BOT_COMMAND_WINDOW_SECS = getEnvInt("BOT_COMMAND_WINDOW_SECS", 300) // rate limit window
+	BOT_MYDROPS_DAYS        = getEnvInt("BOT_MYDROPS_DAYS", 14)
+)
+
+// Names of the 14 installation steps (Sheets Columns C-P)
+var qaStepNames = []string{
+	"Property frontage",
+	"Location before install",
+	"Outside cable span",
+	"Home entry outside",
+	"Home entry inside",
+	"Fibre entry to ONT",
+	"Patched & labelled drop",
+	"Work area completion",
+	"ONT barcode scan",
+	"UPS serial number",
+	"Power meter reading",
+	"Power meter at ONT",
+	"Active broadband light",
+	"Customer signature",
+}
+
+// rateLimiter allows each key (sender, API key) a fixed number of events per sliding window
+type rateLimiter struct {
+	mu   sync.Mutex
+	seen map[string][]time.Time
+}
+
+var botCommands = &rateLimiter{seen: make(map[string][]time.Time)}
+
+func (l *rateLimiter) allow(key string, now time.Time, limit int, window time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	recent := l.seen[key][:0]
+	for _, t := range l.seen[key] {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= limit {
+		l.seen[key] = recent
+		return false
+	}
+	l.seen[key] = append(recent, now)
+	return true
+}
+
+// Commands enabled for a project
+func projectBotCommands(projectName string) map[string]bool {
+	setting := BOT_COMMANDS
+	if config, ok := getProjectConfig(projectName); ok && config["commands"] != "" {
+		setting = config["commands"]
+	}
+	enabled := map[string]bool{}
+	if setting == "off" {
+		return enabled
+	}
+	for _, command := range strings.Split(setting, ",") {
+		if command = strings.ToLower(strings.TrimSpace(command)); command != "" {
+			enabled[command] = true
+		}
+	}
+	return enabled
+}
+
+// Split a "!command args" message into its command name and arguments
+func parseBotCommand(content string) (string, []string, bool) {
+	fields := strings.Fields(strings.TrimSpace(content))
+	if len(fields) == 0 || len(fields[0]) < 2 || fields[0][0] != '!' {
+		return "", nil, false
+	}
+	return strings.ToLower(fields[0][1:]), fields[1:], true
+}
+
+// Answer an in-group bot command. Returns false when the message isn't a command
+// the project has enabled, so it is processed like any other message.
+func handleBotCommand(client *whatsmeow.Client, messageStore *MessageStore, chatJID, sender, content string, timestamp time.Time) bool {
+	command, args, ok := parseBotCommand(content)
+	if !ok {
+		return false
+	}
+	projectName := getProjectNameByJID(chatJID)
+	if projectName == "" || !projectBotCommands(projectName)[command] {
+		return false
+	}
+
+	if !botCommands.allow(sender, time.Now(), BOT_COMMAND_LIMIT, time.Duration(BOT_COMMAND_WINDOW_SECS)*time.Second) {
+		fmt.Printf("⏳ Rate limited !%s from %s\n", command, sender)
+		return true
+	}
+
+	var reply string
+	switch command {
+	case "status", "missing":
+		dropNumber := ""
+		if len(args) > 0 {
+			dropNumber = dropPattern.FindString(strings.ToUpper(args[0]))
+		}
+		if dropNumber == "" {
+			reply = fmt.Sprintf("Usage: !%s DR1234567", command)
+			break
+		}
+		reply = dropStatusReply(messageStore, chatJID, projectName, dropNumber, command == "missing")
+	case "mydrops":
+		reply = myDropsReply(messageStore, chatJID, projectName, sender, timestamp)
+	default:
+		return false
+	}
+
+	fmt.Printf("🤖 Answering !%s from %s\n", command, sender)
+	if success, result := sendWhatsAppMessage(client, chatJID, reply, ""); !success {
+		fmt.Printf("⚠️  Failed to answer !%s: %s\n", command, result)
+	}
+	return true
+}
+
+// DropStatus is a drop's checklist and review state as shown to the group
+type DropStatus struct {
+	Found          bool
+	Steps          [14]bool
+	Status         string
+	Resubmissions  int
+	PhotosReceived int
+}
+
+// Describe a drop's state for !status, or only its outstanding steps for !missing
+func dropStatusReply(messageStore *MessageStore, chatJID, projectName, dropNumber string, missingOnly bool) string {
+	rows, err := getSheetsDropRows(projectName)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to read sheet for !status: %v\n", err)
+	}
+	status := buildDropStatus(messageStore, chatJID, dropNumber, rows[dropNumber])
+	if !status.Found {
+		return fmt.Sprintf("❓ %s not found for %s", dropNumber, projectName)
+	}
+
+	var missing []string
+	ticked := 0
+	for i, done := range status.Steps {
+		if done {
+			ticked++
+		} else {
+			missing = append(missing, fmt.Sprintf("%d. %s", i+1, qaStepNames[i]))
+		}
+	}
+
+	if missingOnly {
+		if len(missing) == 0 {
+			return fmt.Sprintf("✅ %s: all 14 steps complete", dropNumber)
+		}
+		return fmt.Sprintf("📋 %s outstanding (%d):\n%s", dropNumber, len(missing), strings.Join(missing, "\n"))
+	}
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("📋 %s — %s", dropNumber, status.Status))
+	lines = append(lines, fmt.Sprintf("Steps: %d/14 complete", ticked))
+	for i, done := range status.Steps {
+		mark := "⬜"
+		if done {
+			mark = "✅"
+		}
+		lines = append(lines, fmt.Sprintf("%s %d. %s", mark, i+1, qaStepNames[i]))
+	}
+	lines = append(lines, fmt.Sprintf("Photos received: %d", status.PhotosReceived))
+	lines = append(lines, fmt.Sprintf("Resubmissions: %d", status.Resubmissions))
+	return strings.Join(lines, "\n")
+}
+
+// List the sender's recent drops with their status for !mydrops
+func myDropsReply(messageStore *MessageStore, chatJID, projectName, sender string, now time.Time) string {
+	dropNumbers, err := messageStore.GetSenderDrops(chatJID, sender, now.AddDate(0, 0, -BOT_MYDROPS_DAYS))
+	if err != nil {
+		fmt.Printf("⚠️  Failed to load drops for !mydrops: %v\n", err)
+		return "⚠️ Could not load your drops, please try again later"
+	}
+	if len(dropNumbers) == 0 {
+		return fmt.Sprintf("No drops from you in the last %d days", BOT_MYDROPS_DAYS)
+	}
+
+	rows, err := getSheetsDropRows(projectName)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to read sheet for !mydrops: %v\n", err)
+	}
+	lines := []string{fmt.Sprintf("📋 Your drops (last %d days):", BOT_MYDROPS_DAYS)}
+	for _, dropNumber := range dropNumbers {
+		status := buildDropStatus(messageStore, chatJID, dropNumber, rows[dropNumber])
+		ticked := 0
+		for _, done := range status.Steps {
+			if done {
+				ticked++
+			}
+		}
+		lines = append(lines, fmt.Sprintf("• %s — %s, %d/14 steps", dropNumber, status.Status, ticked))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Combine a drop's sheet row (may be nil) with what the local store knows about it
+func buildDropStatus(messageStore *MessageStore, chatJID, dropNumber string, row []interface{}) DropStatus {
+	status := DropStatus{Status: "Unknown"}
+	cell := func(i int) string {
+		if i < len(row) && row[i] != nil {
+			return strings.TrimSpace(fmt.Sprintf("%v", row[i]))
+		}
+		return ""
+	}
+
+	if row != nil {
+		status.Found = true
+		for i := range status.Steps {
+			status.Steps[i] = strings.EqualFold(cell(2+i), "TRUE") // Columns C-P
+		}
+		if value := cell(19); value != "" { // Column T
+			status.Status = value
+		}
+	}
+
+	if state, _, _, err := messageStore.GetDropState(dropNumber); err == nil && state != "" {
+		status.Found = true
+		status.Status = dropStateSheetStatus[state]
+	}
+
+	if messages, err := messageStore.GetDropMessages(chatJID, dropNumber); err == nil && len(messages) > 0 {
+		status.Found = true
+		for _, message := range messages {
+			if isCompletionMessage(message.Content) {
+				status.Resubmissions++
+			}
+		}
+	}
+
+	if media, err := messageStore.GetDropMedia(dropNumber); err == nil {
+		status.PhotosReceived = len(media)
+	}
+	return status
+}
+
+// Get the live messages in a chat that mention a drop number, oldest first
+func (store *MessageStore) GetDropMessages(chatJID, dropNumber string) ([]Message, error) {
+	rows, err := store.db.Query(`
+		SELECT sender, content, timestamp, is_from_me, media_type, filename
+		FROM messages
+		WHERE chat_jid = ? AND COALESCE(revoked, 0) = 0 AND UPPER(content) LIKE ? AND `+notBotCommand+`
+		ORDER BY timestamp ASC
+	`, chatJID, "%"+dropNumber+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.Sender, &msg.Content, &msg.Time, &msg.IsFromMe, &msg.MediaType, &msg.Filename); err != nil {
+			return nil, err
+		}
+		for _, mentioned := range dropNumbersIn(msg.Content) {
+			if mentioned == dropNumber {
+				messages = append(messages, msg)
+				break
+			}
+		}
+	}
+	return messages, nil
+}
+
+// Get the drop numbers a sender posted in a chat since a time, newest first
+func (store *MessageStore) GetSenderDrops(chatJID, sender string, since time.Time) ([]string, error) {
+	rows, err := store.db.Query(`
+		SELECT content FROM messages
+		WHERE chat_jid = ? AND sender = ? AND timestamp > ? AND COALESCE(revoked, 0) = 0
+			AND content LIKE '%DR%' AND `+notBotCommand+`
+		ORDER BY timestamp DESC
+	`, chatJID, sender, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := map[string]bool{}
+	var dropNumbers []string
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			return nil, err
+		}
+		for _, dropNumber := range dropNumbersIn(content) {
+			if !seen[dropNumber] {
+				seen[dropNumber] = true
+				dropNumbers = append(dropNumbers, dropNumber)
+			}
+		}
+	}
+	return dropNumbers, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Contractor directory configuration (overridable through the environment)
+var CONTRACTORS_CSV = getEnv("CONTRACTORS_CSV", "") // optional directory imported at startup
+
+// Contractor is a directory entry keyed by phone number or LID
+type Contractor struct {
+	ID          string    `json:"id"` // phone number (digits only) or LID user part
+	Name        string    `json:"name"`
+	Company     string    `json:"company,omitempty"`
+	Team        string    `json:"team,omitempty"`
+	ProjectName string    `json:"project_name,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Normalise a phone number, JID or LID to the user part used as a directory key
+func normalizeContractorID(value string) string {
+	value = strings.TrimSpace(value)
+	if user, _, found := strings.Cut(value, "@"); found {
+		value = user
+	}
+	if user, _, found := strings.Cut(value, ":"); found {
+		value = user // strip device suffix
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+}
+
+// Resolve a sender to a contractor name: directory first, then the WhatsApp contact name,
+// then the sender's push name, then the raw sender (truncated to 20 characters).
+// Also returns where the name came from (directory, contact, push_name or sender).
+func resolveContractorName(client *whatsmeow.Client, messageStore *MessageStore, sender string) (string, string) {
+	if messageStore != nil {
+		if contractor, err := messageStore.GetContractor(sender); err == nil && contractor.Name != "" {
+			return contractor.Name, "directory"
+		}
+	}
+
+	if client != nil && client.Store != nil && client.Store.Contacts != nil {
+		user := normalizeContractorID(sender)
+		var pushName string
+		for _, server := range []string{types.DefaultUserServer, types.HiddenUserServer} {
+			contact, err := client.Store.Contacts.GetContact(context.Background(), types.NewJID(user, server))
+			if err != nil || !contact.Found {
+				continue
+			}
+			if contact.FullName != "" {
+				return contact.FullName, "contact"
+			}
+			if pushName == "" {
+				pushName = contact.PushName
+			}
+		}
+		if pushName != "" {
+			return pushName, "push_name"
+		}
+	}
+
+	userName := sender
+	if len(sender) > 20 {
+		userName = sender[:20]
+	}
+	return userName, "sender"
+}
+
+// Import contractors from CSV rows of phone,name[,company,team,project].
+// A header row and rows without a phone number or name are skipped.
+func (store *MessageStore) ImportContractors(r io.Reader) (int, int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read CSV: %v", err)
+	}
+
+	imported, skipped := 0, 0
+	var contractors []Contractor
+	for _, record := range records {
+		if len(record) < 2 {
+			skipped++
+			continue
+		}
+		field := func(i int) string {
+			if i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		contractor := Contractor{
+			ID:          normalizeContractorID(field(0)),
+			Name:        field(1),
+			Company:     field(2),
+			Team:        field(3),
+			ProjectName: field(4),
+		}
+		if contractor.ID == "" || contractor.Name == "" {
+			skipped++
+			continue
+		}
+		contractors = append(contractors, contractor)
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	now := time.Now()
+	for _, contractor := range contractors {
+		if _, err := tx.Exec(`
+			INSERT OR REPLACE INTO contractors (id, name, company, team, project_name, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, contractor.ID, contractor.Name, contractor.Company, contractor.Team, contractor.ProjectName, now); err != nil {
+			tx.Rollback()
+			return 0, 0, err
+		}
+		imported++
+	}
+	return imported, skipped, tx.Commit()
+}
+
+// Add or update a contractor
+func (store *MessageStore) SaveContractor(contractor Contractor) error {
+	_, err := store.db.Exec(`
+		INSERT OR REPLACE INTO contractors (id, name, company, team, project_name, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, contractor.ID, contractor.Name, contractor.Company, contractor.Team, contractor.ProjectName, contractor.UpdatedAt)
+	return err
+}
+
+// Remove a contractor, reporting whether one existed
+func (store *MessageStore) DeleteContractor(id string) (bool, error) {
+	result, err := store.db.Exec("DELETE FROM contractors WHERE id = ?", normalizeContractorID(id))
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// Look up a contractor by phone number, JID or LID (sql.ErrNoRows when not in the directory)
+func (store *MessageStore) GetContractor(id string) (Contractor, error) {
+	var contractor Contractor
+	err := store.db.QueryRow(`
+		SELECT id, name, company, team, project_name, updated_at FROM contractors WHERE id = ?
+	`, normalizeContractorID(id)).Scan(&contractor.ID, &contractor.Name, &contractor.Company,
+		&contractor.Team, &contractor.ProjectName, &contractor.UpdatedAt)
+	return contractor, err
+}
+
+// List the contractor directory, optionally only one project's contractors
+func (store *MessageStore) GetContractors(projectName string) ([]Contractor, error) {
+	query := "SELECT id, name, company, team, project_name, updated_at FROM contractors"
+	var args []interface{}
+	if projectName != "" {
+		query += " WHERE project_name = ?"
+		args = append(args, projectName)
+	}
+	query += " ORDER BY name"
+
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contractors := []Contractor{}
+	for rows.Next() {
+		var contractor Contractor
+		if err := rows.Scan(&contractor.ID, &contractor.Name, &contractor.Company,
+			&contractor.Team, &contractor.ProjectName, &contractor.UpdatedAt); err != nil {
+			return nil, err
+		}
+		contractors = append(contractors, contractor)
+	}
+	return contractors, rows.Err()
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestNormalizeContractorID(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"27821234567", "27821234567"},
+		{"+27 82 123 4567", "27821234567"},
+		{"27821234567@s.whatsapp.net", "27821234567"},
+		{"27821234567:12@s.whatsapp.net", "27821234567"},
+		{"123456789012345@lid", "123456789012345"},
+		{"  (082) 123-4567 ", "0821234567"},
+		{"abc", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeContractorID(tt.value); got != tt.want {
+			t.Errorf("normalizeContractorID(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
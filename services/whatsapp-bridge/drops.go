@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/api/sheets/v4"
+)
+
+// Handle receipt events for message status updates
+func handleReceiptEvent(client *whatsmeow.Client, messageStore *MessageStore, receipt *events.Receipt, logger waLog.Logger) {
+	// Receipt events indicate message delivery/read status changes
+	// We can use these to detect when messages are processed
+	fmt.Printf("📬 Receipt event: Chat=%s, MessageIDs=%v, Timestamp=%v\n", 
+		receipt.Chat.String(), receipt.MessageIDs, receipt.Timestamp)
+	
+	// For resubmissions, we're mainly interested in messages that contain drop numbers
+	// The Receipt event alone doesn't give us message content, but we can cross-reference
+	// with stored messages to check if any recent messages had 'done' keywords
+	
+	// Check recent messages from this chat for completion patterns
+	checkRecentCompletions(client, messageStore, receipt.Chat.String(), receipt.Timestamp, logger)
+}
+
+// Check recent messages for completion patterns and update sheets accordingly
+func checkRecentCompletions(client *whatsmeow.Client, messageStore *MessageStore, chatJID string, timestamp time.Time, logger waLog.Logger) {
+	// Only process Velo Test group
+	veloTestJID := "120363421664266245@g.us"
+	if chatJID != veloTestJID && !isRuntimeBoundGroup(chatJID) {
+		return
+	}
+	
+	// Get recent messages from this chat (last 10 messages in past hour)
+	since := timestamp.Add(-1 * time.Hour)
+	rows, err := messageStore.db.Query(`
+		SELECT content, sender, timestamp FROM messages 
+		WHERE chat_jid = ? AND timestamp > ? 
+		ORDER BY timestamp DESC LIMIT 10
+	`, chatJID, since)
+	
+	if err != nil {
+		logger.Warnf("Failed to query recent messages: %v", err)
+		return
+	}
+	defer rows.Close()
+	
+	// Look for completion patterns in recent messages
+	for rows.Next() {
+		var content, sender string
+		var msgTime time.Time
+		
+		if err := rows.Scan(&content, &sender, &msgTime); err != nil {
+			continue
+		}
+		
+		// Check if this message indicates completion/resubmission
+		if isCompletionMessage(content) {
+			fmt.Printf("🔔 Found completion message: '%s' from %s\n", content, sender)
+			processCompletionMessage(content, chatJID, sender, msgTime, logger)
+		}
+	}
+}
+
+// Check if a message indicates completion or resubmission
+func isCompletionMessage(content string) bool {
+	content = strings.ToLower(strings.TrimSpace(content))
+	
+	// Look for completion indicators combined with drop numbers
+	hasDropNumber := dropPattern.MatchString(strings.ToUpper(content))
+	if !hasDropNumber {
+		return false
+	}
+	
+	// Check for completion keywords
+	completionWords := []string{"done", "complete", "finished", "ready", "submitted", "resubmitted"}
+	for _, word := range completionWords {
+		if strings.Contains(content, word) {
+			return true
+		}
+	}
+	
+	return false
+}
+
+// Process completion message and update Google Sheets
+func processCompletionMessage(content, chatJID, sender string, timestamp time.Time, logger waLog.Logger) {
+	// Extract drop numbers from the completion message
+	dropNumbers := dropPattern.FindAllString(strings.ToUpper(content), -1)
+	if len(dropNumbers) == 0 {
+		return
+	}
+	
+	projectName := getProjectNameByJID(chatJID)
+	if projectName == "" {
+		return
+	}
+	
+	// For each drop number, update Google Sheets to show resubmission
+	for _, dropNumber := range dropNumbers {
+		dropNumber = strings.ToUpper(dropNumber)
+		fmt.Printf("🔄 Processing completion for %s from %s\n", dropNumber, sender)
+		
+		// Update Google Sheets to show resubmission status
+		err := updateSheetsForResubmission(dropNumber, projectName, logger)
+		if err != nil {
+			logger.Errorf("❌ Failed to update sheets for %s resubmission: %v", dropNumber, err)
+		} else {
+			logger.Infof("✅ Updated sheets for %s resubmission", dropNumber)
+		}
+	}
+}
+
+// Update Google Sheets to show resubmission status
+func updateSheetsForResubmission(dropNumber, projectName string, logger waLog.Logger) error {
+	// Check if we have a sheets tab configured for this project
+	tabName, exists := getSheetsTab(projectName)
+	if !exists {
+		return fmt.Errorf("no Google Sheets tab configured for project: %s", projectName)
+	}
+	
+	// Create Google Sheets service with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	
+	srv, err := newSheetsService(ctx)
+	if err != nil {
+		return err
+	}
+	
+	// Find the row with this drop number (Column B)
+	targetRow, err := findDropRow(srv, tabName, dropNumber, ctx)
+	if err != nil {
+		return err
+	}
+	
+	// Update Column W (Resubmitted) to TRUE
+	resubmittedRange := fmt.Sprintf("%s!W%d", tabName, targetRow)
+	vr := &sheets.ValueRange{
+		Values: [][]interface{}{{"TRUE"}},
+	}
+	
+	_, err = srv.Spreadsheets.Values.Update(GOOGLE_SHEETS_ID, resubmittedRange, vr).
+		ValueInputOption("USER_ENTERED").
+		Context(ctx).
+		Do()
+	
+	if err != nil {
+		return fmt.Errorf("failed to update resubmission status: %v", err)
+	}
+	
+	fmt.Printf("📊 ✅ Updated Google Sheets: %s Column W=TRUE (Resubmitted)\n", dropNumber)
+	return nil
+}
+
+// Process drop numbers from message content (enhanced version)
+func processDropNumbers(client *whatsmeow.Client, messageStore *MessageStore, content, chatJID, sender string, timestamp time.Time, logger waLog.Logger) {
+	// Check if message is from a tracked project group
+	projectName := getProjectNameByJID(chatJID)
+	if projectName == "" {
+		return // Not from a tracked project group
+	}
+
+	// Find all drop numbers in the message
+	dropNumbers := dropPattern.FindAllString(content, -1)
+	if len(dropNumbers) == 0 {
+		return // No drop numbers found
+	}
+
+	// Check if this is a completion/resubmission message
+	isCompletion := isCompletionMessage(content)
+	if isCompletion {
+		fmt.Printf("🎯 Completion message detected: '%s' from %s\n", content, sender)
+		// Handle completion directly
+		processCompletionMessage(content, chatJID, sender, timestamp, logger)
+		return
+	}
+
+	// Resolve the contractor name from the directory, contact name or push name
+	userName, nameSource := resolveContractorName(client, messageStore, sender)
+	fmt.Printf("👷 Contractor for %s: %s (%s)\n", sender, userName, nameSource)
+
+	// Process each drop number (regular new drop processing)
+	for _, dropNumber := range dropNumbers {
+		dropNumber = strings.ToUpper(dropNumber)
+
+		// Create QA photo review record in Neon database
+		err := createQAPhotoReview(dropNumber, projectName, userName, timestamp)
+		if err != nil {
+			logger.Errorf("❌ FAILED to create QA review for %s: %v", dropNumber, err)
+			continue // Skip to next drop number if database write fails
+		}
+
+		// For new drops, write to Google Sheets
+		err = writeToGoogleSheets(dropNumber, projectName, userName, timestamp)
+		if err != nil {
+			logger.Errorf("❌ FAILED to write %s to Google Sheets: %v", dropNumber, err)
+			// Continue even if sheets write fails - we still have the database record
+		}
+
+		logger.Infof("✅ Processed drop number: %s from %s (project: %s)", dropNumber, sender, projectName)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBotCommandsDoNotResolveDrops(t *testing.T) {
+	messageStore := newTestMessageStore(t)
+	const chat, sender = "group@g.us", "27820000001"
+	now := time.Now()
+	if err := messageStore.StoreChat(chat, "Velo Test", now); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []struct {
+		id, content string
+		age         time.Duration
+	}{
+		{"post", "DR1111111 installed", 30 * time.Minute},
+		{"status", "!status DR2222222", 10 * time.Minute},
+		{"missing", "  !missing DR3333333", 5 * time.Minute},
+	}
+	for _, m := range messages {
+		if err := messageStore.StoreMessage(m.id, chat, sender, sender+"@s.whatsapp.net", m.content, now.Add(-m.age), false,
+			"", "", "", "", nil, nil, nil, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := messageStore.ResolveDropForMedia(chat, sender, "", now); got != "DR1111111" {
+		t.Errorf("ResolveDropForMedia = %q, want the posted drop DR1111111", got)
+	}
+	if got := messageStore.ResolveDropForMedia(chat, sender, "photo for dr4444444", now); got != "DR4444444" {
+		t.Errorf("ResolveDropForMedia with a caption = %q, want DR4444444", got)
+	}
+	drops, err := messageStore.GetSenderDrops(chat, sender, now.Add(-time.Hour))
+	if err != nil || !slices.Equal(drops, []string{"DR1111111"}) {
+		t.Errorf("GetSenderDrops = %v, %v; want [DR1111111]", drops, err)
+	}
+	if mentioned, err := messageStore.DropMentionedElsewhere(chat, "DR2222222", "post"); err != nil || mentioned {
+		t.Errorf("DropMentionedElsewhere counted a !status command: %v, %v", mentioned, err)
+	}
+}
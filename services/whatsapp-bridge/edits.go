@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// What happens to a drop whose only source message was edited away or deleted:
+// "flag" leaves it in place with a QA note, "reverse" removes the Neon review and
+// clears the sheet row. Projects can override this with "edit_policy" in PROJECTS.
+var DROP_EDIT_POLICY = getEnv("DROP_EDIT_POLICY", "flag")
+
+// MessageEdit is one entry in a message's edit history
+type MessageEdit struct {
+	MessageID       string    `json:"message_id"`
+	ChatJID         string    `json:"chat_jid"`
+	Type            string    `json:"type"` // "edit" or "revoke"
+	PreviousContent string    `json:"previous_content"`
+	NewContent      string    `json:"new_content,omitempty"`
+	Editor          string    `json:"editor"`
+	EditedAt        time.Time `json:"edited_at"`
+}
+
+// Drop edit policy for a project
+func dropEditPolicy(projectName string) string {
+	if config, ok := getProjectConfig(projectName); ok && config["edit_policy"] != "" {
+		return config["edit_policy"]
+	}
+	return DROP_EDIT_POLICY
+}
+
+// Unique, upper-cased drop numbers mentioned in a message
+func dropNumbersIn(content string) []string {
+	seen := map[string]bool{}
+	var drops []string
+	for _, dropNumber := range dropPattern.FindAllString(strings.ToUpper(content), -1) {
+		if !seen[dropNumber] {
+			seen[dropNumber] = true
+			drops = append(drops, dropNumber)
+		}
+	}
+	return drops
+}
+
+// Apply a message edit or revoke to the stored message and reconcile the drops it created
+func handleProtocolMessage(client *whatsmeow.Client, messageStore *MessageStore, msg *events.Message, protocolMsg *waProto.ProtocolMessage, logger waLog.Logger) {
+	var editType, newContent string
+	switch protocolMsg.GetType() {
+	case waProto.ProtocolMessage_REVOKE:
+		editType = "revoke"
+	case waProto.ProtocolMessage_MESSAGE_EDIT:
+		editType = "edit"
+		newContent = extractTextContent(protocolMsg.GetEditedMessage())
+		if newContent == "" {
+			newContent = extractMediaCaption(protocolMsg.GetEditedMessage())
+		}
+	default:
+		return
+	}
+
+	chatJID := msg.Info.Chat.String()
+	targetID := protocolMsg.GetKey().GetID()
+	previous, err := messageStore.GetMessage(targetID, chatJID)
+	if err != nil {
+		logger.Warnf("Received %s for unknown message %s in %s", editType, targetID, chatJID)
+		return
+	}
+
+	edit := MessageEdit{
+		MessageID:       targetID,
+		ChatJID:         chatJID,
+		Type:            editType,
+		PreviousContent: previous.Content,
+		NewContent:      newContent,
+		Editor:          canonicalSender(client, msg.Info.Sender, msg.Info.SenderAlt),
+		EditedAt:        msg.Info.Timestamp,
+	}
+	if err := messageStore.ApplyMessageEdit(edit); err != nil {
+		logger.Warnf("Failed to store %s of message %s: %v", editType, targetID, err)
+		return
+	}
+	fmt.Printf("✏️  Message %s in %s %sed by %s: %q -> %q\n", targetID, chatJID, editType, edit.Editor, previous.Content, newContent)
+
+	projectName := getProjectNameByJID(chatJID)
+	if projectName == "" {
+		return
+	}
+	// The edit history is kept, but a paused project's drops are left alone
+	if messageStore.IsProjectPaused(projectName) {
+		fmt.Printf("⏸️  Project %s is paused, not reconciling %s of message %s\n", projectName, editType, targetID)
+		return
+	}
+
+	// Only the author can take a drop back; a group admin deleting someone else's post is flagged
+	byAuthor := edit.Editor == previous.Sender
+
+	remaining := map[string]bool{}
+	for _, dropNumber := range dropNumbersIn(newContent) {
+		remaining[dropNumber] = true
+	}
+	previousDrops := map[string]bool{}
+	for _, dropNumber := range dropNumbersIn(previous.Content) {
+		previousDrops[dropNumber] = true
+		if !remaining[dropNumber] {
+			reconcileRemovedDrop(messageStore, projectName, dropNumber, edit, previous.Time, byAuthor)
+		}
+	}
+
+	// Drops that only appear after the edit are processed like a new post
+	var added []string
+	for dropNumber := range remaining {
+		if !previousDrops[dropNumber] {
+			added = append(added, dropNumber)
+		}
+	}
+	if len(added) > 0 {
+		processDropNumbers(client, messageStore, strings.Join(added, " "), chatJID, previous.Sender, previous.Time, logger)
+	}
+	// Serials, readings and submission fields added by the edit
+	if editType == "edit" && newContent != "" {
+		processMessageDetails(client, messageStore, targetID, chatJID, previous.Sender, newContent, previous.Time)
+	}
+}
+
+// Flag or reverse a drop that is no longer mentioned by its source message. Changes by
+// anyone other than the author are only ever flagged.
+func reconcileRemovedDrop(messageStore *MessageStore, projectName, dropNumber string, edit MessageEdit, postedAt time.Time, byAuthor bool) {
+	mentioned, err := messageStore.DropMentionedElsewhere(edit.ChatJID, dropNumber, edit.MessageID)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to check other messages for %s: %v\n", dropNumber, err)
+		return
+	}
+	if mentioned {
+		return
+	}
+
+	reason := fmt.Sprintf("source message deleted by %s", edit.Editor)
+	if edit.Type == "edit" {
+		reason = fmt.Sprintf("source message edited by %s to %q", edit.Editor, edit.NewContent)
+	}
+
+	policy := dropEditPolicy(projectName)
+	if policy == "reverse" && !byAuthor {
+		fmt.Printf("⚠️  Not reversing %s: the message was removed by %s, not its author\n", dropNumber, edit.Editor)
+		policy = "flag"
+	}
+	if policy == "reverse" {
+		media, err := messageStore.GetDropMedia(dropNumber)
+		if err == nil && len(media) > 0 {
+			fmt.Printf("⚠️  Not reversing %s: %d photo(s) are linked to it\n", dropNumber, len(media))
+			policy = "flag"
+		}
+	}
+
+	if policy == "reverse" {
+		fmt.Printf("↩️  Reversing %s (%s)\n", dropNumber, reason)
+		if err := deleteQAPhotoReview(dropNumber, postedAt); err != nil {
+			fmt.Printf("⚠️  Failed to remove Neon QA review for %s: %v\n", dropNumber, err)
+		}
+		if err := clearSheetsDropRow(dropNumber, projectName); err != nil {
+			fmt.Printf("⚠️  Failed to clear sheet row for %s: %v\n", dropNumber, err)
+		}
+		return
+	}
+
+	fmt.Printf("🚩 Flagging %s (%s)\n", dropNumber, reason)
+	note := fmt.Sprintf("Drop may be invalid: %s", reason)
+	if err := appendSheetsQANote(dropNumber, projectName, note); err != nil {
+		fmt.Printf("⚠️  Failed to add QA note for %s: %v\n", dropNumber, err)
+	}
+	if err := appendQAReviewComment(dropNumber, note); err != nil {
+		fmt.Printf("⚠️  Failed to flag Neon QA review for %s: %v\n", dropNumber, err)
+	}
+}
+
+// Get a single stored message
+func (store *MessageStore) GetMessage(id, chatJID string) (Message, error) {
+	var msg Message
+	err := store.db.QueryRow(`
+		SELECT sender, content, timestamp, is_from_me, media_type, filename
+		FROM messages WHERE id = ? AND chat_jid = ?
+	`, id, chatJID).Scan(&msg.Sender, &msg.Content, &msg.Time, &msg.IsFromMe, &msg.MediaType, &msg.Filename)
+	return msg, err
+}
+
+// Record an edit or revoke in the message's history and update the stored message
+func (store *MessageStore) ApplyMessageEdit(edit MessageEdit) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO message_edits (message_id, chat_jid, type, previous_content, new_content, editor, edited_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, edit.MessageID, edit.ChatJID, edit.Type, edit.PreviousContent, edit.NewContent, edit.Editor, edit.EditedAt)
+	if err == nil {
+		if edit.Type == "revoke" {
+			_, err = tx.Exec("UPDATE messages SET revoked = 1, edited_at = ? WHERE id = ? AND chat_jid = ?",
+				edit.EditedAt, edit.MessageID, edit.ChatJID)
+		} else {
+			_, err = tx.Exec("UPDATE messages SET content = ?, edited_at = ? WHERE id = ? AND chat_jid = ?",
+				edit.NewContent, edit.EditedAt, edit.MessageID, edit.ChatJID)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Get a message's edit history, oldest first
+func (store *MessageStore) GetMessageEdits(id, chatJID string) ([]MessageEdit, error) {
+	rows, err := store.db.Query(`
+		SELECT message_id, chat_jid, type, previous_content, new_content, editor, edited_at
+		FROM message_edits WHERE message_id = ? AND chat_jid = ? ORDER BY edited_at ASC
+	`, id, chatJID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := []MessageEdit{}
+	for rows.Next() {
+		var edit MessageEdit
+		if err := rows.Scan(&edit.MessageID, &edit.ChatJID, &edit.Type, &edit.PreviousContent, &edit.NewContent,
+			&edit.Editor, &edit.EditedAt); err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit)
+	}
+	return edits, nil
+}
+
+// Check whether any other live message in the chat still mentions a drop number
+func (store *MessageStore) DropMentionedElsewhere(chatJID, dropNumber, excludeID string) (bool, error) {
+	rows, err := store.db.Query(`
+		SELECT content FROM messages
+		WHERE chat_jid = ? AND id != ? AND COALESCE(revoked, 0) = 0 AND UPPER(content) LIKE ? AND `+notBotCommand+`
+	`, chatJID, excludeID, "%"+dropNumber+"%")
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			return false, err
+		}
+		// LIKE also matches longer numbers (DR123 in DR1234), so confirm with the pattern
+		for _, mentioned := range dropNumbersIn(content) {
+			if mentioned == dropNumber {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
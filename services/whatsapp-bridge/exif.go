@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// Photo metadata configuration (overridable through the environment)
+var (
+	PHOTO_STALE_DAYS            = getEnvInt("PHOTO_STALE_DAYS", 2)
+	PHOTO_EXIF_UTC_OFFSET_HOURS = getEnvInt("PHOTO_EXIF_UTC_OFFSET_HOURS", 2) // EXIF times without an offset are SAST
+)
+
+// Photo flags raised by metadata analysis
+const (
+	PHOTO_FLAG_STALE_CAPTURE = "stale_capture" // taken well before it was posted
+	PHOTO_FLAG_NO_METADATA   = "no_metadata"   // document JPEG with no EXIF, likely a screenshot or forwarded image
+)
+
+// PhotoMetadata is what we could read from a photo's EXIF block
+type PhotoMetadata struct {
+	HasEXIF     bool
+	CaptureTime time.Time
+	HasGPS      bool
+	Latitude    float64
+	Longitude   float64
+	CameraMake  string
+	CameraModel string
+}
+
+// exifEntry is one raw TIFF IFD entry
+type exifEntry struct {
+	typ   uint16
+	count uint32
+	value []byte // the 4-byte value/offset field
+}
+
+// exifReader reads values out of a TIFF structure embedded in a JPEG APP1 segment
+type exifReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// Size in bytes of one value of each TIFF field type
+var exifTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+func (r *exifReader) readIFD(offset uint32) map[uint16]exifEntry {
+	entries := make(map[uint16]exifEntry)
+	if uint64(offset)+2 > uint64(len(r.data)) {
+		return entries
+	}
+	count := uint32(r.order.Uint16(r.data[offset:]))
+	for i := uint32(0); i < count; i++ {
+		start := uint64(offset) + 2 + uint64(i)*12
+		if start+12 > uint64(len(r.data)) {
+			break
+		}
+		entry := r.data[start : start+12]
+		entries[r.order.Uint16(entry[0:2])] = exifEntry{
+			typ:   r.order.Uint16(entry[2:4]),
+			count: r.order.Uint32(entry[4:8]),
+			value: entry[8:12],
+		}
+	}
+	return entries
+}
+
+// Raw bytes of an entry's value, following the offset when it doesn't fit inline
+func (r *exifReader) bytes(e exifEntry) []byte {
+	size, ok := exifTypeSizes[e.typ]
+	if !ok || e.count == 0 || e.count > 1<<20 {
+		return nil
+	}
+	total := uint64(size) * uint64(e.count)
+	if total <= 4 {
+		return e.value[:total]
+	}
+	offset := uint64(r.order.Uint32(e.value))
+	if offset+total > uint64(len(r.data)) {
+		return nil
+	}
+	return r.data[offset : offset+total]
+}
+
+func (r *exifReader) ascii(e exifEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(r.bytes(e)), "\x00"))
+}
+
+func (r *exifReader) uint(e exifEntry) (uint32, bool) {
+	raw := r.bytes(e)
+	switch {
+	case e.typ == 3 && len(raw) >= 2:
+		return uint32(r.order.Uint16(raw)), true
+	case e.typ == 4 && len(raw) >= 4:
+		return r.order.Uint32(raw), true
+	}
+	return 0, false
+}
+
+func (r *exifReader) rationals(e exifEntry) []float64 {
+	if e.typ != 5 {
+		return nil
+	}
+	raw := r.bytes(e)
+	values := make([]float64, 0, len(raw)/8)
+	for i := 0; i+8 <= len(raw); i += 8 {
+		num := r.order.Uint32(raw[i:])
+		den := r.order.Uint32(raw[i+4:])
+		if den == 0 {
+			return nil
+		}
+		values = append(values, float64(num)/float64(den))
+	}
+	return values
+}
+
+// Find the TIFF block of the EXIF APP1 segment in a JPEG file
+func findJPEGExif(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		// Start of scan / end of image: no more metadata segments
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return segment[6:]
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
+// Parse capture time, GPS position and camera model from a JPEG's EXIF data
+func parsePhotoMetadata(data []byte) PhotoMetadata {
+	var meta PhotoMetadata
+
+	tiff := findJPEGExif(data)
+	if len(tiff) < 8 {
+		return meta
+	}
+
+	r := &exifReader{data: tiff}
+	switch string(tiff[:2]) {
+	case "II":
+		r.order = binary.LittleEndian
+	case "MM":
+		r.order = binary.BigEndian
+	default:
+		return meta
+	}
+	if r.order.Uint16(tiff[2:4]) != 42 {
+		return meta
+	}
+
+	ifd0 := r.readIFD(r.order.Uint32(tiff[4:8]))
+	if len(ifd0) == 0 {
+		return meta
+	}
+	meta.HasEXIF = true
+	meta.CameraMake = r.ascii(ifd0[0x010F])
+	meta.CameraModel = r.ascii(ifd0[0x0110])
+
+	// Capture time: DateTimeOriginal, then DateTimeDigitized, then the file's DateTime
+	var exifIFD map[uint16]exifEntry
+	if offset, ok := r.uint(ifd0[0x8769]); ok {
+		exifIFD = r.readIFD(offset)
+	}
+	timestamp, offsetTime := "", ""
+	if exifIFD != nil {
+		timestamp = r.ascii(exifIFD[0x9003])
+		offsetTime = r.ascii(exifIFD[0x9011])
+		if timestamp == "" {
+			timestamp = r.ascii(exifIFD[0x9004])
+			offsetTime = r.ascii(exifIFD[0x9012])
+		}
+	}
+	if timestamp == "" {
+		timestamp = r.ascii(ifd0[0x0132])
+		offsetTime = ""
+	}
+	if timestamp != "" {
+		meta.CaptureTime = parseExifTime(timestamp, offsetTime)
+	}
+
+	// GPS position
+	if offset, ok := r.uint(ifd0[0x8825]); ok {
+		gps := r.readIFD(offset)
+		lat := r.rationals(gps[0x0002])
+		lon := r.rationals(gps[0x0004])
+		if len(lat) == 3 && len(lon) == 3 {
+			meta.Latitude = lat[0] + lat[1]/60 + lat[2]/3600
+			meta.Longitude = lon[0] + lon[1]/60 + lon[2]/3600
+			if strings.EqualFold(r.ascii(gps[0x0001]), "S") {
+				meta.Latitude = -meta.Latitude
+			}
+			if strings.EqualFold(r.ascii(gps[0x0003]), "W") {
+				meta.Longitude = -meta.Longitude
+			}
+			// 0,0 is what some phones write when they had no fix
+			meta.HasGPS = meta.Latitude != 0 || meta.Longitude != 0
+		}
+	}
+
+	return meta
+}
+
+// Parse an EXIF "2006:01:02 15:04:05" timestamp with an optional "+02:00" offset
+func parseExifTime(value, offset string) time.Time {
+	location := time.FixedZone("EXIF", PHOTO_EXIF_UTC_OFFSET_HOURS*3600)
+	if offset != "" {
+		if t, err := time.Parse("-07:00", offset); err == nil {
+			location = t.Location()
+		}
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", value, location)
+	if err != nil || t.Year() < 2000 {
+		return time.Time{}
+	}
+	return t
+}
+
+// Whether a photo should still carry EXIF. WhatsApp strips it from photos sent the
+// normal way, so missing metadata only means something for JPEGs sent as documents.
+func exifExpected(mediaType string) bool {
+	return mediaType == "document"
+}
+
+// Work out QA flags for a photo's metadata relative to when it was posted
+func photoMetadataFlags(meta PhotoMetadata, mediaType string, postedAt time.Time) []string {
+	var flags []string
+	if !meta.HasEXIF && exifExpected(mediaType) {
+		flags = append(flags, PHOTO_FLAG_NO_METADATA)
+	}
+	if !meta.CaptureTime.IsZero() && postedAt.Sub(meta.CaptureTime) > time.Duration(PHOTO_STALE_DAYS)*24*time.Hour {
+		flags = append(flags, PHOTO_FLAG_STALE_CAPTURE)
+	}
+	return flags
+}
+
+// Check whether an archived file is a JPEG we can read EXIF from. WhatsApp strips
+// EXIF from photos sent the normal way, so photos sent as documents are the most
+// useful source.
+func isJPEGMedia(mediaType, filename string) bool {
+	if mediaType == "image" {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	return mediaType == "document" && (ext == ".jpg" || ext == ".jpeg")
+}
+
+// Read an archived file back out of the media store
+func readStoredMedia(key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	object, _, err := mediaStore.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return io.ReadAll(object)
+}
+
+// Run the photo checks on an archived image and record the results for QA
+func analyzeArchivedPhoto(client *whatsmeow.Client, messageStore *MessageStore, job MediaArchiveJob, mediaType, shaHex, key string) {
+	data, err := readStoredMedia(key)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to read archived photo %s for analysis: %v\n", job.MessageID, err)
+		return
+	}
+
+	analyzePhotoMetadata(messageStore, job, mediaType, shaHex, data)
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		fmt.Printf("⚠️  Failed to decode archived photo %s: %v\n", job.MessageID, err)
+		return
+	}
+	detectDuplicatePhotos(messageStore, job, shaHex, img)
+	analyzePhotoQuality(client, messageStore, job, shaHex, img)
+	decodeLabelPhoto(messageStore, job, img)
+}
+
+// Short reference to a photo message for QA notes
+func photoRef(messageID string) string {
+	if len(messageID) > 8 {
+		return messageID[:8]
+	}
+	return messageID
+}
+
+// Parse a photo's EXIF metadata, store it and note suspicious photos on the drop
+func analyzePhotoMetadata(messageStore *MessageStore, job MediaArchiveJob, mediaType, shaHex string, data []byte) {
+	meta := parsePhotoMetadata(data)
+	flags := photoMetadataFlags(meta, mediaType, job.Timestamp)
+	if err := messageStore.StorePhotoMetadata(job, shaHex, meta, flags); err != nil {
+		fmt.Printf("⚠️  Failed to store photo metadata for %s: %v\n", job.MessageID, err)
+	}
+
+	if len(flags) == 0 || job.DropNumber == "" {
+		return
+	}
+	fmt.Printf("🚩 Photo %s for %s flagged: %s\n", job.MessageID, job.DropNumber, strings.Join(flags, ", "))
+
+	for _, note := range photoMetadataNotes(job, meta, flags) {
+		if err := appendSheetsQANote(job.DropNumber, job.ProjectName, note); err != nil {
+			fmt.Printf("⚠️  Failed to add QA note for %s: %v\n", job.DropNumber, err)
+		}
+	}
+}
+
+// Human-readable QA notes for flagged photo metadata
+func photoMetadataNotes(job MediaArchiveJob, meta PhotoMetadata, flags []string) []string {
+	var notes []string
+	ref := photoRef(job.MessageID)
+	if slices.Contains(flags, PHOTO_FLAG_NO_METADATA) {
+		notes = append(notes, fmt.Sprintf("Photo %s: no EXIF metadata (possible screenshot/forward)", ref))
+	}
+	if !meta.CaptureTime.IsZero() && job.Timestamp.Sub(meta.CaptureTime) > time.Duration(PHOTO_STALE_DAYS)*24*time.Hour {
+		days := int(job.Timestamp.Sub(meta.CaptureTime).Hours() / 24)
+		notes = append(notes, fmt.Sprintf("Photo %s: taken %s, %d days before it was posted",
+			ref, meta.CaptureTime.Format("2006-01-02"), days))
+	}
+	return notes
+}
+
+// PhotoMetadataRecord is the stored metadata and QA flags of one photo
+type PhotoMetadataRecord struct {
+	MessageID   string     `json:"message_id"`
+	ChatJID     string     `json:"chat_jid"`
+	DropNumber  string     `json:"drop_number,omitempty"`
+	FileSHA256  string     `json:"file_sha256"`
+	HasEXIF     bool       `json:"has_exif"`
+	CaptureTime *time.Time `json:"capture_time,omitempty"`
+	PostedAt    time.Time  `json:"posted_at"`
+	Latitude    *float64   `json:"latitude,omitempty"`
+	Longitude   *float64   `json:"longitude,omitempty"`
+	CameraMake  string     `json:"camera_make,omitempty"`
+	CameraModel string     `json:"camera_model,omitempty"`
+	Flags       []string   `json:"flags"`
+}
+
+// Store the metadata and flags of an analyzed photo
+func (store *MessageStore) StorePhotoMetadata(job MediaArchiveJob, shaHex string, meta PhotoMetadata, flags []string) error {
+	var captureTime interface{}
+	if !meta.CaptureTime.IsZero() {
+		captureTime = meta.CaptureTime
+	}
+	var latitude, longitude interface{}
+	if meta.HasGPS {
+		latitude, longitude = meta.Latitude, meta.Longitude
+	}
+
+	_, err := store.db.Exec(`
+		INSERT OR REPLACE INTO photo_metadata
+		(message_id, chat_jid, drop_number, file_sha256, has_exif, capture_time, posted_at,
+			latitude, longitude, camera_make, camera_model, flags, analyzed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.MessageID, job.ChatJID, job.DropNumber, shaHex, meta.HasEXIF, captureTime, job.Timestamp,
+		latitude, longitude, meta.CameraMake, meta.CameraModel, strings.Join(flags, ","), time.Now())
+	return err
+}
+
+// Get the stored photo metadata for a drop, or for a single message when messageID is set
+func (store *MessageStore) GetPhotoMetadata(dropNumber, chatJID, messageID string) ([]PhotoMetadataRecord, error) {
+	query := `SELECT message_id, chat_jid, drop_number, file_sha256, has_exif, capture_time, posted_at,
+			latitude, longitude, camera_make, camera_model, flags
+		FROM photo_metadata`
+	var args []interface{}
+	if messageID != "" {
+		query += " WHERE message_id = ? AND chat_jid = ?"
+		args = append(args, messageID, chatJID)
+	} else {
+		query += " WHERE drop_number = ?"
+		args = append(args, dropNumber)
+	}
+	query += " ORDER BY posted_at ASC"
+
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []PhotoMetadataRecord{}
+	for rows.Next() {
+		var record PhotoMetadataRecord
+		var dropNumber, flags sql.NullString
+		var captureTime sql.NullTime
+		var latitude, longitude sql.NullFloat64
+		if err := rows.Scan(&record.MessageID, &record.ChatJID, &dropNumber, &record.FileSHA256, &record.HasEXIF,
+			&captureTime, &record.PostedAt, &latitude, &longitude, &record.CameraMake, &record.CameraModel, &flags); err != nil {
+			return nil, err
+		}
+		record.DropNumber = dropNumber.String
+		if captureTime.Valid {
+			record.CaptureTime = &captureTime.Time
+		}
+		if latitude.Valid && longitude.Valid {
+			record.Latitude = &latitude.Float64
+			record.Longitude = &longitude.Float64
+		}
+		record.Flags = []string{}
+		if flags.String != "" {
+			record.Flags = strings.Split(flags.String, ",")
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// tiffTag is one IFD entry of a test EXIF block. An entry with ifd set points at that IFD
+type tiffTag struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+	ifd      int
+}
+
+func asciiTag(tag uint16, value string) tiffTag {
+	return tiffTag{tag: tag, typ: 2, count: uint32(len(value) + 1), data: append([]byte(value), 0)}
+}
+
+func rationalTag(order binary.AppendByteOrder, tag uint16, values ...float64) tiffTag {
+	var data []byte
+	for _, value := range values {
+		data = order.AppendUint32(data, uint32(math.Round(value*1000)))
+		data = order.AppendUint32(data, 1000)
+	}
+	return tiffTag{tag: tag, typ: 5, count: uint32(len(values)), data: data}
+}
+
+// Build a JPEG whose APP1 segment holds a TIFF block with the given IFDs (the first is IFD0)
+func exifJPEG(order binary.AppendByteOrder, ifds ...[]tiffTag) []byte {
+	offsets := make([]uint32, len(ifds))
+	next := uint32(8)
+	for i, tags := range ifds {
+		offsets[i] = next
+		next += 2 + 12*uint32(len(tags)) + 4
+		for _, tag := range tags {
+			if len(tag.data) > 4 {
+				next += uint32(len(tag.data))
+			}
+		}
+	}
+
+	var tiff []byte
+	if order == binary.LittleEndian {
+		tiff = append(tiff, "II"...)
+	} else {
+		tiff = append(tiff, "MM"...)
+	}
+	tiff = order.AppendUint16(tiff, 42)
+	tiff = order.AppendUint32(tiff, offsets[0])
+	for i, tags := range ifds {
+		dataOffset := offsets[i] + 2 + 12*uint32(len(tags)) + 4
+		var overflow []byte
+		tiff = order.AppendUint16(tiff, uint16(len(tags)))
+		for _, tag := range tags {
+			tiff = order.AppendUint16(tiff, tag.tag)
+			if tag.ifd > 0 {
+				tiff = order.AppendUint16(tiff, 4)
+				tiff = order.AppendUint32(tiff, 1)
+				tiff = order.AppendUint32(tiff, offsets[tag.ifd])
+				continue
+			}
+			tiff = order.AppendUint16(tiff, tag.typ)
+			tiff = order.AppendUint32(tiff, tag.count)
+			if len(tag.data) > 4 {
+				tiff = order.AppendUint32(tiff, dataOffset+uint32(len(overflow)))
+				overflow = append(overflow, tag.data...)
+			} else {
+				tiff = append(tiff, tag.data...)
+				tiff = append(tiff, make([]byte, 4-len(tag.data))...)
+			}
+		}
+		tiff = order.AppendUint32(tiff, 0)
+		tiff = append(tiff, overflow...)
+	}
+
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	jpeg = binary.BigEndian.AppendUint16(jpeg, uint16(2+6+len(tiff)))
+	jpeg = append(jpeg, "Exif\x00\x00"...)
+	jpeg = append(jpeg, tiff...)
+	return append(jpeg, 0xFF, 0xD9)
+}
+
+func TestParsePhotoMetadata(t *testing.T) {
+	offset := PHOTO_EXIF_UTC_OFFSET_HOURS
+	defer func() { PHOTO_EXIF_UTC_OFFSET_HOURS = offset }()
+	PHOTO_EXIF_UTC_OFFSET_HOURS = 2
+	be, le := binary.BigEndian, binary.LittleEndian
+	sast := time.FixedZone("SAST", 2*3600)
+
+	tests := []struct {
+		name string
+		data []byte
+		want PhotoMetadata
+	}{
+		{
+			name: "big-endian with capture time, offset and southern GPS",
+			data: exifJPEG(be,
+				[]tiffTag{asciiTag(0x010F, "HUAWEI"), asciiTag(0x0110, "P30 lite"), {tag: 0x8769, ifd: 1}, {tag: 0x8825, ifd: 2}},
+				[]tiffTag{asciiTag(0x9003, "2026:03:14 09:30:00"), asciiTag(0x9011, "+02:00")},
+				[]tiffTag{asciiTag(0x0001, "S"), rationalTag(be, 0x0002, 26, 12, 36), asciiTag(0x0003, "E"), rationalTag(be, 0x0004, 28, 2, 24)},
+			),
+			want: PhotoMetadata{
+				HasEXIF: true, CaptureTime: time.Date(2026, 3, 14, 9, 30, 0, 0, sast),
+				HasGPS: true, Latitude: -26.21, Longitude: 28.04,
+				CameraMake: "HUAWEI", CameraModel: "P30 lite",
+			},
+		},
+		{
+			name: "little-endian falls back to DateTimeDigitized",
+			data: exifJPEG(le,
+				[]tiffTag{asciiTag(0x0110, "SM-A145F"), {tag: 0x8769, ifd: 1}},
+				[]tiffTag{asciiTag(0x9004, "2026:05:01 16:45:10"), asciiTag(0x9012, "+00:00")},
+			),
+			want: PhotoMetadata{
+				HasEXIF: true, CaptureTime: time.Date(2026, 5, 1, 16, 45, 10, 0, time.UTC), CameraModel: "SM-A145F",
+			},
+		},
+		{
+			name: "file DateTime in the default offset, western GPS",
+			data: exifJPEG(le,
+				[]tiffTag{asciiTag(0x0132, "2026:01:02 07:00:00"), {tag: 0x8825, ifd: 1}},
+				[]tiffTag{asciiTag(0x0001, "N"), rationalTag(le, 0x0002, 51, 30, 0), asciiTag(0x0003, "W"), rationalTag(le, 0x0004, 0, 7, 30)},
+			),
+			want: PhotoMetadata{
+				HasEXIF: true, CaptureTime: time.Date(2026, 1, 2, 7, 0, 0, 0, sast),
+				HasGPS: true, Latitude: 51.5, Longitude: -0.125,
+			},
+		},
+		{
+			name: "0,0 GPS is no fix",
+			data: exifJPEG(be,
+				[]tiffTag{asciiTag(0x010F, "Apple"), {tag: 0x8825, ifd: 1}},
+				[]tiffTag{rationalTag(be, 0x0002, 0, 0, 0), rationalTag(be, 0x0004, 0, 0, 0)},
+			),
+			want: PhotoMetadata{HasEXIF: true, CameraMake: "Apple"},
+		},
+		{
+			name: "offsets pointing past the block are ignored",
+			data: exifJPEG(be, []tiffTag{
+				asciiTag(0x010F, "Nokia"),
+				{tag: 0x0110, typ: 2, count: 64, data: be.AppendUint32(nil, 0xFFFFFF00)},
+				{tag: 0x8769, typ: 4, count: 1, data: be.AppendUint32(nil, 0xFFFFFFF0)},
+			}),
+			want: PhotoMetadata{HasEXIF: true, CameraMake: "Nokia"},
+		},
+		{name: "not a JPEG", data: []byte("\x89PNG\r\n\x1a\n"), want: PhotoMetadata{}},
+		{name: "JPEG without EXIF", data: []byte{0xFF, 0xD8, 0xFF, 0xDB, 0x00, 0x04, 0x00, 0x00, 0xFF, 0xD9}, want: PhotoMetadata{}},
+		{name: "truncated segment", data: exifJPEG(be, []tiffTag{asciiTag(0x010F, "HUAWEI")})[:12], want: PhotoMetadata{}},
+		{name: "empty", data: nil, want: PhotoMetadata{}},
+	}
+	for _, tt := range tests {
+		got := parsePhotoMetadata(tt.data)
+		if got.HasEXIF != tt.want.HasEXIF || !got.CaptureTime.Equal(tt.want.CaptureTime) || got.HasGPS != tt.want.HasGPS ||
+			math.Abs(got.Latitude-tt.want.Latitude) > 1e-6 || math.Abs(got.Longitude-tt.want.Longitude) > 1e-6 ||
+			got.CameraMake != tt.want.CameraMake || got.CameraModel != tt.want.CameraModel {
+			t.Errorf("%s: parsePhotoMetadata = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// The first APP1 segment that is EXIF wins, after skipping other segments
+	withJFIF := append([]byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x07, 'J', 'F', 'I', 'F', 0}, exifJPEG(be, []tiffTag{asciiTag(0x010F, "HUAWEI")})[2:]...)
+	if got := parsePhotoMetadata(withJFIF); got.CameraMake != "HUAWEI" {
+		t.Errorf("EXIF after a JFIF segment: parsePhotoMetadata = %+v", got)
+	}
+	if !bytes.Equal(findJPEGExif(withJFIF)[:2], []byte("MM")) {
+		t.Errorf("findJPEGExif did not return the TIFF block")
+	}
+}
+
+func TestParseExifTime(t *testing.T) {
+	offset := PHOTO_EXIF_UTC_OFFSET_HOURS
+	defer func() { PHOTO_EXIF_UTC_OFFSET_HOURS = offset }()
+	PHOTO_EXIF_UTC_OFFSET_HOURS = 2
+
+	tests := []struct {
+		value, offset string
+		want          time.Time
+	}{
+		{"2026:03:14 09:30:00", "+02:00", time.Date(2026, 3, 14, 7, 30, 0, 0, time.UTC)},
+		{"2026:03:14 09:30:00", "-05:00", time.Date(2026, 3, 14, 14, 30, 0, 0, time.UTC)},
+		{"2026:03:14 09:30:00", "", time.Date(2026, 3, 14, 7, 30, 0, 0, time.UTC)},
+		{"2026:03:14 09:30:00", "bogus", time.Date(2026, 3, 14, 7, 30, 0, 0, time.UTC)},
+		{"2026-03-14 09:30:00", "", time.Time{}},
+		{"0000:00:00 00:00:00", "", time.Time{}},
+		{"1980:01:01 00:00:00", "", time.Time{}},
+		{"", "", time.Time{}},
+	}
+	for _, tt := range tests {
+		got := parseExifTime(tt.value, tt.offset)
+		if !got.Equal(tt.want) || got.IsZero() != tt.want.IsZero() {
+			t.Errorf("parseExifTime(%q, %q) = %v, want %v", tt.value, tt.offset, got, tt.want)
+		}
+	}
+}
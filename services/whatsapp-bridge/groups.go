@@ -0,0 +1,305 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// GroupParticipant is a member (current or former) of a tracked group
+type GroupParticipant struct {
+	ChatJID        string      `json:"chat_jid"`
+	Participant    string      `json:"participant"` // canonical sender ID
+	ParticipantJID string      `json:"participant_jid"`
+	IsAdmin        bool        `json:"is_admin"`
+	IsSuperAdmin   bool        `json:"is_super_admin"`
+	JoinedAt       time.Time   `json:"joined_at"` // first time the bridge saw them in the group
+	LeftAt         *time.Time  `json:"left_at,omitempty"`
+	Contractor     *Contractor `json:"contractor,omitempty"`
+}
+
+// Send an alert to every admin by direct message
+func alertAdmins(client *whatsmeow.Client, message string) {
+	if len(adminAlertJIDs) == 0 {
+		fmt.Printf("⚠️  No ADMIN_JIDS configured for alert: %s\n", message)
+		return
+	}
+	for _, admin := range adminAlertJIDs {
+		if success, result := sendWhatsAppMessage(client, admin, message, ""); !success {
+			fmt.Printf("⚠️  Failed to alert admin %s: %s\n", admin, result)
+		}
+	}
+}
+
+// Store membership and subject changes for a tracked group and alert admins about
+// unknown numbers joining
+func handleGroupInfo(client *whatsmeow.Client, messageStore *MessageStore, evt *events.GroupInfo, logger waLog.Logger) {
+	chatJID := evt.JID.String()
+
+	// A "project: Name" line an admin adds to the description binds the group to that project
+	if evt.Topic != nil {
+		var setBy []types.JID
+		for _, jid := range []*types.JID{evt.Sender, evt.SenderPN} {
+			if jid != nil {
+				setBy = append(setBy, *jid)
+			}
+		}
+		bindMarkedGroup(messageStore, chatJID, evt.Topic.Topic, setBy...)
+	}
+
+	projectName := getProjectNameByJID(chatJID)
+	if projectName == "" {
+		return
+	}
+
+	actor := ""
+	if evt.Sender != nil {
+		alt := types.EmptyJID
+		if evt.SenderPN != nil {
+			alt = *evt.SenderPN
+		}
+		actor = canonicalSender(client, *evt.Sender, alt)
+	}
+	timestamp := evt.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	record := func(action, participant, details string) {
+		if err := messageStore.RecordAudit(AuditEntry{
+			ProjectName: projectName,
+			Action:      action,
+			Actor:       actor,
+			Source:      "group",
+			Details:     strings.TrimSpace(participant + " " + details),
+			CreatedAt:   timestamp,
+		}); err != nil {
+			logger.Warnf("Failed to record group change in %s: %v", chatJID, err)
+		}
+	}
+
+	for _, jid := range evt.Join {
+		participant := canonicalSender(client, jid, types.EmptyJID)
+		if err := messageStore.JoinGroupParticipant(chatJID, participant, jid.String(), timestamp); err != nil {
+			logger.Warnf("Failed to store join of %s in %s: %v", participant, chatJID, err)
+		}
+		record("group_join", participant, evt.JoinReason)
+		fmt.Printf("👋 %s joined %s\n", participant, projectName)
+
+		if client.Store.ID != nil && participant == client.Store.ID.User {
+			continue
+		}
+		if _, err := messageStore.GetContractor(participant); err == sql.ErrNoRows {
+			// A LID that could not be mapped to a phone number is not a phone number
+			who := "number +" + participant
+			if jid.Server == types.HiddenUserServer && participant == jid.User {
+				who = fmt.Sprintf("member (LID %s, phone number not known yet)", participant)
+			}
+			alertAdmins(client, fmt.Sprintf("🚨 Unknown %s joined the %s group (%s). Add them to the contractor directory or remove them from the group.",
+				who, projectName, timestamp.Format("2006-01-02 15:04")))
+		}
+	}
+	for _, jid := range evt.Leave {
+		participant := canonicalSender(client, jid, types.EmptyJID)
+		if err := messageStore.LeaveGroupParticipant(chatJID, participant, timestamp); err != nil {
+			logger.Warnf("Failed to store leave of %s in %s: %v", participant, chatJID, err)
+		}
+		record("group_leave", participant, "")
+		fmt.Printf("👋 %s left %s\n", participant, projectName)
+	}
+	for _, jid := range evt.Promote {
+		participant := canonicalSender(client, jid, types.EmptyJID)
+		if err := messageStore.SetGroupParticipantAdmin(chatJID, participant, true); err != nil {
+			logger.Warnf("Failed to store promotion of %s in %s: %v", participant, chatJID, err)
+		}
+		record("group_promote", participant, "")
+	}
+	for _, jid := range evt.Demote {
+		participant := canonicalSender(client, jid, types.EmptyJID)
+		if err := messageStore.SetGroupParticipantAdmin(chatJID, participant, false); err != nil {
+			logger.Warnf("Failed to store demotion of %s in %s: %v", participant, chatJID, err)
+		}
+		record("group_demote", participant, "")
+	}
+	if evt.Name != nil {
+		record("group_subject", "", evt.Name.Name)
+		fmt.Printf("✏️  %s group subject changed to %q\n", projectName, evt.Name.Name)
+	}
+	if evt.Topic != nil {
+		record("group_description", "", evt.Topic.Topic)
+	}
+}
+
+// Load the current member list of every tracked group, so the roster is complete for
+// members who joined before the bridge was tracking changes
+func syncTrackedGroupRosters(client *whatsmeow.Client, messageStore *MessageStore, logger waLog.Logger) {
+	for projectName, groupJID := range projectGroupJIDs() {
+		jid, err := types.ParseJID(groupJID)
+		if err != nil {
+			continue
+		}
+		info, err := client.GetGroupInfo(jid)
+		if err != nil {
+			logger.Warnf("Failed to get group info for %s: %v", projectName, err)
+			continue
+		}
+
+		var participants []GroupParticipant
+		for _, p := range info.Participants {
+			participants = append(participants, GroupParticipant{
+				ChatJID:        jid.String(),
+				Participant:    canonicalSender(client, p.JID, p.PhoneNumber),
+				ParticipantJID: p.JID.String(),
+				IsAdmin:        p.IsAdmin || p.IsSuperAdmin,
+				IsSuperAdmin:   p.IsSuperAdmin,
+			})
+		}
+		if err := messageStore.SyncGroupParticipants(jid.String(), participants, time.Now()); err != nil {
+			logger.Warnf("Failed to sync roster for %s: %v", projectName, err)
+			continue
+		}
+		fmt.Printf("👥 Synced %d member(s) of %s\n", len(participants), projectName)
+	}
+}
+
+// Record a participant joining a group (rejoining clears the earlier leave)
+func (store *MessageStore) JoinGroupParticipant(chatJID, participant, participantJID string, joinedAt time.Time) error {
+	_, err := store.db.Exec(`
+		INSERT INTO group_participants (chat_jid, participant, participant_jid, is_admin, is_super_admin, joined_at, left_at)
+		VALUES (?, ?, ?, 0, 0, ?, NULL)
+		ON CONFLICT(chat_jid, participant) DO UPDATE SET
+			participant_jid = excluded.participant_jid,
+			is_admin = 0,
+			is_super_admin = 0,
+			joined_at = excluded.joined_at,
+			left_at = NULL
+	`, chatJID, participant, participantJID, joinedAt)
+	return err
+}
+
+// Record a participant leaving or being removed from a group
+func (store *MessageStore) LeaveGroupParticipant(chatJID, participant string, leftAt time.Time) error {
+	_, err := store.db.Exec(`
+		INSERT INTO group_participants (chat_jid, participant, participant_jid, joined_at, left_at)
+		VALUES (?, ?, '', ?, ?)
+		ON CONFLICT(chat_jid, participant) DO UPDATE SET
+			is_admin = 0,
+			is_super_admin = 0,
+			left_at = excluded.left_at
+	`, chatJID, participant, leftAt, leftAt)
+	return err
+}
+
+// Record a participant being promoted to or demoted from group admin
+func (store *MessageStore) SetGroupParticipantAdmin(chatJID, participant string, isAdmin bool) error {
+	_, err := store.db.Exec(`
+		UPDATE group_participants SET is_admin = ?, is_super_admin = CASE WHEN ? THEN is_super_admin ELSE 0 END
+		WHERE chat_jid = ? AND participant = ?
+	`, isAdmin, isAdmin, chatJID, participant)
+	return err
+}
+
+// Reconcile a group's stored members with its current member list: new members are
+// added with seenAt as their join date and members no longer listed are marked as left
+func (store *MessageStore) SyncGroupParticipants(chatJID string, participants []GroupParticipant, seenAt time.Time) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	current := map[string]bool{}
+	for _, p := range participants {
+		current[p.Participant] = true
+		if _, err := tx.Exec(`
+			INSERT INTO group_participants (chat_jid, participant, participant_jid, is_admin, is_super_admin, joined_at, left_at)
+			VALUES (?, ?, ?, ?, ?, ?, NULL)
+			ON CONFLICT(chat_jid, participant) DO UPDATE SET
+				participant_jid = excluded.participant_jid,
+				is_admin = excluded.is_admin,
+				is_super_admin = excluded.is_super_admin,
+				joined_at = CASE WHEN left_at IS NULL THEN joined_at ELSE excluded.joined_at END,
+				left_at = NULL
+		`, chatJID, p.Participant, p.ParticipantJID, p.IsAdmin, p.IsSuperAdmin, seenAt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	rows, err := tx.Query("SELECT participant FROM group_participants WHERE chat_jid = ? AND left_at IS NULL", chatJID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var gone []string
+	for rows.Next() {
+		var participant string
+		if err := rows.Scan(&participant); err == nil && !current[participant] {
+			gone = append(gone, participant)
+		}
+	}
+	rows.Close()
+
+	for _, participant := range gone {
+		if _, err := tx.Exec(`
+			UPDATE group_participants SET is_admin = 0, is_super_admin = 0, left_at = ?
+			WHERE chat_jid = ? AND participant = ?
+		`, seenAt, chatJID, participant); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Get a group's members with their contractor records, optionally including former members
+func (store *MessageStore) GetGroupRoster(chatJID string, includeLeft bool) ([]GroupParticipant, error) {
+	query := `
+		SELECT g.chat_jid, g.participant, g.participant_jid, g.is_admin, g.is_super_admin, g.joined_at, g.left_at,
+			c.id, c.name, c.company, c.team, c.project_name, c.updated_at
+		FROM group_participants g
+		LEFT JOIN contractors c ON c.id = g.participant
+		WHERE g.chat_jid = ?`
+	if !includeLeft {
+		query += " AND g.left_at IS NULL"
+	}
+	query += " ORDER BY g.joined_at"
+
+	rows, err := store.db.Query(query, chatJID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roster := []GroupParticipant{}
+	for rows.Next() {
+		var p GroupParticipant
+		var leftAt sql.NullTime
+		var id, name, company, team, projectName sql.NullString
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&p.ChatJID, &p.Participant, &p.ParticipantJID, &p.IsAdmin, &p.IsSuperAdmin, &p.JoinedAt, &leftAt,
+			&id, &name, &company, &team, &projectName, &updatedAt); err != nil {
+			return nil, err
+		}
+		if leftAt.Valid {
+			p.LeftAt = &leftAt.Time
+		}
+		if id.Valid {
+			p.Contractor = &Contractor{
+				ID:          id.String,
+				Name:        name.String,
+				Company:     company.String,
+				Team:        team.String,
+				ProjectName: projectName.String,
+				UpdatedAt:   updatedAt.Time,
+			}
+		}
+		roster = append(roster, p)
+	}
+	return roster, rows.Err()
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+)
+
+// Site location configuration (overridable through the environment)
+var (
+	LOCATION_MAX_DISTANCE_METERS = getEnvInt("LOCATION_MAX_DISTANCE_METERS", 200)
+	DROP_LOCATIONS_CSV           = getEnv("DROP_LOCATIONS_CSV", "") // optional expected coordinates imported at startup
+)
+
+// SiteLocation is a static or live location shared by a contractor in a tracked group
+type SiteLocation struct {
+	MessageID      string    `json:"message_id"`
+	ChatJID        string    `json:"chat_jid"`
+	DropNumber     string    `json:"drop_number,omitempty"`
+	ProjectName    string    `json:"project_name,omitempty"`
+	Sender         string    `json:"sender"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	AccuracyMeters uint32    `json:"accuracy_meters,omitempty"`
+	IsLive         bool      `json:"is_live"`
+	Description    string    `json:"description,omitempty"`
+	DistanceMeters *float64  `json:"distance_meters,omitempty"` // from the drop's expected coordinates
+	Flagged        bool      `json:"flagged"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// ExpectedLocation is the planned site coordinate of a drop
+type ExpectedLocation struct {
+	DropNumber string    `json:"drop_number"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Address    string    `json:"address,omitempty"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// Extract the coordinates of a location or live location message, or nil for other messages
+func extractLocation(msg *waProto.Message) *SiteLocation {
+	if msg == nil {
+		return nil
+	}
+	if loc := msg.GetLocationMessage(); loc != nil {
+		var parts []string
+		for _, part := range []string{loc.GetName(), loc.GetAddress(), loc.GetComment()} {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+		return &SiteLocation{
+			Latitude:       loc.GetDegreesLatitude(),
+			Longitude:      loc.GetDegreesLongitude(),
+			AccuracyMeters: loc.GetAccuracyInMeters(),
+			IsLive:         loc.GetIsLive(),
+			Description:    strings.Join(parts, " - "),
+		}
+	}
+	if loc := msg.GetLiveLocationMessage(); loc != nil {
+		return &SiteLocation{
+			Latitude:       loc.GetDegreesLatitude(),
+			Longitude:      loc.GetDegreesLongitude(),
+			AccuracyMeters: loc.GetAccuracyInMeters(),
+			IsLive:         true,
+			Description:    loc.GetCaption(),
+		}
+	}
+	return nil
+}
+
+// Great-circle distance between two coordinates in meters
+func haversineMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadius = 6371000.0
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLng := (lng2 - lng1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// Store a shared location against the sender's open drop and flag it when it is
+// too far from the drop's expected coordinates
+func recordSiteLocation(messageStore *MessageStore, loc *SiteLocation) {
+	loc.ProjectName = getProjectNameByJID(loc.ChatJID)
+	if loc.ProjectName == "" {
+		return
+	}
+	loc.DropNumber = messageStore.ResolveDropForMedia(loc.ChatJID, loc.Sender, loc.Description, loc.Timestamp)
+
+	if loc.DropNumber != "" {
+		expected, err := messageStore.GetExpectedLocation(loc.DropNumber)
+		if err == nil {
+			distance := math.Round(haversineMeters(expected.Latitude, expected.Longitude, loc.Latitude, loc.Longitude))
+			loc.DistanceMeters = &distance
+			loc.Flagged = distance > float64(LOCATION_MAX_DISTANCE_METERS)
+		} else if err != sql.ErrNoRows {
+			fmt.Printf("⚠️  Failed to load expected location for %s: %v\n", loc.DropNumber, err)
+		}
+	}
+
+	if err := messageStore.StoreSiteLocation(*loc); err != nil {
+		fmt.Printf("⚠️  Failed to store location %s: %v\n", loc.MessageID, err)
+		return
+	}
+	fmt.Printf("📍 Location %.5f,%.5f from %s linked to %q\n", loc.Latitude, loc.Longitude, loc.Sender, loc.DropNumber)
+
+	if !loc.Flagged {
+		return
+	}
+	fmt.Printf("🚩 Location for %s is %.0fm from the expected site\n", loc.DropNumber, *loc.DistanceMeters)
+	note := fmt.Sprintf("Shared location %.5f,%.5f is %.0fm from the expected site (limit %dm)",
+		loc.Latitude, loc.Longitude, *loc.DistanceMeters, LOCATION_MAX_DISTANCE_METERS)
+	if err := appendSheetsQANote(loc.DropNumber, loc.ProjectName, note); err != nil {
+		fmt.Printf("⚠️  Failed to add QA note for %s: %v\n", loc.DropNumber, err)
+	}
+}
+
+// Import expected drop coordinates from CSV rows of drop_number,latitude,longitude[,address].
+// A header row and rows that don't parse are skipped.
+func (store *MessageStore) ImportExpectedLocations(r io.Reader) (int, int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read CSV: %v", err)
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	imported, skipped := 0, 0
+	now := time.Now()
+	for _, record := range records {
+		if len(record) < 3 {
+			skipped++
+			continue
+		}
+		dropNumber := strings.ToUpper(strings.TrimSpace(record[0]))
+		latitude, latErr := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		longitude, lngErr := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if !dropPattern.MatchString(dropNumber) || latErr != nil || lngErr != nil {
+			skipped++
+			continue
+		}
+		address := ""
+		if len(record) > 3 {
+			address = strings.TrimSpace(record[3])
+		}
+		if _, err := tx.Exec(`
+			INSERT OR REPLACE INTO drop_expected_locations (drop_number, latitude, longitude, address, imported_at)
+			VALUES (?, ?, ?, ?, ?)
+		`, dropNumber, latitude, longitude, address, now); err != nil {
+			tx.Rollback()
+			return 0, 0, err
+		}
+		imported++
+	}
+	return imported, skipped, tx.Commit()
+}
+
+// Get a drop's expected coordinates (sql.ErrNoRows when none were imported)
+func (store *MessageStore) GetExpectedLocation(dropNumber string) (ExpectedLocation, error) {
+	var expected ExpectedLocation
+	err := store.db.QueryRow(`
+		SELECT drop_number, latitude, longitude, address, imported_at
+		FROM drop_expected_locations WHERE drop_number = ?
+	`, dropNumber).Scan(&expected.DropNumber, &expected.Latitude, &expected.Longitude, &expected.Address, &expected.ImportedAt)
+	return expected, err
+}
+
+// Store a shared location
+func (store *MessageStore) StoreSiteLocation(loc SiteLocation) error {
+	_, err := store.db.Exec(`
+		INSERT OR REPLACE INTO site_locations
+		(message_id, chat_jid, drop_number, project_name, sender, latitude, longitude, accuracy_meters,
+			is_live, description, distance_meters, flagged, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, loc.MessageID, loc.ChatJID, loc.DropNumber, loc.ProjectName, loc.Sender, loc.Latitude, loc.Longitude,
+		loc.AccuracyMeters, loc.IsLive, loc.Description, loc.DistanceMeters, loc.Flagged, loc.Timestamp)
+	return err
+}
+
+// Get the locations shared for a drop, oldest first
+func (store *MessageStore) GetSiteLocations(dropNumber string) ([]SiteLocation, error) {
+	rows, err := store.db.Query(`
+		SELECT message_id, chat_jid, drop_number, project_name, sender, latitude, longitude, accuracy_meters,
+			is_live, description, distance_meters, flagged, timestamp
+		FROM site_locations WHERE drop_number = ? ORDER BY timestamp ASC
+	`, dropNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []SiteLocation{}
+	for rows.Next() {
+		var loc SiteLocation
+		var distance sql.NullFloat64
+		if err := rows.Scan(&loc.MessageID, &loc.ChatJID, &loc.DropNumber, &loc.ProjectName, &loc.Sender,
+			&loc.Latitude, &loc.Longitude, &loc.AccuracyMeters, &loc.IsLive, &loc.Description, &distance,
+			&loc.Flagged, &loc.Timestamp); err != nil {
+			return nil, err
+		}
+		if distance.Valid {
+			loc.DistanceMeters = &distance.Float64
+		}
+		locations = append(locations, loc)
+	}
+	return locations, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaversineMeters(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		want, tolerance        float64
+	}{
+		{"same point", -26.2041, 28.0473, -26.2041, 28.0473, 0, 0.001},
+		{"one degree of latitude", 0, 0, 1, 0, 111195, 1},
+		{"one degree of longitude at the equator", 0, 0, 0, 1, 111195, 1},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111195, 1},
+		{"Johannesburg to Pretoria", -26.2041, 28.0473, -25.7479, 28.2293, 53750, 250},
+		{"a few meters down the street", -26.2041, 28.0473, -26.2041, 28.0478, 50, 1},
+		{"antipodes", 0, 0, 0, 180, math.Pi * 6371000, 1},
+	}
+	for _, tt := range tests {
+		got := haversineMeters(tt.lat1, tt.lng1, tt.lat2, tt.lng2)
+		if math.Abs(got-tt.want) > tt.tolerance {
+			t.Errorf("%s: haversineMeters = %.1f, want %.1f ± %.1f", tt.name, got, tt.want, tt.tolerance)
+		}
+		if back := haversineMeters(tt.lat2, tt.lng2, tt.lat1, tt.lng1); math.Abs(back-got) > 1e-6 {
+			t.Errorf("%s: distance is not symmetric (%.3f and %.3f)", tt.name, got, back)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Open an empty message store in a temporary working directory
+func newTestMessageStore(t *testing.T) *MessageStore {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	messageStore, err := NewMessageStore()
+	if err != nil {
+		t.Fatalf("message store: %v", err)
+	}
+	t.Cleanup(func() { messageStore.Close() })
+	return messageStore
+}
+
+// Resolve a $ref into the schema it points at
+func resolveSchemaRef(spec, schema map[string]interface{}) map[string]interface{} {
+	ref, ok := schema["$ref"].(string)
+	if !ok {
+		return schema
+	}
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	resolved, _ := schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{})
+	return resolved
+}
+
+// Check a decoded JSON object against an object schema: no undocumented keys, no missing required ones
+func checkObjectKeys(spec, schema map[string]interface{}, body map[string]interface{}) error {
+	schema = resolveSchemaRef(spec, schema)
+	if shapes, ok := schema["oneOf"].([]interface{}); ok {
+		var errs []string
+		for _, shape := range shapes {
+			err := checkObjectKeys(spec, shape.(map[string]interface{}), body)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("matches no documented shape (%s)", strings.Join(errs, "; "))
+	}
+	properties, ok := schema["properties"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for key := range body {
+		if _, ok := properties[key]; !ok {
+			return fmt.Errorf("undocumented key %q", key)
+		}
+	}
+	required, _ := schema["required"].([]string)
+	for _, key := range required {
+		if _, ok := body[key]; !ok {
+			return fmt.Errorf("missing required key %q", key)
+		}
+	}
+	return nil
+}
+
+// Check that a response is a well-formed error envelope with the given status
+func checkErrorResponse(resp *httptest.ResponseRecorder, status int) error {
+	if resp.Code != status {
+		return fmt.Errorf("status %d, want %d", resp.Code, status)
+	}
+	if contentType := resp.Header().Get("Content-Type"); contentType != "application/json" {
+		return fmt.Errorf("error Content-Type %q, want application/json", contentType)
+	}
+	var body APIErrorResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		return fmt.Errorf("error body is not the JSON envelope: %v", err)
+	}
+	switch {
+	case body.Error.Code != apiErrorCode(status):
+		return fmt.Errorf("error code %q, want %q", body.Error.Code, apiErrorCode(status))
+	case body.Error.Message == "":
+		return fmt.Errorf("error has no message")
+	case body.Error.RequestID == "" || body.Error.RequestID != resp.Header().Get(REQUEST_ID_HEADER):
+		return fmt.Errorf("error request_id %q does not match %s header", body.Error.RequestID, REQUEST_ID_HEADER)
+	}
+	return nil
+}
+
+// The registered handlers and apiRoutes must match, undocumented methods and unknown routes
+// must answer with the error envelope, and every operation with a Check target must answer
+// with its documented status and response keys. Runs against an empty message store in a
+// temporary directory, with no WhatsApp client
+func TestAPIContract(t *testing.T) {
+	messageStore := newTestMessageStore(t)
+
+	authEnabled := API_AUTH_ENABLED
+	defer func() { API_AUTH_ENABLED = authEnabled }()
+
+	handler, mux := newRESTHandler(nil, messageStore)
+	spec := buildOpenAPISpec()
+	paths := spec["paths"].(map[string]interface{})
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return resp
+	}
+
+	documented := map[string]bool{}
+	for _, route := range apiRoutes {
+		documented[route.Pattern] = true
+	}
+	registered := map[string]bool{}
+	for _, pattern := range mux.patterns {
+		registered[pattern] = true
+		if !documented[pattern] {
+			t.Errorf("%s is registered but not documented in apiRoutes", pattern)
+		}
+	}
+	for _, route := range apiRoutes {
+		if !registered[route.Pattern] {
+			t.Errorf("%s is documented but no handler is registered", route.Pattern)
+		}
+	}
+
+	// Authentication failures use the envelope too
+	API_AUTH_ENABLED = true
+	if err := checkErrorResponse(serve(http.MethodGet, "/api/chats", ""), http.StatusUnauthorized); err != nil {
+		t.Errorf("GET /api/chats without an API key: %v", err)
+	}
+	API_AUTH_ENABLED = false
+
+	if err := checkErrorResponse(serve(http.MethodGet, "/api/no-such-route", ""), http.StatusNotFound); err != nil {
+		t.Errorf("GET /api/no-such-route: %v", err)
+	}
+
+	for _, route := range apiRoutes {
+		operations := paths[route.Path].(map[string]interface{})
+
+		// The first method the route does not document must be rejected
+		samplePath := regexp.MustCompile(`\{[^}]+\}`).ReplaceAllString(route.Path, "x")
+		for _, method := range []string{http.MethodPatch, http.MethodPut, http.MethodDelete, http.MethodPost} {
+			if _, ok := operations[strings.ToLower(method)]; ok {
+				continue
+			}
+			if err := checkErrorResponse(serve(method, samplePath, ""), http.StatusMethodNotAllowed); err != nil {
+				t.Errorf("%s %s: %v", method, route.Path, err)
+			}
+			break
+		}
+
+		for _, op := range route.Operations {
+			if op.Check == "" {
+				continue
+			}
+			want := op.CheckStatus
+			if want == 0 {
+				want = http.StatusOK
+			}
+			resp := serve(op.Method, op.Check, op.CheckBody)
+			responseKey := "200"
+			if want != http.StatusOK {
+				if !slices.Contains(op.Statuses, want) {
+					if err := checkErrorResponse(resp, want); err != nil {
+						t.Errorf("%s %s: %v", op.Method, op.Check, err)
+					}
+					continue
+				}
+				responseKey = strconv.Itoa(want)
+			}
+			if resp.Code != want {
+				t.Errorf("%s %s: status %d, want %d (%s)", op.Method, op.Check, resp.Code, want, strings.TrimSpace(resp.Body.String()))
+				continue
+			}
+			if op.ResponseType != "" {
+				continue
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+				t.Errorf("%s %s: response is not a JSON object: %v", op.Method, op.Check, err)
+				continue
+			}
+			operation := operations[strings.ToLower(op.Method)].(map[string]interface{})
+			content := operation["responses"].(map[string]interface{})[responseKey].(map[string]interface{})["content"].(map[string]interface{})
+			schema := content["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+			if err := checkObjectKeys(spec, schema, body); err != nil {
+				t.Errorf("%s %s: %v", op.Method, op.Check, err)
+			}
+		}
+	}
+}
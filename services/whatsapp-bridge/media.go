@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waMmsRetry"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// DownloadMediaRequest represents the request body for the download media API
+type DownloadMediaRequest struct {
+	MessageID string `json:"message_id"`
+	ChatJID   string `json:"chat_jid"`
+}
+
+// DownloadMediaResponse represents the response for the download media API
+type DownloadMediaResponse struct {
+	Success  bool   `json:"success"`
+	Message  string `json:"message"`
+	Filename string `json:"filename,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// Store additional media info in the database
+func (store *MessageStore) StoreMediaInfo(id, chatJID, url string, mediaKey, fileSHA256, fileEncSHA256 []byte, fileLength uint64) error {
+	_, err := store.db.Exec(
+		"UPDATE messages SET url = ?, media_key = ?, file_sha256 = ?, file_enc_sha256 = ?, file_length = ? WHERE id = ? AND chat_jid = ?",
+		url, mediaKey, fileSHA256, fileEncSHA256, fileLength, id, chatJID,
+	)
+	return err
+}
+
+// Get media info from the database
+func (store *MessageStore) GetMediaInfo(id, chatJID string) (string, string, string, string, []byte, []byte, []byte, uint64, error) {
+	var mediaType, filename, url string
+	var directPath sql.NullString
+	var mediaKey, fileSHA256, fileEncSHA256 []byte
+	var fileLength uint64
+
+	err := store.db.QueryRow(
+		"SELECT media_type, filename, url, direct_path, media_key, file_sha256, file_enc_sha256, file_length FROM messages WHERE id = ? AND chat_jid = ?",
+		id, chatJID,
+	).Scan(&mediaType, &filename, &url, &directPath, &mediaKey, &fileSHA256, &fileEncSHA256, &fileLength)
+
+	return mediaType, filename, url, directPath.String, mediaKey, fileSHA256, fileEncSHA256, fileLength, err
+}
+
+// Update the direct path of a media message (e.g. after the sender's phone re-uploaded it)
+func (store *MessageStore) UpdateMediaDirectPath(id, chatJID, directPath string) error {
+	_, err := store.db.Exec(
+		"UPDATE messages SET direct_path = ? WHERE id = ? AND chat_jid = ?",
+		directPath, id, chatJID,
+	)
+	return err
+}
+
+// MediaDownloader implements the whatsmeow.DownloadableMessage interface
+type MediaDownloader struct {
+	URL           string
+	DirectPath    string
+	MediaKey      []byte
+	FileLength    uint64
+	FileSHA256    []byte
+	FileEncSHA256 []byte
+	MediaType     whatsmeow.MediaType
+}
+
+// GetDirectPath implements the DownloadableMessage interface
+func (d *MediaDownloader) GetDirectPath() string {
+	return d.DirectPath
+}
+
+// GetURL implements the DownloadableMessage interface
+func (d *MediaDownloader) GetURL() string {
+	return d.URL
+}
+
+// GetMediaKey implements the DownloadableMessage interface
+func (d *MediaDownloader) GetMediaKey() []byte {
+	return d.MediaKey
+}
+
+// GetFileLength implements the DownloadableMessage interface
+func (d *MediaDownloader) GetFileLength() uint64 {
+	return d.FileLength
+}
+
+// GetFileSHA256 implements the DownloadableMessage interface
+func (d *MediaDownloader) GetFileSHA256() []byte {
+	return d.FileSHA256
+}
+
+// GetFileEncSHA256 implements the DownloadableMessage interface
+func (d *MediaDownloader) GetFileEncSHA256() []byte {
+	return d.FileEncSHA256
+}
+
+// GetMediaType implements the DownloadableMessage interface
+func (d *MediaDownloader) GetMediaType() whatsmeow.MediaType {
+	return d.MediaType
+}
+
+// Function to download media from a message into the media store.
+// Returns the media type, filename and the storage key of the file.
+func downloadMedia(client *whatsmeow.Client, messageStore *MessageStore, messageID, chatJID string) (bool, string, string, string, error) {
+	mediaType, filename, key, _, _, err := storeMediaMessage(client, messageStore, messageID, chatJID)
+
+	// Expired media: give the sender's phone a moment to re-upload it, then try again
+	if errors.Is(err, errMediaRetryRequested) {
+		if waitErr := waitForMediaRetry(chatJID, messageID, time.Duration(MEDIA_RETRY_WAIT_SECONDS)*time.Second); waitErr != nil {
+			return false, "", "", "", fmt.Errorf("%w: %v", err, waitErr)
+		}
+		mediaType, filename, key, _, _, err = storeMediaMessage(client, messageStore, messageID, chatJID)
+	}
+	if err != nil {
+		return false, "", "", "", err
+	}
+	return true, mediaType, filename, key, nil
+}
+
+// Make sure a media message is present in the media store, downloading it from
+// WhatsApp if necessary. Returns the media type, filename, storage key, size and
+// whether the file was newly downloaded.
+func storeMediaMessage(client *whatsmeow.Client, messageStore *MessageStore, messageID, chatJID string) (string, string, string, int64, bool, error) {
+	if mediaStore == nil {
+		return "", "", "", 0, false, fmt.Errorf("media store is not configured")
+	}
+
+	// Get media info from the database
+	mediaType, filename, url, directPath, mediaKey, fileSHA256, fileEncSHA256, fileLength, err := messageStore.GetMediaInfo(messageID, chatJID)
+	if err != nil {
+		// Try to get basic info if extended info isn't available
+		err = messageStore.db.QueryRow(
+			"SELECT media_type, filename FROM messages WHERE id = ? AND chat_jid = ?",
+			messageID, chatJID,
+		).Scan(&mediaType, &filename)
+
+		if err != nil {
+			return "", "", "", 0, false, fmt.Errorf("failed to find message: %w", err)
+		}
+	}
+
+	// Check if this is a media message
+	if mediaType == "" {
+		return "", "", "", 0, false, errNotMediaMessage
+	}
+
+	// If we don't have all the media info we need, we can't download
+	if (url == "" && directPath == "") || len(mediaKey) == 0 || len(fileSHA256) == 0 || len(fileEncSHA256) == 0 || fileLength == 0 {
+		return "", "", "", 0, false, fmt.Errorf("incomplete media information for download")
+	}
+
+	// Files are content-addressed, so a re-posted photo is only stored once
+	shaHex := hex.EncodeToString(fileSHA256)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	if key, size, err := messageStore.GetArchivedMedia(shaHex); err == nil {
+		if exists, _ := mediaStore.Exists(ctx, key); exists {
+			return mediaType, filename, key, size, false, nil
+		}
+	}
+
+	fmt.Printf("Attempting to download media for message %s in chat %s...\n", messageID, chatJID)
+
+	// Download the media using whatsmeow client
+	mediaData, err := fetchMediaBytes(client, mediaType, url, directPath, mediaKey, fileSHA256, fileEncSHA256, fileLength)
+	if err != nil {
+		// The CDN copy has expired - ask the sender's phone to upload it again
+		if errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) || errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410) {
+			if retryErr := requestMediaRetry(client, messageStore, messageID, chatJID, mediaKey); retryErr != nil {
+				return "", "", "", 0, false, fmt.Errorf("%v (media retry request failed: %v)", err, retryErr)
+			}
+			return "", "", "", 0, false, errMediaRetryRequested
+		}
+		return "", "", "", 0, false, err
+	}
+
+	// Save the downloaded media to the media store
+	key := mediaKeyFor(shaHex, filename)
+	if err := mediaStore.Put(ctx, key, mediaData, mediaContentType(filename)); err != nil {
+		return "", "", "", 0, false, fmt.Errorf("failed to save media file: %v", err)
+	}
+	if err := messageStore.StoreArchivedMedia(shaHex, mediaType, key, int64(len(mediaData))); err != nil {
+		return "", "", "", 0, false, fmt.Errorf("failed to record stored media: %v", err)
+	}
+
+	fmt.Printf("Successfully downloaded %s media to %s:%s (%d bytes)\n", mediaType, mediaStore.Name(), key, len(mediaData))
+	return mediaType, filename, key, int64(len(mediaData)), true, nil
+}
+
+// Media retry configuration (overridable through the environment)
+var MEDIA_RETRY_WAIT_SECONDS = getEnvInt("MEDIA_RETRY_WAIT_SECONDS", 30)
+
+// Returned when a media download is requested for a text-only message
+var errNotMediaMessage = errors.New("not a media message")
+
+// Returned when expired media has been requested again from the sender's phone
+var errMediaRetryRequested = errors.New("media expired on WhatsApp servers; re-upload requested from the sender's phone")
+
+// Callers waiting for a media retry to complete, keyed by chat and message ID
+var (
+	mediaRetryWaitersMu sync.Mutex
+	mediaRetryWaiters   = make(map[string][]chan error)
+)
+
+func mediaRetryKey(chatJID, messageID string) string {
+	return chatJID + "/" + messageID
+}
+
+// Wait until a requested media re-upload completes (or fails), up to the timeout
+func waitForMediaRetry(chatJID, messageID string, timeout time.Duration) error {
+	done := make(chan error, 1)
+	key := mediaRetryKey(chatJID, messageID)
+
+	mediaRetryWaitersMu.Lock()
+	mediaRetryWaiters[key] = append(mediaRetryWaiters[key], done)
+	mediaRetryWaitersMu.Unlock()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		mediaRetryWaitersMu.Lock()
+		waiters := mediaRetryWaiters[key]
+		for i, waiter := range waiters {
+			if waiter == done {
+				mediaRetryWaiters[key] = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(mediaRetryWaiters[key]) == 0 {
+			delete(mediaRetryWaiters, key)
+		}
+		mediaRetryWaitersMu.Unlock()
+		return fmt.Errorf("timed out waiting for the sender's phone to re-upload the media")
+	}
+}
+
+// Wake up everyone waiting on a media retry
+func resolveMediaRetry(chatJID, messageID string, err error) {
+	key := mediaRetryKey(chatJID, messageID)
+
+	mediaRetryWaitersMu.Lock()
+	waiters := mediaRetryWaiters[key]
+	delete(mediaRetryWaiters, key)
+	mediaRetryWaitersMu.Unlock()
+
+	for _, waiter := range waiters {
+		waiter <- err
+	}
+}
+
+// Ask the sender's phone to re-upload media whose CDN copy has expired.
+// The answer arrives later as an events.MediaRetry (see handleMediaRetry).
+func requestMediaRetry(client *whatsmeow.Client, messageStore *MessageStore, messageID, chatJID string, mediaKey []byte) error {
+	// Don't spam the phone if a request is already outstanding
+	if status, requestedAt, err := messageStore.GetMediaRetryStatus(messageID, chatJID); err == nil &&
+		status == "requested" && time.Since(requestedAt) < 10*time.Minute {
+		return nil
+	}
+
+	chat, err := types.ParseJID(chatJID)
+	if err != nil {
+		return fmt.Errorf("invalid chat JID: %v", err)
+	}
+
+	senderJID, isFromMe, err := messageStore.GetMessageSender(messageID, chatJID)
+	if err != nil {
+		return fmt.Errorf("failed to load message sender: %v", err)
+	}
+
+	info := &types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chat,
+			IsFromMe: isFromMe,
+			IsGroup:  chat.Server == types.GroupServer,
+		},
+		ID: messageID,
+	}
+	if senderJID != "" {
+		if sender, err := types.ParseJID(senderJID); err == nil {
+			info.Sender = sender
+		}
+	}
+	if info.IsGroup && info.Sender.IsEmpty() {
+		return fmt.Errorf("sender JID unknown for group message %s", messageID)
+	}
+
+	if err := client.SendMediaRetryReceipt(info, mediaKey); err != nil {
+		return err
+	}
+
+	fmt.Printf("🔁 Requested media re-upload for %s in %s\n", messageID, chatJID)
+	return messageStore.SetMediaRetryStatus(messageID, chatJID, "requested", "")
+}
+
+// Handle the phone's answer to a media retry request: store the refreshed
+// direct path and finish the download
+func handleMediaRetry(client *whatsmeow.Client, messageStore *MessageStore, evt *events.MediaRetry, logger waLog.Logger) {
+	chatJID := evt.ChatID.String()
+	messageID := evt.MessageID
+
+	_, _, _, _, mediaKey, _, _, _, err := messageStore.GetMediaInfo(messageID, chatJID)
+	if err != nil || len(mediaKey) == 0 {
+		logger.Warnf("Media retry for unknown message %s in %s", messageID, chatJID)
+		return
+	}
+
+	retryData, err := whatsmeow.DecryptMediaRetryNotification(evt, mediaKey)
+	if err == nil && retryData.GetResult() != waMmsRetry.MediaRetryNotification_SUCCESS {
+		err = fmt.Errorf("phone reported %s", retryData.GetResult().String())
+	}
+	if err == nil && retryData.GetDirectPath() == "" {
+		err = fmt.Errorf("phone returned no direct path")
+	}
+	if err != nil {
+		fmt.Printf("❌ Media retry failed for %s in %s: %v\n", messageID, chatJID, err)
+		messageStore.SetMediaRetryStatus(messageID, chatJID, "failed", err.Error())
+		resolveMediaRetry(chatJID, messageID, fmt.Errorf("media re-upload failed: %v", err))
+		return
+	}
+
+	if err := messageStore.UpdateMediaDirectPath(messageID, chatJID, retryData.GetDirectPath()); err != nil {
+		logger.Errorf("Failed to store refreshed direct path for %s: %v", messageID, err)
+		resolveMediaRetry(chatJID, messageID, err)
+		return
+	}
+	fmt.Printf("🔁 Media re-uploaded for %s in %s, downloading...\n", messageID, chatJID)
+
+	go func() {
+		_, _, _, _, _, err := storeMediaMessage(client, messageStore, messageID, chatJID)
+		if err != nil {
+			messageStore.SetMediaRetryStatus(messageID, chatJID, "failed", err.Error())
+		} else {
+			messageStore.SetMediaRetryStatus(messageID, chatJID, "completed", "")
+
+			// Let the archiver index the recovered file against its drop
+			if mediaArchiver != nil && getProjectNameByJID(chatJID) != "" {
+				mediaArchiver.EnqueueMessage(messageID, chatJID)
+			}
+		}
+		resolveMediaRetry(chatJID, messageID, err)
+	}()
+}
+
+// Get the full sender JID and direction of a stored message
+func (store *MessageStore) GetMessageSender(id, chatJID string) (string, bool, error) {
+	var senderJID sql.NullString
+	var isFromMe bool
+	err := store.db.QueryRow(
+		"SELECT sender_jid, is_from_me FROM messages WHERE id = ? AND chat_jid = ?",
+		id, chatJID,
+	).Scan(&senderJID, &isFromMe)
+	return senderJID.String, isFromMe, err
+}
+
+// Record the state of a media retry request
+func (store *MessageStore) SetMediaRetryStatus(id, chatJID, status, errMsg string) error {
+	now := time.Now()
+	_, err := store.db.Exec(`
+		INSERT INTO media_retries (message_id, chat_jid, status, error, requested_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(message_id, chat_jid) DO UPDATE SET
+			status = excluded.status,
+			error = excluded.error,
+			requested_at = CASE WHEN excluded.status = 'requested' THEN excluded.requested_at ELSE media_retries.requested_at END,
+			updated_at = excluded.updated_at
+	`, id, chatJID, status, errMsg, now, now)
+	return err
+}
+
+// Get the state of a media retry request
+func (store *MessageStore) GetMediaRetryStatus(id, chatJID string) (string, time.Time, error) {
+	var status string
+	var requestedAt time.Time
+	err := store.db.QueryRow(
+		"SELECT status, requested_at FROM media_retries WHERE message_id = ? AND chat_jid = ?",
+		id, chatJID,
+	).Scan(&status, &requestedAt)
+	return status, requestedAt, err
+}
+
+// Count media retry requests still waiting for the sender's phone
+func (store *MessageStore) CountPendingMediaRetries(ctx context.Context) (int, error) {
+	var count int
+	err := store.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM media_retries WHERE status = 'requested'").Scan(&count)
+	return count, err
+}
+
+// Write a row to prove messages.db accepts writes
+func (store *MessageStore) ProbeWrite(ctx context.Context) error {
+	_, err := store.db.ExecContext(ctx, `
+		INSERT INTO health_probe (id, checked_at) VALUES (1, ?)
+		ON CONFLICT(id) DO UPDATE SET checked_at = excluded.checked_at
+	`, time.Now())
+	return err
+}
+
+// Map a stored media type to the whatsmeow media type used for download keys
+func whatsmeowMediaType(mediaType string) (whatsmeow.MediaType, error) {
+	switch mediaType {
+	case "image":
+		return whatsmeow.MediaImage, nil
+	case "video":
+		return whatsmeow.MediaVideo, nil
+	case "audio":
+		return whatsmeow.MediaAudio, nil
+	case "document":
+		return whatsmeow.MediaDocument, nil
+	default:
+		return "", fmt.Errorf("unsupported media type: %s", mediaType)
+	}
+}
+
+// Download and decrypt media bytes from the WhatsApp CDN
+func fetchMediaBytes(client *whatsmeow.Client, mediaType, url, directPath string, mediaKey, fileSHA256, fileEncSHA256 []byte, fileLength uint64) ([]byte, error) {
+	waMediaType, err := whatsmeowMediaType(mediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	// Prefer the direct path captured at ingest; it works across media hosts and
+	// is what the sender's phone refreshes when media is re-uploaded
+	if directPath != "" {
+		mediaData, err := client.DownloadMediaWithPath(ctx, directPath, fileEncSHA256, fileSHA256, mediaKey,
+			int(fileLength), waMediaType, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to download media: %w", err)
+		}
+		return mediaData, nil
+	}
+
+	// Older rows only have the URL, so rebuild the direct path from it
+	downloader := &MediaDownloader{
+		URL:           url,
+		DirectPath:    extractDirectPathFromURL(url),
+		MediaKey:      mediaKey,
+		FileLength:    fileLength,
+		FileSHA256:    fileSHA256,
+		FileEncSHA256: fileEncSHA256,
+		MediaType:     waMediaType,
+	}
+
+	mediaData, err := client.Download(ctx, downloader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download media: %w", err)
+	}
+	return mediaData, nil
+}
+
+// Extract direct path from a WhatsApp media URL
+func extractDirectPathFromURL(url string) string {
+	// The direct path is typically in the URL, we need to extract it
+	// Example URL: https://mmg.whatsapp.net/v/t62.7118-24/13812002_698058036224062_3424455886509161511_n.enc?ccb=11-4&oh=...
+
+	// Find the path part after the domain
+	parts := strings.SplitN(url, ".net/", 2)
+	if len(parts) < 2 {
+		return url // Return original URL if parsing fails
+	}
+
+	pathPart := parts[1]
+
+	// Remove query parameters
+	pathPart = strings.SplitN(pathPart, "?", 2)[0]
+
+	// Create proper direct path format
+	return "/" + pathPart
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Media storage configuration (overridable through the environment)
+var (
+	MEDIA_STORE_BACKEND      = getEnv("MEDIA_STORE_BACKEND", "local") // "local" or "s3"
+	MEDIA_STORE_DIR          = getEnv("MEDIA_STORE_DIR", "store/media")
+	MEDIA_S3_ENDPOINT        = getEnv("MEDIA_S3_ENDPOINT", "")
+	MEDIA_S3_BUCKET          = getEnv("MEDIA_S3_BUCKET", "")
+	MEDIA_S3_ACCESS_KEY      = getEnv("MEDIA_S3_ACCESS_KEY", "")
+	MEDIA_S3_SECRET_KEY      = getEnv("MEDIA_S3_SECRET_KEY", "")
+	MEDIA_S3_REGION          = getEnv("MEDIA_S3_REGION", "")
+	MEDIA_S3_PREFIX          = getEnv("MEDIA_S3_PREFIX", "")
+	MEDIA_S3_USE_SSL         = getEnvBool("MEDIA_S3_USE_SSL", true)
+	MEDIA_S3_PRESIGN         = getEnvBool("MEDIA_S3_PRESIGN", true)
+	MEDIA_URL_EXPIRY_MINUTES = getEnvInt("MEDIA_URL_EXPIRY_MINUTES", 60)
+	MEDIA_PUBLIC_BASE_URL    = getEnv("MEDIA_PUBLIC_BASE_URL", "http://localhost:8080")
+)
+
+// Media store used for downloads, archival and the media API, set up in main
+var mediaStore MediaStore
+
+// MediaObjectInfo describes a stored media file
+type MediaObjectInfo struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// MediaObject is an open stored media file
+type MediaObject interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// MediaStore is where downloaded media is kept. Keys are slash-separated
+// relative paths such as "ab/cd/<sha256>.jpg".
+type MediaStore interface {
+	// Name of the backend, for logging
+	Name() string
+	// Store a file under the given key, replacing any existing file
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Open a stored file for reading
+	Get(ctx context.Context, key string) (MediaObject, MediaObjectInfo, error)
+	// Check whether a file exists under the given key
+	Exists(ctx context.Context, key string) (bool, error)
+	// URL a client can fetch the file from (presigned or proxied through the bridge)
+	URL(ctx context.Context, key string) (string, error)
+}
+
+// Create the media store selected by MEDIA_STORE_BACKEND
+func NewMediaStoreFromEnv() (MediaStore, error) {
+	switch strings.ToLower(MEDIA_STORE_BACKEND) {
+	case "", "local":
+		return NewLocalMediaStore(MEDIA_STORE_DIR)
+	case "s3", "minio":
+		return NewS3MediaStore(MEDIA_S3_ENDPOINT, MEDIA_S3_BUCKET, MEDIA_S3_ACCESS_KEY, MEDIA_S3_SECRET_KEY,
+			MEDIA_S3_REGION, MEDIA_S3_PREFIX, MEDIA_S3_USE_SSL, MEDIA_S3_PRESIGN,
+			time.Duration(MEDIA_URL_EXPIRY_MINUTES)*time.Minute)
+	default:
+		return nil, fmt.Errorf("unknown media store backend: %s", MEDIA_STORE_BACKEND)
+	}
+}
+
+// Content-addressed key for a file: <aa>/<bb>/<sha256><ext>
+func mediaKeyFor(shaHex, filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return path.Join(shaHex[0:2], shaHex[2:4], shaHex+ext)
+}
+
+// Check that a media key is a clean relative path (no traversal out of the store)
+func validMediaKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	return path.Clean(key) == key && !strings.HasPrefix(key, "../") && key != ".." && key != "."
+}
+
+// Guess the content type of a media file from its name
+func mediaContentType(filename string) string {
+	if contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// URL that proxies a stored file through the bridge's /api/files endpoint
+func proxiedMediaURL(key string) string {
+	return strings.TrimRight(MEDIA_PUBLIC_BASE_URL, "/") + "/api/files/" + key
+}
+
+// LocalMediaStore keeps media on the local filesystem
+type LocalMediaStore struct {
+	root string
+}
+
+// Create a media store rooted at the given directory
+func NewLocalMediaStore(root string) (*LocalMediaStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create media store directory: %v", err)
+	}
+	return &LocalMediaStore{root: root}, nil
+}
+
+func (s *LocalMediaStore) Name() string {
+	return "local"
+}
+
+func (s *LocalMediaStore) resolve(key string) (string, error) {
+	if !validMediaKey(key) {
+		return "", fmt.Errorf("invalid media key: %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalMediaStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	target, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create media directory: %v", err)
+	}
+
+	// Write to a temporary file of our own first, so a crash or a concurrent Put of the same
+	// key never leaves a truncated file behind
+	tmp, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create media file: %v", err)
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write media file: %v", err)
+	}
+	if err := os.Rename(tmpPath, target); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to finalize media file: %v", err)
+	}
+	return nil
+}
+
+func (s *LocalMediaStore) Get(ctx context.Context, key string) (MediaObject, MediaObjectInfo, error) {
+	target, err := s.resolve(key)
+	if err != nil {
+		return nil, MediaObjectInfo{}, err
+	}
+	file, err := os.Open(target)
+	if err != nil {
+		return nil, MediaObjectInfo{}, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, MediaObjectInfo{}, err
+	}
+	return file, MediaObjectInfo{
+		Size:        stat.Size(),
+		ContentType: mediaContentType(key),
+		ModTime:     stat.ModTime(),
+	}, nil
+}
+
+func (s *LocalMediaStore) Exists(ctx context.Context, key string) (bool, error) {
+	target, err := s.resolve(key)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(target); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *LocalMediaStore) URL(ctx context.Context, key string) (string, error) {
+	if !validMediaKey(key) {
+		return "", fmt.Errorf("invalid media key: %q", key)
+	}
+	return proxiedMediaURL(key), nil
+}
+
+// S3MediaStore keeps media in an S3-compatible bucket (AWS S3, MinIO, R2, ...)
+type S3MediaStore struct {
+	client  *minio.Client
+	bucket  string
+	prefix  string
+	presign bool
+	expiry  time.Duration
+}
+
+// Create an S3-compatible media store, creating the bucket if it doesn't exist
+func NewS3MediaStore(endpoint, bucket, accessKey, secretKey, region, prefix string, useSSL, presign bool, expiry time.Duration) (*S3MediaStore, error) {
+	if endpoint == "" || bucket == "" {
+		return nil, fmt.Errorf("MEDIA_S3_ENDPOINT and MEDIA_S3_BUCKET are required for the s3 media store")
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+		Region: region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check S3 bucket %s: %v", bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: region}); err != nil {
+			return nil, fmt.Errorf("failed to create S3 bucket %s: %v", bucket, err)
+		}
+		fmt.Printf("🪣 Created S3 bucket %s\n", bucket)
+	}
+
+	if expiry <= 0 {
+		expiry = time.Hour
+	}
+
+	return &S3MediaStore{
+		client:  client,
+		bucket:  bucket,
+		prefix:  strings.Trim(prefix, "/"),
+		presign: presign,
+		expiry:  expiry,
+	}, nil
+}
+
+func (s *S3MediaStore) Name() string {
+	return "s3"
+}
+
+func (s *S3MediaStore) objectName(key string) (string, error) {
+	if !validMediaKey(key) {
+		return "", fmt.Errorf("invalid media key: %q", key)
+	}
+	if s.prefix == "" {
+		return key, nil
+	}
+	return s.prefix + "/" + key, nil
+}
+
+func (s *S3MediaStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	name, err := s.objectName(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(ctx, s.bucket, name, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to S3: %v", name, err)
+	}
+	return nil
+}
+
+func (s *S3MediaStore) Get(ctx context.Context, key string) (MediaObject, MediaObjectInfo, error) {
+	name, err := s.objectName(key)
+	if err != nil {
+		return nil, MediaObjectInfo{}, err
+	}
+	stat, err := s.client.StatObject(ctx, s.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, MediaObjectInfo{}, err
+	}
+	object, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, MediaObjectInfo{}, err
+	}
+	return object, MediaObjectInfo{
+		Size:        stat.Size,
+		ContentType: stat.ContentType,
+		ModTime:     stat.LastModified,
+	}, nil
+}
+
+func (s *S3MediaStore) Exists(ctx context.Context, key string) (bool, error) {
+	name, err := s.objectName(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = s.client.StatObject(ctx, s.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *S3MediaStore) URL(ctx context.Context, key string) (string, error) {
+	name, err := s.objectName(key)
+	if err != nil {
+		return "", err
+	}
+	if !s.presign {
+		return proxiedMediaURL(key), nil
+	}
+	presigned, err := s.client.PresignedGetObject(ctx, s.bucket, name, s.expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign %s: %v", name, err)
+	}
+	return presigned.String(), nil
+}
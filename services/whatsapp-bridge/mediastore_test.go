@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-memory, path-style S3 endpoint with just enough of the API for S3MediaStore
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]bool
+	objects map[string]fakeS3Object // "bucket/name"
+}
+
+type fakeS3Object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{buckets: map[string]bool{}, objects: map[string]fakeS3Object{}}
+}
+
+// Decode an aws-chunked body ("<hex size>;chunk-signature=...\r\n<data>\r\n" ... "0;...\r\n\r\n")
+func decodeAWSChunked(body io.Reader) ([]byte, error) {
+	reader := bufio.NewReader(body)
+	var data bytes.Buffer
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad chunk header %q", header)
+		}
+		if size == 0 {
+			return data.Bytes(), nil
+		}
+		if _, err := io.CopyN(&data, reader, size); err != nil {
+			return nil, err
+		}
+		if _, err := reader.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	notFound := func(code string) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		if r.Method != http.MethodHead {
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>not found</Message></Error>`, code)
+		}
+	}
+
+	if name == "" {
+		switch r.Method {
+		case http.MethodHead:
+			if !f.buckets[bucket] {
+				notFound("NoSuchBucket")
+			}
+		case http.MethodPut:
+			f.buckets[bucket] = true
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+		return
+	}
+	if !f.buckets[bucket] {
+		notFound("NoSuchBucket")
+		return
+	}
+
+	key := bucket + "/" + name
+	switch r.Method {
+	case http.MethodPut:
+		var data []byte
+		var err error
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			data, err = decodeAWSChunked(r.Body)
+		} else {
+			data, err = io.ReadAll(r.Body)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = fakeS3Object{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC()}
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodHead, http.MethodGet:
+		object, ok := f.objects[key]
+		if !ok {
+			notFound("NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("Last-Modified", object.modTime.Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		if r.Method == http.MethodGet {
+			w.Write(object.data)
+		}
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestS3MediaStore(t *testing.T) {
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	endpoint := strings.TrimPrefix(server.URL, "http://")
+
+	store, err := NewS3MediaStore(endpoint, "media", "access", "secret", "us-east-1", "/bridge/", false, false, 0)
+	if err != nil {
+		t.Fatalf("NewS3MediaStore: %v", err)
+	}
+	if !fake.buckets["media"] {
+		t.Fatalf("bucket was not created")
+	}
+	ctx := context.Background()
+	key := "ab/cd/abcd.jpg"
+
+	if exists, err := store.Exists(ctx, key); err != nil || exists {
+		t.Fatalf("Exists before Put = %v, %v; want false, nil", exists, err)
+	}
+	if err := store.Put(ctx, key, []byte("jpeg bytes"), "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, ok := fake.objects["media/bridge/"+key]; !ok {
+		t.Fatalf("object not stored under the prefix: %v", fake.objects)
+	}
+	if exists, err := store.Exists(ctx, key); err != nil || !exists {
+		t.Fatalf("Exists after Put = %v, %v; want true, nil", exists, err)
+	}
+
+	object, info, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, err := io.ReadAll(object)
+	object.Close()
+	if err != nil || string(data) != "jpeg bytes" {
+		t.Fatalf("Get read %q, %v", data, err)
+	}
+	if info.Size != int64(len("jpeg bytes")) || info.ContentType != "image/jpeg" {
+		t.Errorf("Get info = %+v", info)
+	}
+
+	if url, err := store.URL(ctx, key); err != nil || url != proxiedMediaURL(key) {
+		t.Errorf("URL without presign = %q, %v; want %q", url, err, proxiedMediaURL(key))
+	}
+	store.presign = true
+	url, err := store.URL(ctx, key)
+	if err != nil || !strings.Contains(url, "/media/bridge/"+key) || !strings.Contains(url, "X-Amz-Signature=") {
+		t.Errorf("presigned URL = %q, %v", url, err)
+	}
+
+	if err := store.Put(ctx, "../escape.jpg", nil, ""); err == nil {
+		t.Errorf("Put accepted a key outside the store")
+	}
+}
+
+func TestLocalMediaStoreConcurrentPut(t *testing.T) {
+	store, err := NewLocalMediaStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := "ab/cd/abcd.jpg"
+	data := bytes.Repeat([]byte("x"), 1<<20)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.Put(ctx, key, data, "image/jpeg"); err != nil {
+				t.Errorf("Put: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stored, err := os.ReadFile(filepath.Join(store.root, filepath.FromSlash(key)))
+	if err != nil || !bytes.Equal(stored, data) {
+		t.Fatalf("stored file has %d bytes (%v), want %d", len(stored), err, len(data))
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(store.root, "ab", "cd", "*.tmp"))
+	if len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestValidMediaKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"ab/cd/abcd.jpg", true},
+		{"abcd.jpg", true},
+		{"ab/cd/..abcd.jpg", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"../escape.jpg", false},
+		{"..", false},
+		{".", false},
+		{"ab/../../escape.jpg", false},
+		{"ab/./cd.jpg", false},
+		{"ab//cd.jpg", false},
+		{"ab/cd/", false},
+		{`ab\cd.jpg`, false},
+	}
+	for _, tt := range tests {
+		if got := validMediaKey(tt.key); got != tt.want {
+			t.Errorf("validMediaKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+
+	key := mediaKeyFor("abcdef0123", "Photo.JPG")
+	if key != "ab/cd/abcdef0123.jpg" || !validMediaKey(key) {
+		t.Errorf("mediaKeyFor = %q, want a valid ab/cd/abcdef0123.jpg", key)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// Create or update QA photo review record in Neon database
+func createQAPhotoReview(dropNumber, projectName, userName string, reviewDate time.Time) error {
+	db, err := sql.Open("postgres", NEON_DB_URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Neon database: %v", err)
+	}
+	defer db.Close()
+
+	// Check if QA review already exists for this drop and date
+	var existingID string
+	err = db.QueryRow("SELECT id FROM qa_photo_reviews WHERE drop_number = $1 AND review_date = $2", 
+		dropNumber, reviewDate.Format("2006-01-02")).Scan(&existingID)
+	
+	if err == nil {
+		// Record exists - this is a resubmission, update it
+		fmt.Printf("🔄 Drop %s already has QA review for %s - updating as resubmission\n", 
+			dropNumber, reviewDate.Format("2006-01-02"))
+		
+		// Reset completion status and add resubmission note
+		_, updateErr := db.Exec(`
+			UPDATE qa_photo_reviews 
+			SET 
+				incomplete = FALSE,
+				feedback_sent = NULL,
+				comment = COALESCE(comment, '') || $1,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2
+		`, fmt.Sprintf("\n--- RESUBMITTED %s ---\nPhotos updated by %s. QA can continue review.\n", 
+			time.Now().Format("2006-01-02 15:04:05"), userName), existingID)
+		
+		if updateErr != nil {
+			return fmt.Errorf("failed to update QA photo review for resubmission: %v", updateErr)
+		}
+		
+		fmt.Printf("✅ Updated QA photo review for resubmission: %s\n", dropNumber)
+		return nil
+	}
+	
+	// Record doesn't exist - create new one
+	if err == sql.ErrNoRows {
+		_, err = db.Exec(`
+			INSERT INTO qa_photo_reviews (
+				drop_number, review_date, user_name, project,
+				step_01_property_frontage, step_02_location_before_install,
+				step_03_outside_cable_span, step_04_home_entry_outside,
+				step_05_home_entry_inside, step_06_fibre_entry_to_ont,
+				step_07_patched_labelled_drop, step_08_work_area_completion,
+				step_09_ont_barcode_scan, step_10_ups_serial_number,
+				step_11_powermeter_reading, step_12_powermeter_at_ont,
+				step_13_active_broadband_light, step_14_customer_signature,
+				outstanding_photos_loaded_to_1map, comment
+			) VALUES (
+				$1, $2, $3, $4,
+				FALSE, FALSE, FALSE, FALSE, FALSE, FALSE, FALSE, FALSE,
+				FALSE, FALSE, FALSE, FALSE, FALSE, FALSE, FALSE,
+				$5
+			)
+		`, dropNumber, reviewDate.Format("2006-01-02"), userName, projectName,
+			fmt.Sprintf("Auto-created from WhatsApp on %s", time.Now().Format("2006-01-02 15:04:05")))
+
+		if err != nil {
+			return fmt.Errorf("failed to create QA photo review: %v", err)
+		}
+
+		fmt.Printf("✅ Created QA photo review for %s (user: %s, project: %s)\n", dropNumber, userName, projectName)
+		return nil
+	}
+	
+	// Some other database error
+	return fmt.Errorf("failed to check existing QA review: %v", err)
+}
+
+// Mark a step complete on a drop's latest Neon QA review and record what evidenced it
+func updateQAReviewStep(dropNumber string, step QAStep, detail string) error {
+	db, err := sql.Open("postgres", NEON_DB_URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Neon database: %v", err)
+	}
+	defer db.Close()
+
+	result, err := db.Exec(fmt.Sprintf(`
+		UPDATE qa_photo_reviews
+		SET
+			%s = TRUE,
+			comment = COALESCE(comment, '') || $1,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM qa_photo_reviews WHERE drop_number = $2
+			ORDER BY review_date DESC LIMIT 1
+		)
+	`, step.NeonColumn), fmt.Sprintf("\n%s: %s", step.Name, detail), dropNumber)
+	if err != nil {
+		return fmt.Errorf("failed to update QA photo review: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("no QA photo review found for %s", dropNumber)
+	}
+
+	fmt.Printf("✅ Updated QA photo review for %s: %s = TRUE\n", dropNumber, step.NeonColumn)
+	return nil
+}
+
+// Whether the Neon drop_attributes table is known to exist
+var neonDropAttributesReady atomic.Bool
+
+// Create the Neon drop_attributes table if it does not exist yet
+func migrateNeonDropAttributes(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS drop_attributes (
+			id SERIAL PRIMARY KEY,
+			drop_number VARCHAR(50) NOT NULL,
+			project VARCHAR(255),
+			field VARCHAR(100) NOT NULL,
+			value TEXT,
+			message_id VARCHAR(255),
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(drop_number, field)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create drop_attributes table: %v", err)
+	}
+	neonDropAttributesReady.Store(true)
+	return nil
+}
+
+// Run the bridge's Neon migrations once at startup
+func migrateNeon() error {
+	db, err := sql.Open("postgres", NEON_DB_URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Neon database: %v", err)
+	}
+	defer db.Close()
+	return migrateNeonDropAttributes(db)
+}
+
+// Upsert parsed submission fields into Neon's drop_attributes table
+func storeNeonDropAttributes(attributes []DropAttribute) error {
+	db, err := sql.Open("postgres", NEON_DB_URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Neon database: %v", err)
+	}
+	defer db.Close()
+
+	// Normally done at startup; retried here if Neon was unreachable then
+	if !neonDropAttributesReady.Load() {
+		if err := migrateNeonDropAttributes(db); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range attributes {
+		_, err := db.Exec(`
+			INSERT INTO drop_attributes (drop_number, project, field, value, message_id, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (drop_number, field) DO UPDATE SET
+				project = EXCLUDED.project,
+				value = EXCLUDED.value,
+				message_id = EXCLUDED.message_id,
+				updated_at = EXCLUDED.updated_at
+		`, a.DropNumber, a.ProjectName, a.Field, a.Value, a.MessageID, a.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to store %s for %s: %v", a.Field, a.DropNumber, err)
+		}
+	}
+	return nil
+}
+
+// Append a note to the comment of a drop's latest Neon QA review
+func appendQAReviewComment(dropNumber, note string) error {
+	db, err := sql.Open("postgres", NEON_DB_URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Neon database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		UPDATE qa_photo_reviews
+		SET
+			comment = COALESCE(comment, '') || $1,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM qa_photo_reviews WHERE drop_number = $2
+			ORDER BY review_date DESC LIMIT 1
+		)
+	`, "\n"+note, dropNumber)
+	if err != nil {
+		return fmt.Errorf("failed to update QA photo review: %v", err)
+	}
+	return nil
+}
+
+// Remove the Neon QA review created for a drop on a given day
+func deleteQAPhotoReview(dropNumber string, reviewDate time.Time) error {
+	db, err := sql.Open("postgres", NEON_DB_URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Neon database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("DELETE FROM qa_photo_reviews WHERE drop_number = $1 AND review_date = $2",
+		dropNumber, reviewDate.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("failed to delete QA photo review: %v", err)
+	}
+
+	fmt.Printf("✅ Removed QA photo review for %s\n", dropNumber)
+	return nil
+}
+
+// Set the incomplete flag on a drop's latest Neon QA review and note who changed it
+func setQAReviewIncomplete(dropNumber string, incomplete bool, note string) error {
+	db, err := sql.Open("postgres", NEON_DB_URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Neon database: %v", err)
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`
+		UPDATE qa_photo_reviews
+		SET
+			incomplete = $1,
+			comment = COALESCE(comment, '') || $2,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM qa_photo_reviews WHERE drop_number = $3
+			ORDER BY review_date DESC LIMIT 1
+		)
+	`, incomplete, fmt.Sprintf("\n%s (%s)", note, time.Now().Format("2006-01-02 15:04:05")), dropNumber)
+	if err != nil {
+		return fmt.Errorf("failed to update QA photo review: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("no QA photo review found for %s", dropNumber)
+	}
+
+	fmt.Printf("✅ Updated QA photo review for %s: incomplete = %v\n", dropNumber, incomplete)
+	return nil
+}
+
+// Clear feedback_sent on a drop's latest Neon QA review so the QA feedback service
+// sends it again. Reports whether the review is marked incomplete (feedback is only
+// sent for incomplete drops).
+func requestQAFeedbackResend(dropNumber string) (bool, error) {
+	db, err := sql.Open("postgres", NEON_DB_URL)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to Neon database: %v", err)
+	}
+	defer db.Close()
+
+	var incomplete sql.NullBool
+	err = db.QueryRow(`
+		UPDATE qa_photo_reviews
+		SET
+			feedback_sent = NULL,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM qa_photo_reviews WHERE drop_number = $1
+			ORDER BY review_date DESC LIMIT 1
+		)
+		RETURNING incomplete
+	`, dropNumber).Scan(&incomplete)
+	if err == sql.ErrNoRows {
+		return false, fmt.Errorf("no QA photo review found for %s", dropNumber)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update QA photo review: %v", err)
+	}
+	return incomplete.Bool, nil
+}
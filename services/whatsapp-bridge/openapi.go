@@ -0,0 +1,523 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiParam documents a query or path parameter of an operation
+type apiParam struct {
+	Name        string
+	In          string // "query" or "path"
+	Type        string // OpenAPI primitive type
+	Required    bool
+	Description string
+}
+
+// apiOperation documents one method of a route. Request and Response are sample values
+// whose Go types the schemas are generated from
+type apiOperation struct {
+	Method       string
+	Summary      string
+	Params       []apiParam
+	Request      interface{}
+	RequestType  string // content type of a non-JSON request body, e.g. text/csv
+	Response     interface{}
+	ResponseType string // content type of a non-JSON response body
+	Statuses     []int  // statuses besides 200 that also answer with Response
+	Check        string // request target the contract check sends ("" = not exercised)
+	CheckBody    string
+	CheckStatus  int // expected status of the check (default 200)
+}
+
+// apiRoute documents the operations served under one mux pattern
+type apiRoute struct {
+	Pattern    string // pattern the handler is registered under
+	Path       string // OpenAPI path template
+	Operations []apiOperation
+}
+
+// apiOneOf is a sample response that takes one of several shapes
+type apiOneOf []interface{}
+
+// Parameters shared by several routes
+var (
+	dropNumberParam = apiParam{Name: "drop_number", In: "query", Type: "string", Required: true, Description: "Drop number, e.g. DR1234567"}
+	limitParam      = apiParam{Name: "limit", In: "query", Type: "integer", Description: "Page size (default 50, max 500)"}
+	cursorParam     = apiParam{Name: "cursor", In: "query", Type: "string", Description: "next_cursor from the previous page"}
+	auditLimitParam = apiParam{Name: "limit", In: "query", Type: "integer", Description: "Number of entries (1-1000, default 100)"}
+	projectParam    = apiParam{Name: "project", In: "query", Type: "string", Description: "Project name"}
+	messageParams   = []apiParam{
+		{Name: "sender", In: "query", Type: "string", Description: "Canonical sender ID"},
+		{Name: "since", In: "query", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD"},
+		{Name: "until", In: "query", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD"},
+		{Name: "media_type", In: "query", Type: "string", Description: "image, video, audio, document, or none for text"},
+		{Name: "has_drop", In: "query", Type: "boolean", Description: "Only messages that contain a drop number"},
+		cursorParam, limitParam,
+	}
+)
+
+// The documented REST API. Every pattern registered in registerRESTRoutes must appear here
+// and vice versa; TestAPIContract enforces it
+var apiRoutes = []apiRoute{
+	{Pattern: "/api/send", Path: "/api/send", Operations: []apiOperation{{
+		Method: http.MethodPost, Summary: "Send a text or media message",
+		Request: SendMessageRequest{}, Response: SendMessageResponse{},
+		Check: "/api/send", CheckBody: "{}", CheckStatus: http.StatusBadRequest,
+	}}},
+	{Pattern: "/api/download", Path: "/api/download", Operations: []apiOperation{{
+		Method: http.MethodPost, Summary: "Download a message's media into the media store",
+		Request: DownloadMediaRequest{}, Response: DownloadMediaResponse{},
+		Check: "/api/download", CheckBody: "{}", CheckStatus: http.StatusBadRequest,
+	}}},
+	{Pattern: "/api/media/", Path: "/api/media/{chat}/{message_id}", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Stream a message's decrypted media, downloading it first if needed",
+		Params: []apiParam{
+			{Name: "chat", In: "path", Type: "string", Required: true, Description: "Chat JID"},
+			{Name: "message_id", In: "path", Type: "string", Required: true},
+		},
+		ResponseType: "application/octet-stream",
+		Check:        "/api/media/x", CheckStatus: http.StatusBadRequest,
+	}}},
+	{Pattern: "/api/photos/metadata", Path: "/api/photos/metadata", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Photo EXIF metadata and QA flags",
+		Params: []apiParam{
+			{Name: "drop_number", In: "query", Type: "string", Description: "Drop number (or chat_jid and message_id)"},
+			{Name: "chat_jid", In: "query", Type: "string"},
+			{Name: "message_id", In: "query", Type: "string"},
+		},
+		Response: PhotoMetadataResponse{},
+		Check:    "/api/photos/metadata?drop_number=DR1",
+	}}},
+	{Pattern: "/api/photos/quality", Path: "/api/photos/quality", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Photo quality verdicts of a drop",
+		Params:   []apiParam{dropNumberParam},
+		Response: PhotoQualityResponse{},
+		Check:    "/api/photos/quality?drop_number=DR1",
+	}}},
+	{Pattern: "/api/reports/duplicate-photos", Path: "/api/reports/duplicate-photos", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Reused-photo fraud report",
+		Params: []apiParam{
+			projectParam,
+			{Name: "drop_number", In: "query", Type: "string"},
+			{Name: "since", In: "query", Type: "string", Description: "YYYY-MM-DD"},
+		},
+		Response: DuplicatePhotosResponse{},
+		Check:    "/api/reports/duplicate-photos",
+	}}},
+	{Pattern: "/api/files/", Path: "/api/files/{key}", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Fetch a stored media file by key (proxied media URLs)",
+		Params: []apiParam{
+			{Name: "key", In: "path", Type: "string", Required: true, Description: "Media store key; may contain slashes"},
+		},
+		ResponseType: "application/octet-stream",
+		Check:        "/api/files/", CheckStatus: http.StatusBadRequest,
+	}}},
+	{Pattern: "/api/drops/media", Path: "/api/drops/media", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Archived media index of a drop",
+		Params:   []apiParam{dropNumberParam},
+		Response: DropMediaResponse{},
+		Check:    "/api/drops/media?drop_number=DR1",
+	}}},
+	{Pattern: "/api/drops/serials", Path: "/api/drops/serials", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Serial numbers decoded from a drop's label photos",
+		Params:   []apiParam{dropNumberParam},
+		Response: DropSerialsResponse{},
+		Check:    "/api/drops/serials?drop_number=DR1",
+	}}},
+	{Pattern: "/api/drops/readings", Path: "/api/drops/readings", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Power meter readings typed for a drop",
+		Params:   []apiParam{dropNumberParam},
+		Response: DropReadingsResponse{},
+		Check:    "/api/drops/readings?drop_number=DR1",
+	}}},
+	{Pattern: "/api/drops/attributes", Path: "/api/drops/attributes", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Structured fields parsed from a drop's submission block",
+		Params:   []apiParam{dropNumberParam},
+		Response: DropAttributesResponse{},
+		Check:    "/api/drops/attributes?drop_number=DR1",
+	}}},
+	{Pattern: "/api/drops/locations", Path: "/api/drops/locations", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Locations shared for a drop, with its expected coordinates",
+		Params:   []apiParam{dropNumberParam},
+		Response: DropLocationsResponse{},
+		Check:    "/api/drops/locations?drop_number=DR1",
+	}}},
+	{Pattern: "/api/drops/expected-locations", Path: "/api/drops/expected-locations", Operations: []apiOperation{{
+		Method: http.MethodPost, Summary: "Import expected drop coordinates",
+		RequestType: "text/csv",
+		Response:    CSVImportResponse{},
+	}}},
+	{Pattern: "/api/messages/history", Path: "/api/messages/history", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "A message's edit and deletion history",
+		Params: []apiParam{
+			{Name: "chat_jid", In: "query", Type: "string", Required: true},
+			{Name: "message_id", In: "query", Type: "string", Required: true},
+		},
+		Response: MessageHistoryResponse{},
+		Check:    "/api/messages/history?chat_jid=x&message_id=y",
+	}}},
+	{Pattern: "/api/drops/audit", Path: "/api/drops/audit", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "A drop's QA state and audit trail",
+		Params:   []apiParam{dropNumberParam},
+		Response: DropAuditResponse{},
+		Check:    "/api/drops/audit?drop_number=DR1",
+	}}},
+	{Pattern: "/api/audit", Path: "/api/audit", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Most recent audit entries",
+		Params: []apiParam{
+			{Name: "source", In: "query", Type: "string", Description: "e.g. admin_dm, reaction, group"},
+			auditLimitParam,
+		},
+		Response: AuditLogResponse{},
+		Check:    "/api/audit",
+	}}},
+	{Pattern: "/api/contractors", Path: "/api/contractors", Operations: []apiOperation{
+		{
+			Method: http.MethodGet, Summary: "List the contractor directory, or resolve one sender's name",
+			Params: []apiParam{
+				projectParam,
+				{Name: "sender", In: "query", Type: "string", Description: "Resolve this sender instead of listing"},
+			},
+			Response: apiOneOf{ContractorsResponse{}, ContractorLookupResponse{}},
+			Check:    "/api/contractors",
+		},
+		{
+			Method: http.MethodPost, Summary: "Add or update a contractor",
+			Request: Contractor{}, Response: Contractor{},
+			Check: "/api/contractors", CheckBody: "{}", CheckStatus: http.StatusBadRequest,
+		},
+		{
+			Method: http.MethodDelete, Summary: "Remove a contractor",
+			Params:   []apiParam{{Name: "id", In: "query", Type: "string", Required: true}},
+			Response: ContractorDeletedResponse{},
+			Check:    "/api/contractors?id=27000000000", CheckStatus: http.StatusNotFound,
+		},
+	}},
+	{Pattern: "/api/chats", Path: "/api/chats", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "List stored chats",
+		Params:   []apiParam{projectParam, cursorParam, limitParam},
+		Response: ChatsResponse{},
+		Check:    "/api/chats",
+	}}},
+	{Pattern: "/api/chats/", Path: "/api/chats/{jid}/messages", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "A chat's messages",
+		Params: append([]apiParam{
+			{Name: "jid", In: "path", Type: "string", Required: true, Description: "Chat JID"},
+		}, messageParams...),
+		Response: MessagesResponse{},
+		Check:    "/api/chats/x/messages",
+	}}},
+	{Pattern: "/api/messages", Path: "/api/messages", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Messages across all chats",
+		Params:   append([]apiParam{projectParam}, messageParams...),
+		Response: MessagesResponse{},
+		Check:    "/api/messages?has_drop=true",
+	}}},
+	{Pattern: "/api/search", Path: "/api/search", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Full-text search over stored messages",
+		Params: append([]apiParam{
+			{Name: "q", In: "query", Type: "string", Required: true, Description: "Search terms"},
+			projectParam,
+		}, messageParams...),
+		Response: SearchResponse{},
+		Check:    "/api/search?q=splitter",
+	}}},
+	{Pattern: "/api/groups", Path: "/api/groups", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Every joined group with its project binding",
+		Response: GroupsResponse{},
+	}}},
+	{Pattern: "/api/groups/bind", Path: "/api/groups/bind", Operations: []apiOperation{{
+		Method: http.MethodPost, Summary: "Bind a group to a project, or create a project from it",
+		Request: GroupBindRequest{}, Response: ProjectBinding{},
+		Check: "/api/groups/bind", CheckBody: "{}", CheckStatus: http.StatusBadRequest,
+	}}},
+	{Pattern: "/api/groups/roster", Path: "/api/groups/roster", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "A tracked group's members with join dates and contractor records",
+		Params: []apiParam{
+			{Name: "project", In: "query", Type: "string", Description: "Project name (or chat_jid)"},
+			{Name: "chat_jid", In: "query", Type: "string"},
+			{Name: "include_left", In: "query", Type: "boolean"},
+		},
+		Response: GroupRosterResponse{},
+		Check:    "/api/groups/roster?chat_jid=x",
+	}}},
+	{Pattern: "/api/contractors/import", Path: "/api/contractors/import", Operations: []apiOperation{{
+		Method: http.MethodPost, Summary: "Import the contractor directory from CSV",
+		RequestType: "text/csv",
+		Response:    CSVImportResponse{},
+	}}},
+	{Pattern: "/api/serials", Path: "/api/serials", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Drops a serial number was installed on",
+		Params:   []apiParam{{Name: "serial", In: "query", Type: "string", Required: true}},
+		Response: SerialLookupResponse{},
+		Check:    "/api/serials?serial=X", CheckStatus: http.StatusNotFound,
+	}}},
+	{Pattern: "/api/access-log", Path: "/api/access-log", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Recent authenticated API calls (admin scope)",
+		Params: []apiParam{
+			{Name: "key_id", In: "query", Type: "string"},
+			auditLimitParam,
+		},
+		Response: AccessLogResponse{},
+		Check:    "/api/access-log",
+	}}},
+	{Pattern: "/health", Path: "/health", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Liveness: the process is up",
+		Response: HealthResponse{},
+		Check:    "/health",
+	}}},
+	{Pattern: "/ready", Path: "/ready", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "Readiness with per-component status and last-success times",
+		Response: ReadinessReport{},
+		Statuses: []int{http.StatusServiceUnavailable},
+		Check:    "/ready", CheckStatus: http.StatusServiceUnavailable,
+	}}},
+	{Pattern: "/api/openapi.json", Path: "/api/openapi.json", Operations: []apiOperation{{
+		Method: http.MethodGet, Summary: "This OpenAPI description",
+		Response: map[string]interface{}{},
+		Check:    "/api/openapi.json",
+	}}},
+}
+
+// openAPIGenerator turns Go types into OpenAPI schemas, collecting named structs as components
+type openAPIGenerator struct {
+	schemas map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Schema for a sample value (see apiOperation)
+func (g *openAPIGenerator) sampleSchema(sample interface{}) map[string]interface{} {
+	switch sample := sample.(type) {
+	case nil:
+		return map[string]interface{}{}
+	case apiOneOf:
+		var shapes []interface{}
+		for _, shape := range sample {
+			shapes = append(shapes, g.sampleSchema(shape))
+		}
+		return map[string]interface{}{"oneOf": shapes}
+	case map[string]interface{}:
+		return map[string]interface{}{"type": "object"}
+	}
+	return g.typeSchema(reflect.TypeOf(sample))
+}
+
+// Schema for a Go type, following encoding/json's rules
+func (g *openAPIGenerator) typeSchema(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.typeSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = map[string]interface{}{} // placeholder while recursing
+			g.schemas[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+func (g *openAPIGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	g.addFields(t, properties, &required)
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// Add a struct's JSON fields, flattening embedded structs as encoding/json does
+func (g *openAPIGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				g.addFields(fieldType, properties, required)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.typeSchema(fieldType)
+		if !strings.Contains(","+options+",", ",omitempty,") && fieldType.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// Operation ID from method and path, e.g. GET /api/drops/media -> getDropsMedia
+func apiOperationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(strings.TrimPrefix(path, "/api/"), func(r rune) bool {
+		return r == '/' || r == '-' || r == '_' || r == '.' || r == '{' || r == '}'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+func (g *openAPIGenerator) operation(route apiRoute, op apiOperation) map[string]interface{} {
+	operation := map[string]interface{}{
+		"operationId": apiOperationID(op.Method, route.Path),
+		"summary":     op.Summary,
+	}
+	if strings.HasPrefix(route.Path, "/api/") {
+		scope := requiredAPIScope(&http.Request{Method: op.Method, URL: &url.URL{Path: route.Path}})
+		operation["description"] = fmt.Sprintf("Requires an API key with the %s scope.", scope)
+		operation["x-required-scope"] = scope
+	} else {
+		operation["description"] = "No API key required."
+		operation["security"] = []interface{}{}
+	}
+
+	var parameters []interface{}
+	for _, param := range op.Params {
+		parameter := map[string]interface{}{
+			"name":     param.Name,
+			"in":       param.In,
+			"required": param.Required || param.In == "path",
+			"schema":   map[string]interface{}{"type": param.Type},
+		}
+		if param.Description != "" {
+			parameter["description"] = param.Description
+		}
+		parameters = append(parameters, parameter)
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	switch {
+	case op.RequestType != "":
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{op.RequestType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}},
+		}
+	case op.Request != nil:
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": g.sampleSchema(op.Request)}},
+		}
+	}
+
+	var content map[string]interface{}
+	if op.ResponseType != "" {
+		content = map[string]interface{}{op.ResponseType: map[string]interface{}{
+			"schema": map[string]interface{}{"type": "string", "format": "binary"},
+		}}
+	} else {
+		content = map[string]interface{}{"application/json": map[string]interface{}{"schema": g.sampleSchema(op.Response)}}
+	}
+	responses := map[string]interface{}{
+		"200":     map[string]interface{}{"description": "OK", "content": content},
+		"default": map[string]interface{}{"$ref": "#/components/responses/Error"},
+	}
+	for _, status := range op.Statuses {
+		responses[strconv.Itoa(status)] = map[string]interface{}{"description": http.StatusText(status), "content": content}
+	}
+	operation["responses"] = responses
+	return operation
+}
+
+// Build the OpenAPI 3 description of the REST API from apiRoutes and the handler types
+func buildOpenAPISpec() map[string]interface{} {
+	g := &openAPIGenerator{schemas: map[string]interface{}{}}
+
+	paths := map[string]interface{}{}
+	for _, route := range apiRoutes {
+		item := map[string]interface{}{}
+		for _, op := range route.Operations {
+			item[strings.ToLower(op.Method)] = g.operation(route, op)
+		}
+		paths[route.Path] = item
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "WhatsApp Bridge REST API",
+			"version":     "1.0.0",
+			"description": "Errors always use the Error envelope; quote its request_id (also sent as X-Request-ID) when reporting a problem.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "Error",
+					"headers": map[string]interface{}{
+						REQUEST_ID_HEADER: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+					},
+					"content": map[string]interface{}{"application/json": map[string]interface{}{
+						"schema": g.typeSchema(reflect.TypeOf(APIErrorResponse{})),
+					}},
+				},
+			},
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth":   map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"apiKeyHeader": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearerAuth": []string{}},
+			map[string]interface{}{"apiKeyHeader": []string{}},
+		},
+	}
+}
+
+// Handle the "openapi" command line: print the spec
+func runOpenAPICommand(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: whatsapp-bridge openapi")
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(buildOpenAPISpec())
+}
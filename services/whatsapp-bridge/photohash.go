@@ -0,0 +1,295 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"image"
+	"image/color"
+	"math/bits"
+	"slices"
+	"time"
+)
+
+// Duplicate photo detection configuration (overridable through the environment)
+var (
+	PHOTO_DUPLICATE_MAX_DISTANCE = getEnvInt("PHOTO_DUPLICATE_MAX_DISTANCE", 6)  // max differing dHash bits
+	PHOTO_DUPLICATE_WINDOW_DAYS  = getEnvInt("PHOTO_DUPLICATE_WINDOW_DAYS", 90) // how far back near matches are searched
+)
+
+// Below this luminance spread (0-255) across the 9x8 cells an image is too flat to fingerprint
+const dHashMinContrast = 10
+
+// Hashes with fewer set (or unset) bits than this carry too little structure for near matching
+const dHashMinBits = 8
+
+// Compute a 64-bit difference hash (dHash) of an image. Visually similar images
+// (re-compressed, resized, slightly cropped) end up a few bits apart. Flat images
+// (blank, dark, out of focus) hash to 0.
+func photoDHash(img image.Image) uint64 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return 0
+	}
+
+	// Shrink to 9x8 grayscale by averaging each cell (sampling large photos sparsely)
+	var cells [8][9]float64
+	for cy := 0; cy < 8; cy++ {
+		y0, y1 := bounds.Min.Y+cy*height/8, bounds.Min.Y+(cy+1)*height/8
+		for cx := 0; cx < 9; cx++ {
+			x0, x1 := bounds.Min.X+cx*width/9, bounds.Min.X+(cx+1)*width/9
+			stepX, stepY := max(1, (x1-x0)/16), max(1, (y1-y0)/16)
+
+			var sum float64
+			var count int
+			for y := y0; y < max(y1, y0+1); y += stepY {
+				for x := x0; x < max(x1, x0+1); x += stepX {
+					sum += pixelLuminance(img.At(x, y))
+					count++
+				}
+			}
+			cells[cy][cx] = sum / float64(count)
+		}
+	}
+
+	// On a flat image the bits would only encode sensor noise
+	var luminances []float64
+	for cy := range cells {
+		luminances = append(luminances, cells[cy][:]...)
+	}
+	if slices.Max(luminances)-slices.Min(luminances) < dHashMinContrast {
+		return 0
+	}
+
+	// One bit per horizontally adjacent pair: is the left cell brighter?
+	var hash uint64
+	for cy := 0; cy < 8; cy++ {
+		for cx := 0; cx < 8; cx++ {
+			hash <<= 1
+			if cells[cy][cx] > cells[cy][cx+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Whether a dHash has enough structure to be compared by distance. Flat images hash to 0 and
+// smooth gradients to nearly all 0s or 1s; such photos would "match" every other one like them.
+func informativeDHash(hash uint64) bool {
+	set := bits.OnesCount64(hash)
+	return set >= dHashMinBits && set <= 64-dHashMinBits
+}
+
+// Luminance of a pixel in the 0-255 range
+func pixelLuminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+}
+
+// PhotoDuplicate is a photo in one drop that matches a photo in another drop
+type PhotoDuplicate struct {
+	DropNumber       string    `json:"drop_number"`
+	ProjectName      string    `json:"project_name"`
+	MessageID        string    `json:"message_id"`
+	ChatJID          string    `json:"chat_jid"`
+	Sender           string    `json:"sender"`
+	FileSHA256       string    `json:"file_sha256"`
+	PostedAt         time.Time `json:"posted_at"`
+	MatchDropNumber  string    `json:"match_drop_number"`
+	MatchProjectName string    `json:"match_project_name"`
+	MatchMessageID   string    `json:"match_message_id"`
+	MatchChatJID     string    `json:"match_chat_jid"`
+	MatchSender      string    `json:"match_sender"`
+	MatchFileSHA256  string    `json:"match_file_sha256"`
+	MatchPostedAt    time.Time `json:"match_posted_at"`
+	MatchType        string    `json:"match_type"` // "exact" (same file) or "near" (perceptual hash)
+	Distance         int       `json:"distance"`
+	DetectedAt       time.Time `json:"detected_at"`
+}
+
+// Look for the same or a near-identical photo on other drops and flag both sides
+func detectDuplicatePhotos(messageStore *MessageStore, job MediaArchiveJob, shaHex string, img image.Image) {
+	hash := photoDHash(img)
+	if err := messageStore.StorePhotoHash(shaHex, hash); err != nil {
+		fmt.Printf("⚠️  Failed to store perceptual hash for %s: %v\n", job.MessageID, err)
+	}
+
+	if job.DropNumber == "" {
+		return
+	}
+
+	maxDistance := PHOTO_DUPLICATE_MAX_DISTANCE
+	if !informativeDHash(hash) {
+		maxDistance = -1 // exact matches only
+	}
+	matches, err := messageStore.FindDuplicatePhotos(job, shaHex, hash, maxDistance)
+	if err != nil {
+		fmt.Printf("⚠️  Duplicate photo lookup failed for %s: %v\n", job.MessageID, err)
+		return
+	}
+
+	for _, match := range matches {
+		isNew, err := messageStore.StorePhotoDuplicate(match)
+		if err != nil {
+			fmt.Printf("⚠️  Failed to record duplicate photo for %s: %v\n", job.DropNumber, err)
+			continue
+		}
+		if !isNew {
+			continue
+		}
+
+		fmt.Printf("🚨 Reused photo: %s (%s) matches %s (%s) [%s, distance %d]\n",
+			match.DropNumber, match.Sender, match.MatchDropNumber, match.MatchSender, match.MatchType, match.Distance)
+
+		kind := "same file"
+		if match.MatchType == "near" {
+			kind = "near-identical"
+		}
+		note := fmt.Sprintf("Photo %s: %s as photo in %s (posted by %s on %s)",
+			photoRef(match.MessageID), kind, match.MatchDropNumber, match.MatchSender, match.MatchPostedAt.Format("2006-01-02"))
+		if err := appendSheetsQANote(match.DropNumber, match.ProjectName, note); err != nil {
+			fmt.Printf("⚠️  Failed to add QA note for %s: %v\n", match.DropNumber, err)
+		}
+		matchNote := fmt.Sprintf("Photo %s: %s as photo in %s (posted by %s on %s)",
+			photoRef(match.MatchMessageID), kind, match.DropNumber, match.Sender, match.PostedAt.Format("2006-01-02"))
+		if err := appendSheetsQANote(match.MatchDropNumber, match.MatchProjectName, matchNote); err != nil {
+			fmt.Printf("⚠️  Failed to add QA note for %s: %v\n", match.MatchDropNumber, err)
+		}
+	}
+}
+
+// Store the perceptual hash of an archived photo
+func (store *MessageStore) StorePhotoHash(shaHex string, hash uint64) error {
+	_, err := store.db.Exec(
+		"INSERT OR REPLACE INTO photo_hashes (file_sha256, dhash, computed_at) VALUES (?, ?, ?)",
+		shaHex, int64(hash), time.Now(),
+	)
+	return err
+}
+
+// Find photos on other drops that are the same file (anywhere) or within maxDistance dHash bits
+// (same project, last PHOTO_DUPLICATE_WINDOW_DAYS). A negative maxDistance finds exact matches only.
+func (store *MessageStore) FindDuplicatePhotos(job MediaArchiveJob, shaHex string, hash uint64, maxDistance int) ([]PhotoDuplicate, error) {
+	query := `
+		SELECT d.drop_number, d.project_name, d.message_id, d.chat_jid, d.sender, d.file_sha256, d.timestamp, h.dhash
+		FROM drop_media d
+		LEFT JOIN photo_hashes h ON h.file_sha256 = d.file_sha256
+		WHERE d.drop_number != ? AND d.file_sha256 = ?`
+	args := []interface{}{job.DropNumber, shaHex}
+	if maxDistance >= 0 {
+		since := job.Timestamp.Add(-time.Duration(PHOTO_DUPLICATE_WINDOW_DAYS) * 24 * time.Hour)
+		query += `
+		UNION ALL
+		SELECT d.drop_number, d.project_name, d.message_id, d.chat_jid, d.sender, d.file_sha256, d.timestamp, h.dhash
+		FROM drop_media d
+		JOIN photo_hashes h ON h.file_sha256 = d.file_sha256
+		WHERE d.drop_number != ? AND d.file_sha256 != ? AND d.project_name = ? AND d.timestamp >= ?`
+		args = append(args, job.DropNumber, shaHex, job.ProjectName, since.In(time.Local))
+	}
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []PhotoDuplicate
+	now := time.Now()
+	for rows.Next() {
+		match := PhotoDuplicate{
+			DropNumber:  job.DropNumber,
+			ProjectName: job.ProjectName,
+			MessageID:   job.MessageID,
+			ChatJID:     job.ChatJID,
+			Sender:      job.Sender,
+			FileSHA256:  shaHex,
+			PostedAt:    job.Timestamp,
+			DetectedAt:  now,
+		}
+		var otherHash sql.NullInt64
+		if err := rows.Scan(&match.MatchDropNumber, &match.MatchProjectName, &match.MatchMessageID, &match.MatchChatJID,
+			&match.MatchSender, &match.MatchFileSHA256, &match.MatchPostedAt, &otherHash); err != nil {
+			return nil, err
+		}
+
+		if match.MatchFileSHA256 == shaHex {
+			match.MatchType = "exact"
+		} else if otherHash.Valid && informativeDHash(uint64(otherHash.Int64)) {
+			match.Distance = bits.OnesCount64(hash ^ uint64(otherHash.Int64))
+			if match.Distance > maxDistance {
+				continue
+			}
+			match.MatchType = "near"
+		} else {
+			continue
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+// Record a duplicate photo match in both directions. Returns false if it was already known.
+func (store *MessageStore) StorePhotoDuplicate(match PhotoDuplicate) (bool, error) {
+	insert := `
+		INSERT OR IGNORE INTO photo_duplicates
+		(drop_number, project_name, message_id, chat_jid, sender, file_sha256, posted_at,
+			match_drop_number, match_project_name, match_message_id, match_chat_jid, match_sender, match_file_sha256, match_posted_at,
+			match_type, distance, detected_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := store.db.Exec(insert,
+		match.DropNumber, match.ProjectName, match.MessageID, match.ChatJID, match.Sender, match.FileSHA256, match.PostedAt,
+		match.MatchDropNumber, match.MatchProjectName, match.MatchMessageID, match.MatchChatJID, match.MatchSender, match.MatchFileSHA256, match.MatchPostedAt,
+		match.MatchType, match.Distance, match.DetectedAt)
+	if err != nil {
+		return false, err
+	}
+	inserted, _ := result.RowsAffected()
+
+	_, err = store.db.Exec(insert,
+		match.MatchDropNumber, match.MatchProjectName, match.MatchMessageID, match.MatchChatJID, match.MatchSender, match.MatchFileSHA256, match.MatchPostedAt,
+		match.DropNumber, match.ProjectName, match.MessageID, match.ChatJID, match.Sender, match.FileSHA256, match.PostedAt,
+		match.MatchType, match.Distance, match.DetectedAt)
+	return inserted > 0, err
+}
+
+// Get duplicate photo matches for the fraud report, one row per pair
+func (store *MessageStore) GetPhotoDuplicates(projectName, dropNumber string, since time.Time) ([]PhotoDuplicate, error) {
+	query := `
+		SELECT drop_number, project_name, message_id, chat_jid, sender, file_sha256, posted_at,
+			match_drop_number, match_project_name, match_message_id, match_chat_jid, match_sender, match_file_sha256, match_posted_at,
+			match_type, distance, detected_at
+		FROM photo_duplicates
+		WHERE detected_at >= ?`
+	args := []interface{}{since}
+	if dropNumber != "" {
+		// Every pair is stored both ways, so a drop filter sees all of its matches
+		query += " AND drop_number = ?"
+		args = append(args, dropNumber)
+	} else {
+		query += " AND posted_at >= match_posted_at"
+	}
+	if projectName != "" {
+		query += " AND (project_name = ? OR match_project_name = ?)"
+		args = append(args, projectName, projectName)
+	}
+	query += " ORDER BY detected_at DESC"
+
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	duplicates := []PhotoDuplicate{}
+	for rows.Next() {
+		var d PhotoDuplicate
+		if err := rows.Scan(&d.DropNumber, &d.ProjectName, &d.MessageID, &d.ChatJID, &d.Sender, &d.FileSHA256, &d.PostedAt,
+			&d.MatchDropNumber, &d.MatchProjectName, &d.MatchMessageID, &d.MatchChatJID, &d.MatchSender, &d.MatchFileSHA256, &d.MatchPostedAt,
+			&d.MatchType, &d.Distance, &d.DetectedAt); err != nil {
+			return nil, err
+		}
+		duplicates = append(duplicates, d)
+	}
+	return duplicates, nil
+}
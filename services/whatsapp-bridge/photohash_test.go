@@ -0,0 +1,147 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"testing"
+	"time"
+)
+
+// A synthetic photo: smooth blobs whose layout depends on seed, plus a brightness offset
+func testPhoto(width, height int, seed, brightness float64) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			u, v := float64(x)/float64(width), float64(y)/float64(height)
+			value := 128 + 60*math.Sin(7*u*seed+3*v) + 40*math.Sin(5*v*seed-2*u) + brightness
+			img.SetGray(x, y, color.Gray{Y: uint8(max(0, min(255, int(value))))})
+		}
+	}
+	return img
+}
+
+// A dark, nearly black photo with a little sensor noise
+func darkNoisyImage(width, height int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(8 + (i*7919)%5)
+	}
+	return img
+}
+
+func uniformImage(width, height int, gray uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = gray
+	}
+	return img
+}
+
+func TestPhotoDHash(t *testing.T) {
+	original := photoDHash(testPhoto(640, 480, 1.0, 0))
+	tests := []struct {
+		name string
+		img  image.Image
+		near bool // within PHOTO_DUPLICATE_MAX_DISTANCE of the original
+		flat bool // hashes to 0 and is not compared by distance
+	}{
+		{"same picture resized", testPhoto(320, 240, 1.0, 0), true, false},
+		{"same picture brighter", testPhoto(640, 480, 1.0, 20), true, false},
+		{"different picture", testPhoto(640, 480, 2.3, 0), false, false},
+		{"black", uniformImage(640, 480, 0), false, true},
+		{"white", uniformImage(640, 480, 255), false, true},
+		{"dark with noise", darkNoisyImage(640, 480), false, true},
+	}
+	if !informativeDHash(original) {
+		t.Fatalf("original photo hash %016x is not informative", original)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := photoDHash(tt.img)
+			if tt.flat {
+				if hash != 0 || informativeDHash(hash) {
+					t.Errorf("hash = %016x (informative %v), want 0 and not informative", hash, informativeDHash(hash))
+				}
+				return
+			}
+			distance := bits.OnesCount64(hash ^ original)
+			if near := distance <= PHOTO_DUPLICATE_MAX_DISTANCE; near != tt.near {
+				t.Errorf("distance %d to the original, near = %v, want %v", distance, near, tt.near)
+			}
+		})
+	}
+}
+
+func TestInformativeDHash(t *testing.T) {
+	tests := []struct {
+		hash uint64
+		want bool
+	}{
+		{0, false},
+		{^uint64(0), false},
+		{0x00000000000000ff >> 1, false}, // 7 bits set
+		{0x00000000000000ff, true},       // 8 bits set
+		{0xf0f0f0f0f0f0f0f0, true},
+		{^uint64(0xff), true},       // 56 bits set
+		{^uint64(0xff >> 1), false}, // 57 bits set
+	}
+	for _, tt := range tests {
+		if got := informativeDHash(tt.hash); got != tt.want {
+			t.Errorf("informativeDHash(%016x) = %v, want %v", tt.hash, got, tt.want)
+		}
+	}
+}
+
+func TestFindDuplicatePhotos(t *testing.T) {
+	messageStore := newTestMessageStore(t)
+	now := time.Now()
+	const hash = uint64(0xf0f0f0f0f0f0f0f0)
+
+	stored := []struct {
+		drop, project, sha string
+		hash               uint64
+		age                time.Duration
+	}{
+		{"DR1", "Lawley", "exact", 0, 400 * 24 * time.Hour},  // same file, long ago
+		{"DR2", "Lawley", "near", hash ^ 0b111, time.Hour},   // 3 bits off
+		{"DR3", "Lawley", "far", hash ^ 0xffff, time.Hour},   // 16 bits off
+		{"DR4", "Mohadin", "other-project", hash, time.Hour}, // near, other project
+		{"DR5", "Lawley", "old", hash, 400 * 24 * time.Hour}, // near, outside the window
+		{"DR6", "Lawley", "flat", 0, time.Hour},              // flat photo
+	}
+	for i, photo := range stored {
+		id := string(rune('a' + i))
+		if err := messageStore.StoreDropMedia(photo.drop, id, "group@g.us", photo.project, "27820000000", photo.sha, now.Add(-photo.age)); err != nil {
+			t.Fatal(err)
+		}
+		if err := messageStore.StorePhotoHash(photo.sha, photo.hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	job := MediaArchiveJob{MessageID: "new", ChatJID: "group@g.us", ProjectName: "Lawley", DropNumber: "DR9", Timestamp: now}
+	found := func(hash uint64, maxDistance int) map[string]string {
+		matches, err := messageStore.FindDuplicatePhotos(job, "exact", hash, maxDistance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byDrop := map[string]string{}
+		for _, match := range matches {
+			byDrop[match.MatchDropNumber] = match.MatchType
+		}
+		return byDrop
+	}
+
+	got := found(hash, PHOTO_DUPLICATE_MAX_DISTANCE)
+	want := map[string]string{"DR1": "exact", "DR2": "near"}
+	if len(got) != len(want) || got["DR1"] != "exact" || got["DR2"] != "near" {
+		t.Errorf("matches = %v, want %v", got, want)
+	}
+
+	// A flat photo only matches exact copies, never other flat photos
+	if got := found(0, -1); len(got) != 1 || got["DR1"] != "exact" {
+		t.Errorf("flat photo matches = %v, want only the exact copy", got)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// Photo quality configuration (overridable through the environment)
+var (
+	PHOTO_BLUR_THRESHOLD        = getEnvInt("PHOTO_BLUR_THRESHOLD", 60)  // min variance of Laplacian
+	PHOTO_DARK_THRESHOLD        = getEnvInt("PHOTO_DARK_THRESHOLD", 40)  // min mean luminance (0-255)
+	PHOTO_MIN_SHORT_SIDE        = getEnvInt("PHOTO_MIN_SHORT_SIDE", 480) // min pixels on the short side
+	PHOTO_QUALITY_AUTO_FEEDBACK = getEnvBool("PHOTO_QUALITY_AUTO_FEEDBACK", false)
+	PHOTO_FEEDBACK_DELAY_SECS   = getEnvInt("PHOTO_FEEDBACK_DELAY_SECS", 120) // batch a drop's failures into one message
+)
+
+// Reasons a photo can fail the quality checks
+const (
+	PHOTO_QUALITY_BLURRY         = "blurry"
+	PHOTO_QUALITY_TOO_DARK       = "too_dark"
+	PHOTO_QUALITY_LOW_RESOLUTION = "low_resolution"
+)
+
+// PhotoQuality is the result of the image quality checks on one photo
+type PhotoQuality struct {
+	MessageID     string    `json:"message_id"`
+	ChatJID       string    `json:"chat_jid"`
+	DropNumber    string    `json:"drop_number,omitempty"`
+	FileSHA256    string    `json:"file_sha256"`
+	Width         int       `json:"width"`
+	Height        int       `json:"height"`
+	BlurScore     float64   `json:"blur_score"`
+	MeanLuminance float64   `json:"mean_luminance"`
+	Verdict       string    `json:"verdict"` // "pass" or "fail"
+	Reasons       []string  `json:"reasons"`
+	AnalyzedAt    time.Time `json:"analyzed_at"`
+}
+
+// Downscale an image to at most maxDim pixels on its long side, as grayscale luminance
+func grayscaleSample(img image.Image, maxDim int) ([]float64, int, int) {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW == 0 || srcH == 0 {
+		return nil, 0, 0
+	}
+
+	w, h := srcW, srcH
+	if srcW > maxDim || srcH > maxDim {
+		if srcW >= srcH {
+			w, h = maxDim, max(1, srcH*maxDim/srcW)
+		} else {
+			w, h = max(1, srcW*maxDim/srcH), maxDim
+		}
+	}
+
+	pix := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		sy := bounds.Min.Y + y*srcH/h
+		for x := 0; x < w; x++ {
+			sx := bounds.Min.X + x*srcW/w
+			pix[y*w+x] = pixelLuminance(img.At(sx, sy))
+		}
+	}
+	return pix, w, h
+}
+
+// Score sharpness (variance of the Laplacian) and brightness (mean luminance).
+// Both are measured on a 512px version so scores don't depend on camera resolution.
+func photoQualityScores(img image.Image) (blurScore, meanLuminance float64) {
+	pix, w, h := grayscaleSample(img, 512)
+	if w < 3 || h < 3 {
+		return 0, 0
+	}
+
+	var lumSum float64
+	for _, v := range pix {
+		lumSum += v
+	}
+	meanLuminance = lumSum / float64(len(pix))
+
+	var sum, sumSq float64
+	n := 0
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			laplacian := pix[i-w] + pix[i+w] + pix[i-1] + pix[i+1] - 4*pix[i]
+			sum += laplacian
+			sumSq += laplacian * laplacian
+			n++
+		}
+	}
+	mean := sum / float64(n)
+	blurScore = sumSq/float64(n) - mean*mean
+	return blurScore, meanLuminance
+}
+
+// Run the blur, darkness and resolution checks on a photo
+func checkPhotoQuality(img image.Image) (width, height int, blurScore, meanLuminance float64, reasons []string) {
+	bounds := img.Bounds()
+	width, height = bounds.Dx(), bounds.Dy()
+	blurScore, meanLuminance = photoQualityScores(img)
+
+	reasons = []string{}
+	if blurScore < float64(PHOTO_BLUR_THRESHOLD) {
+		reasons = append(reasons, PHOTO_QUALITY_BLURRY)
+	}
+	if meanLuminance < float64(PHOTO_DARK_THRESHOLD) {
+		reasons = append(reasons, PHOTO_QUALITY_TOO_DARK)
+	}
+	if min(width, height) < PHOTO_MIN_SHORT_SIDE {
+		reasons = append(reasons, PHOTO_QUALITY_LOW_RESOLUTION)
+	}
+	return width, height, blurScore, meanLuminance, reasons
+}
+
+// Describe failed quality checks for QA notes and contractor feedback
+func describePhotoQuality(reasons []string) string {
+	descriptions := map[string]string{
+		PHOTO_QUALITY_BLURRY:         "blurry",
+		PHOTO_QUALITY_TOO_DARK:       "too dark",
+		PHOTO_QUALITY_LOW_RESOLUTION: "low resolution",
+	}
+	var parts []string
+	for _, reason := range reasons {
+		parts = append(parts, descriptions[reason])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Check a photo's quality, store the verdict and note failures on the drop
+func analyzePhotoQuality(client *whatsmeow.Client, messageStore *MessageStore, job MediaArchiveJob, shaHex string, img image.Image) {
+	width, height, blurScore, meanLuminance, reasons := checkPhotoQuality(img)
+
+	quality := PhotoQuality{
+		MessageID:     job.MessageID,
+		ChatJID:       job.ChatJID,
+		DropNumber:    job.DropNumber,
+		FileSHA256:    shaHex,
+		Width:         width,
+		Height:        height,
+		BlurScore:     math.Round(blurScore*10) / 10,
+		MeanLuminance: math.Round(meanLuminance*10) / 10,
+		Verdict:       "pass",
+		Reasons:       reasons,
+		AnalyzedAt:    time.Now(),
+	}
+	if len(reasons) > 0 {
+		quality.Verdict = "fail"
+	}
+
+	if err := messageStore.StorePhotoQuality(quality); err != nil {
+		fmt.Printf("⚠️  Failed to store photo quality for %s: %v\n", job.MessageID, err)
+	}
+
+	if quality.Verdict == "pass" || job.DropNumber == "" {
+		return
+	}
+	fmt.Printf("📉 Photo %s for %s failed quality checks: %s (blur=%.1f, luminance=%.1f, %dx%d)\n",
+		job.MessageID, job.DropNumber, strings.Join(reasons, ", "), blurScore, meanLuminance, width, height)
+
+	note := fmt.Sprintf("Photo %s: unusable (%s)", photoRef(job.MessageID), describePhotoQuality(reasons))
+	if err := appendSheetsQANote(job.DropNumber, job.ProjectName, note); err != nil {
+		fmt.Printf("⚠️  Failed to add QA note for %s: %v\n", job.DropNumber, err)
+	}
+
+	if PHOTO_QUALITY_AUTO_FEEDBACK {
+		photoFeedback.add(client, job, reasons)
+	}
+}
+
+// photoFeedbackBatcher collects a drop's failed photos for a short while so the
+// contractor gets one message instead of one per photo
+type photoFeedbackBatcher struct {
+	mu      sync.Mutex
+	pending map[string][]string // chat/drop -> failure descriptions
+}
+
+var photoFeedback = &photoFeedbackBatcher{pending: make(map[string][]string)}
+
+func (b *photoFeedbackBatcher) add(client *whatsmeow.Client, job MediaArchiveJob, reasons []string) {
+	key := job.ChatJID + "|" + job.DropNumber
+	line := fmt.Sprintf("• %s photo: %s", job.Timestamp.Format("15:04"), describePhotoQuality(reasons))
+
+	b.mu.Lock()
+	_, scheduled := b.pending[key]
+	b.pending[key] = append(b.pending[key], line)
+	b.mu.Unlock()
+
+	if scheduled {
+		return
+	}
+	time.AfterFunc(time.Duration(PHOTO_FEEDBACK_DELAY_SECS)*time.Second, func() {
+		b.mu.Lock()
+		lines := b.pending[key]
+		delete(b.pending, key)
+		b.mu.Unlock()
+
+		message := fmt.Sprintf("📷 %s: %d photo(s) could not be used for QA:\n%s\nPlease retake and resend them.",
+			job.DropNumber, len(lines), strings.Join(lines, "\n"))
+		success, result := sendWhatsAppMessage(client, job.ChatJID, message, "")
+		if !success {
+			fmt.Printf("⚠️  Failed to send photo quality feedback for %s: %s\n", job.DropNumber, result)
+			return
+		}
+		fmt.Printf("📤 Sent photo quality feedback for %s to %s\n", job.DropNumber, job.ChatJID)
+	})
+}
+
+// Store the quality verdict of a photo
+func (store *MessageStore) StorePhotoQuality(q PhotoQuality) error {
+	_, err := store.db.Exec(`
+		INSERT OR REPLACE INTO photo_quality
+		(message_id, chat_jid, drop_number, file_sha256, width, height, blur_score, mean_luminance, verdict, reasons, analyzed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, q.MessageID, q.ChatJID, q.DropNumber, q.FileSHA256, q.Width, q.Height, q.BlurScore, q.MeanLuminance,
+		q.Verdict, strings.Join(q.Reasons, ","), q.AnalyzedAt)
+	return err
+}
+
+// Get the quality verdicts of a drop's photos
+func (store *MessageStore) GetPhotoQuality(dropNumber string) ([]PhotoQuality, error) {
+	rows, err := store.db.Query(`
+		SELECT message_id, chat_jid, drop_number, file_sha256, width, height, blur_score, mean_luminance, verdict, reasons, analyzed_at
+		FROM photo_quality WHERE drop_number = ? ORDER BY analyzed_at ASC
+	`, dropNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []PhotoQuality{}
+	for rows.Next() {
+		var q PhotoQuality
+		var reasons string
+		if err := rows.Scan(&q.MessageID, &q.ChatJID, &q.DropNumber, &q.FileSHA256, &q.Width, &q.Height,
+			&q.BlurScore, &q.MeanLuminance, &q.Verdict, &reasons, &q.AnalyzedAt); err != nil {
+			return nil, err
+		}
+		q.Reasons = []string{}
+		if reasons != "" {
+			q.Reasons = strings.Split(reasons, ",")
+		}
+		results = append(results, q)
+	}
+	return results, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Power meter configuration (overridable through the environment). Projects can
+// override the accepted range with "power_min_dbm"/"power_max_dbm" in PROJECTS.
+var (
+	POWER_MIN_DBM          = getEnvFloat("POWER_MIN_DBM", -27)
+	POWER_MAX_DBM          = getEnvFloat("POWER_MAX_DBM", -8)
+	SHEETS_READINGS_COLUMN = getEnv("SHEETS_READINGS_COLUMN", "Y") // first column after the bridge's A-X layout
+)
+
+var sheetsColumnPattern = regexp.MustCompile(`^[A-Z]{1,3}$`)
+
+// Sheet column that receives a project's readings: "readings_column" in PROJECTS, else
+// SHEETS_READINGS_COLUMN. Columns A-X belong to the bridge's row layout and are refused;
+// "" means readings are not written.
+func readingsColumn(projectName string) string {
+	column := SHEETS_READINGS_COLUMN
+	if config, ok := getProjectConfig(projectName); ok && config["readings_column"] != "" {
+		column = config["readings_column"]
+	}
+	column = strings.ToUpper(strings.TrimSpace(column))
+	if column == "" {
+		return ""
+	}
+	if !sheetsColumnPattern.MatchString(column) || (len(column) == 1 && column <= "X") {
+		fmt.Printf("⚠️  Readings column %q for %s is not a column after X; readings are not written to the sheet\n", column, projectName)
+		return ""
+	}
+	return column
+}
+
+// Where a power meter reading was taken. Readings without a position count
+// towards step 11; step 12 is specifically the reading at the ONT.
+const (
+	POWER_POSITION_FEEDER = "feeder"
+	POWER_POSITION_ONT    = "ont"
+)
+
+var powerSteps = map[string]QAStep{
+	POWER_POSITION_FEEDER: {11, "Power meter reading", "step_11_powermeter_reading"},
+	POWER_POSITION_ONT:    {12, "Power meter at ONT", "step_12_powermeter_at_ont"},
+}
+
+var (
+	powerReadingPattern = regexp.MustCompile(`(?i)(?:^|[^\d.,])([-−–+]?\s?\d{1,2}(?:[.,]\d{1,3})?)\s*dbm\b`)
+	powerONTPattern     = regexp.MustCompile(`(?i)\b(ont|cpe|router)\b`)
+	powerClauseSplitter = regexp.MustCompile(`[\n;]+|,\s+`)
+)
+
+// PowerReading is a dBm value typed by a contractor for a drop
+type PowerReading struct {
+	MessageID   string    `json:"message_id"`
+	ChatJID     string    `json:"chat_jid"`
+	DropNumber  string    `json:"drop_number"`
+	ProjectName string    `json:"project_name,omitempty"`
+	Position    string    `json:"position"`
+	DBm         float64   `json:"dbm"`
+	InRange     bool      `json:"in_range"`
+	ReadAt      time.Time `json:"read_at"`
+}
+
+// Accepted dBm range for a project's readings
+func powerThresholds(projectName string) (float64, float64) {
+	minDBm, maxDBm := POWER_MIN_DBM, POWER_MAX_DBM
+	if config, ok := getProjectConfig(projectName); ok {
+		if v, err := strconv.ParseFloat(config["power_min_dbm"], 64); err == nil {
+			minDBm = v
+		}
+		if v, err := strconv.ParseFloat(config["power_max_dbm"], 64); err == nil {
+			maxDBm = v
+		}
+	}
+	return minDBm, maxDBm
+}
+
+// Pull dBm readings out of a message, e.g. "DR123 -19.2dBm at ONT, -17.5 dBm at pole".
+// The position is taken from the clause each reading appears in. Received optical power is
+// negative, so a value typed without a sign ("19.2dBm") is read as negative; only an explicit
+// "+" gives a positive reading.
+func parsePowerReadings(content string) map[string]float64 {
+	readings := map[string]float64{}
+	for _, clause := range powerClauseSplitter.Split(content, -1) {
+		position := POWER_POSITION_FEEDER
+		if powerONTPattern.MatchString(clause) {
+			position = POWER_POSITION_ONT
+		}
+		for _, match := range powerReadingPattern.FindAllStringSubmatch(clause, -1) {
+			value := strings.NewReplacer(" ", "", "−", "-", "–", "-", ",", ".").Replace(match[1])
+			dbm, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			if !strings.HasPrefix(value, "-") && !strings.HasPrefix(value, "+") {
+				dbm = -dbm
+			}
+			readings[position] = dbm
+		}
+	}
+	return readings
+}
+
+// Record power meter readings typed into a tracked-group message, flag
+// out-of-range values and tick the matching steps for valid ones
+func recordPowerReadings(messageStore *MessageStore, messageID, chatJID, sender, content string, timestamp time.Time) {
+	projectName := getProjectNameByJID(chatJID)
+	if projectName == "" {
+		return
+	}
+
+	readings := parsePowerReadings(content)
+	if len(readings) == 0 {
+		return
+	}
+	dropNumber := messageStore.ResolveDropForMedia(chatJID, sender, content, timestamp)
+	if dropNumber == "" {
+		fmt.Printf("⚠️  Power reading(s) in message %s could not be linked to a drop\n", messageID)
+		return
+	}
+
+	minDBm, maxDBm := powerThresholds(projectName)
+	for position, dbm := range readings {
+		reading := PowerReading{
+			MessageID:   messageID,
+			ChatJID:     chatJID,
+			DropNumber:  dropNumber,
+			ProjectName: projectName,
+			Position:    position,
+			DBm:         dbm,
+			InRange:     dbm >= minDBm && dbm <= maxDBm,
+			ReadAt:      timestamp,
+		}
+		if err := messageStore.StorePowerReading(reading); err != nil {
+			fmt.Printf("⚠️  Failed to store power reading for %s: %v\n", dropNumber, err)
+			continue
+		}
+
+		step := powerSteps[position]
+		if !reading.InRange {
+			fmt.Printf("🚩 %s for %s out of range: %.2f dBm (accepted %.1f to %.1f)\n", step.Name, dropNumber, dbm, minDBm, maxDBm)
+			note := fmt.Sprintf("%s %.2f dBm out of range (%.1f to %.1f dBm)", step.Name, dbm, minDBm, maxDBm)
+			if err := appendSheetsQANote(dropNumber, projectName, note); err != nil {
+				fmt.Printf("⚠️  Failed to add QA note for %s: %v\n", dropNumber, err)
+			}
+			continue
+		}
+
+		fmt.Printf("🔦 %s for %s: %.2f dBm\n", step.Name, dropNumber, dbm)
+		if err := tickSheetsStep(dropNumber, projectName, step.Step); err != nil {
+			fmt.Printf("⚠️  Failed to tick step %d for %s: %v\n", step.Step, dropNumber, err)
+		}
+		if err := updateQAReviewStep(dropNumber, step, fmt.Sprintf("%.2f dBm", dbm)); err != nil {
+			fmt.Printf("⚠️  Failed to update Neon QA review for %s: %v\n", dropNumber, err)
+		}
+	}
+
+	if err := updateSheetsReadings(messageStore, dropNumber, projectName); err != nil {
+		fmt.Printf("⚠️  Failed to update readings column for %s: %v\n", dropNumber, err)
+	}
+}
+
+// Write a drop's latest reading per position into the project's readings column
+func updateSheetsReadings(messageStore *MessageStore, dropNumber, projectName string) error {
+	column := readingsColumn(projectName)
+	if column == "" {
+		return nil
+	}
+	readings, err := messageStore.GetPowerReadings(dropNumber)
+	if err != nil {
+		return err
+	}
+
+	latest := map[string]PowerReading{}
+	for _, reading := range readings {
+		latest[reading.Position] = reading
+	}
+	var parts []string
+	for _, position := range []string{POWER_POSITION_FEEDER, POWER_POSITION_ONT} {
+		reading, ok := latest[position]
+		if !ok {
+			continue
+		}
+		part := fmt.Sprintf("%s: %.2f dBm", powerSteps[position].Name, reading.DBm)
+		if !reading.InRange {
+			part += " (out of range)"
+		}
+		parts = append(parts, part)
+	}
+	return updateSheetsDropCell(dropNumber, projectName, column, strings.Join(parts, "; "))
+}
+
+// Store a power meter reading
+func (store *MessageStore) StorePowerReading(reading PowerReading) error {
+	_, err := store.db.Exec(`
+		INSERT OR REPLACE INTO power_readings
+		(message_id, chat_jid, drop_number, project_name, position, dbm, in_range, read_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, reading.MessageID, reading.ChatJID, reading.DropNumber, reading.ProjectName, reading.Position,
+		reading.DBm, reading.InRange, reading.ReadAt)
+	return err
+}
+
+// Get a drop's power meter readings, oldest first
+func (store *MessageStore) GetPowerReadings(dropNumber string) ([]PowerReading, error) {
+	rows, err := store.db.Query(`
+		SELECT message_id, chat_jid, drop_number, project_name, position, dbm, in_range, read_at
+		FROM power_readings WHERE drop_number = ? ORDER BY read_at ASC
+	`, dropNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := []PowerReading{}
+	for rows.Next() {
+		var reading PowerReading
+		if err := rows.Scan(&reading.MessageID, &reading.ChatJID, &reading.DropNumber, &reading.ProjectName,
+			&reading.Position, &reading.DBm, &reading.InRange, &reading.ReadAt); err != nil {
+			return nil, err
+		}
+		readings = append(readings, reading)
+	}
+	return readings, nil
+}
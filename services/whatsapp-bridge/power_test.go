@@ -0,0 +1,55 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParsePowerReadings(t *testing.T) {
+	tests := []struct {
+		content string
+		want    map[string]float64
+	}{
+		{"DR123 -19.2dBm", map[string]float64{POWER_POSITION_FEEDER: -19.2}},
+		{"DR123 -19.2dBm at ONT, -17.5 dBm at pole", map[string]float64{POWER_POSITION_ONT: -19.2, POWER_POSITION_FEEDER: -17.5}},
+		{"DR123 19.2dBm", map[string]float64{POWER_POSITION_FEEDER: -19.2}},
+		{"DR123 19,2 DBM at the router", map[string]float64{POWER_POSITION_ONT: -19.2}},
+		{"DR123 − 21.05 dBm", map[string]float64{POWER_POSITION_FEEDER: -21.05}},
+		{"DR123 +2dBm", map[string]float64{POWER_POSITION_FEEDER: 2}},
+		{"-18dBm", map[string]float64{POWER_POSITION_FEEDER: -18}},
+		{"feeder -18dBm; ONT -20dBm", map[string]float64{POWER_POSITION_FEEDER: -18, POWER_POSITION_ONT: -20}},
+		{"DR123 119dBm", map[string]float64{}},
+		{"DR1234.5dBm", map[string]float64{}},
+		{"DR123 -19.2 dB", map[string]float64{}},
+		{"DR123 installed, all good", map[string]float64{}},
+	}
+	for _, tt := range tests {
+		if got := parsePowerReadings(tt.content); !maps.Equal(got, tt.want) {
+			t.Errorf("parsePowerReadings(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestReadingsColumn(t *testing.T) {
+	defaultColumn := SHEETS_READINGS_COLUMN
+	defer func() { SHEETS_READINGS_COLUMN = defaultColumn }()
+
+	tests := []struct {
+		setting string
+		want    string
+	}{
+		{"Y", "Y"},
+		{" z ", "Z"},
+		{"AB", "AB"},
+		{"", ""},
+		{"X", ""},
+		{"U", ""},
+		{"Y1", ""},
+	}
+	for _, tt := range tests {
+		SHEETS_READINGS_COLUMN = tt.setting
+		if got := readingsColumn("No Such Project"); got != tt.want {
+			t.Errorf("readingsColumn with SHEETS_READINGS_COLUMN=%q = %q, want %q", tt.setting, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// ProjectBinding ties a WhatsApp group to a project at runtime, on top of the static PROJECTS map
+type ProjectBinding struct {
+	ProjectName      string    `json:"project_name"`
+	GroupJID         string    `json:"group_jid"`
+	GroupDescription string    `json:"group_description,omitempty"`
+	SheetsTab        string    `json:"sheets_tab,omitempty"`
+	BoundBy          string    `json:"bound_by"` // "api" or "description"
+	BoundAt          time.Time `json:"bound_at"`
+}
+
+// GroupBindRequest is the request body for binding a group to a project
+type GroupBindRequest struct {
+	GroupJID    string `json:"group_jid"`
+	Project     string `json:"project"`
+	Create      bool   `json:"create"` // add the project if it does not exist yet
+	Rebind      bool   `json:"rebind"` // move the project off the group it is bound to now
+	SheetsTab   string `json:"sheets_tab"`
+	Description string `json:"description"`
+}
+
+// JoinedGroup is a group the bridge number is a member of
+type JoinedGroup struct {
+	JID           string `json:"jid"`
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	Participants  int    `json:"participants"`
+	ProjectName   string `json:"project_name,omitempty"`   // project the group is bound to
+	MarkerProject string `json:"marker_project,omitempty"` // from a "project: Name" line in the description
+}
+
+// Matches a "project: Name" line in a group description
+var projectMarkerPattern = regexp.MustCompile(`(?im)^\s*project\s*:\s*(.+?)\s*$`)
+
+// Groups and Sheets tabs bound at runtime, which are trusted like the Velo Test group
+var (
+	runtimeBoundGroups = map[string]bool{}
+	runtimeSheetsTabs  = map[string]bool{}
+)
+
+// Project named by a "project: Name" marker in a group description, if any
+func projectMarker(description string) string {
+	if match := projectMarkerPattern.FindStringSubmatch(description); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// Check whether a group was bound to a project at runtime
+func isRuntimeBoundGroup(chatJID string) bool {
+	projectsMu.RLock()
+	defer projectsMu.RUnlock()
+	return runtimeBoundGroups[chatJID]
+}
+
+// Check whether a Sheets tab was configured at runtime (new tabs use the standard A-X layout)
+func isRuntimeSheetsTab(tabName string) bool {
+	projectsMu.RLock()
+	defer projectsMu.RUnlock()
+	return runtimeSheetsTabs[tabName]
+}
+
+// Apply a binding to the in-memory project config. Caller must hold projectsMu.
+func applyProjectBinding(binding ProjectBinding) {
+	config := map[string]string{"project_name": binding.ProjectName}
+	for key, value := range PROJECTS[binding.ProjectName] {
+		config[key] = value
+	}
+	config["group_jid"] = binding.GroupJID
+	if binding.GroupDescription != "" {
+		config["group_description"] = binding.GroupDescription
+	}
+	// A project has one group: the group it was bound to before stops being tracked
+	if previous := PROJECTS[binding.ProjectName]["group_jid"]; previous != "" && previous != binding.GroupJID {
+		delete(runtimeBoundGroups, previous)
+	}
+	if previousTab := PROJECT_SHEETS_TABS[binding.ProjectName]; binding.SheetsTab != "" && previousTab != binding.SheetsTab {
+		delete(runtimeSheetsTabs, previousTab)
+	}
+
+	// Project configs are replaced rather than modified so readers can keep the old map
+	PROJECTS[binding.ProjectName] = config
+
+	if binding.SheetsTab != "" {
+		PROJECT_SHEETS_TABS[binding.ProjectName] = binding.SheetsTab
+		runtimeSheetsTabs[binding.SheetsTab] = true
+	}
+	runtimeBoundGroups[binding.GroupJID] = true
+}
+
+// Bind a group to a project, creating the project when create is set, and persist the binding.
+// A project that already has another group is only moved when rebind is set.
+func bindGroupToProject(messageStore *MessageStore, binding ProjectBinding, create, rebind bool) error {
+	projectsMu.Lock()
+	defer projectsMu.Unlock()
+
+	for projectName, config := range PROJECTS {
+		if config["group_jid"] == binding.GroupJID && projectName != binding.ProjectName {
+			return fmt.Errorf("group %s is already bound to %s", binding.GroupJID, projectName)
+		}
+	}
+	config, exists := PROJECTS[binding.ProjectName]
+	if !exists && !create {
+		return fmt.Errorf("unknown project %q", binding.ProjectName)
+	}
+	if current := config["group_jid"]; current != "" && current != binding.GroupJID && !rebind {
+		return fmt.Errorf("project %s is already bound to group %s (set rebind to move it)", binding.ProjectName, current)
+	}
+
+	if err := messageStore.SaveProjectBinding(binding); err != nil {
+		return fmt.Errorf("failed to store project binding: %v", err)
+	}
+	applyProjectBinding(binding)
+
+	if err := messageStore.RecordAudit(AuditEntry{
+		ProjectName: binding.ProjectName,
+		Action:      "project_bind",
+		Actor:       binding.BoundBy,
+		Source:      "project_binding",
+		Details:     binding.GroupJID,
+		CreatedAt:   binding.BoundAt,
+	}); err != nil {
+		fmt.Printf("⚠️  Failed to record project binding: %v\n", err)
+	}
+	fmt.Printf("🔗 Bound group %s to project %s (%s)\n", binding.GroupJID, binding.ProjectName, binding.BoundBy)
+	return nil
+}
+
+// Re-apply project bindings stored by earlier runs
+func loadProjectBindings(messageStore *MessageStore) error {
+	bindings, err := messageStore.GetProjectBindings()
+	if err != nil {
+		return err
+	}
+	projectsMu.Lock()
+	defer projectsMu.Unlock()
+	for _, binding := range bindings {
+		applyProjectBinding(binding)
+	}
+	if len(bindings) > 0 {
+		fmt.Printf("🔗 Loaded %d project binding(s)\n", len(bindings))
+	}
+	return nil
+}
+
+// List every group the bridge number has joined with its project binding
+func listJoinedGroups(client *whatsmeow.Client) ([]JoinedGroup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	infos, err := client.GetJoinedGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get joined groups: %v", err)
+	}
+
+	groups := []JoinedGroup{}
+	for _, info := range infos {
+		groups = append(groups, JoinedGroup{
+			JID:           info.JID.String(),
+			Name:          info.Name,
+			Description:   info.Topic,
+			Participants:  len(info.Participants),
+			ProjectName:   getProjectNameByJID(info.JID.String()),
+			MarkerProject: projectMarker(info.Topic),
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+// Bind a group to the existing project named in its description marker. Only markers set by
+// an admin (setBy, as LID and/or phone number) bind, and only projects without a group yet:
+// moving a project to another group takes an explicit rebind through /api/groups/bind.
+func bindMarkedGroup(messageStore *MessageStore, chatJID, description string, setBy ...types.JID) {
+	marker := projectMarker(description)
+	if marker == "" {
+		return
+	}
+	projectName := findProjectName(marker)
+	if projectName == "" {
+		fmt.Printf("⚠️  Group %s names unknown project %q in its description\n", chatJID, marker)
+		return
+	}
+	if getProjectNameByJID(chatJID) == projectName {
+		return
+	}
+	if !slices.ContainsFunc(setBy, func(jid types.JID) bool { return adminJIDs[jid.User] }) {
+		fmt.Printf("⚠️  Not binding group %s to %s: its description marker was not set by an admin\n", chatJID, projectName)
+		return
+	}
+	if config, ok := getProjectConfig(projectName); ok && config["group_jid"] != "" {
+		fmt.Printf("⚠️  Not binding group %s to %s: the project is already bound to %s\n", chatJID, projectName, config["group_jid"])
+		return
+	}
+
+	err := bindGroupToProject(messageStore, ProjectBinding{
+		ProjectName: projectName,
+		GroupJID:    chatJID,
+		BoundBy:     "description",
+		BoundAt:     time.Now(),
+	}, false, false)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to bind group %s to %s from its description: %v\n", chatJID, projectName, err)
+	}
+}
+
+// Bind every joined group that carries an admin-set project marker in its description
+func bindMarkedGroups(client *whatsmeow.Client, messageStore *MessageStore, logger waLog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	infos, err := client.GetJoinedGroups(ctx)
+	if err != nil {
+		logger.Warnf("Failed to discover groups: %v", err)
+		return
+	}
+	for _, info := range infos {
+		bindMarkedGroup(messageStore, info.JID.String(), info.Topic, info.TopicSetBy, info.TopicSetByPN)
+	}
+}
+
+// Store a project binding, replacing any earlier binding of the project
+func (store *MessageStore) SaveProjectBinding(binding ProjectBinding) error {
+	_, err := store.db.Exec(`
+		INSERT OR REPLACE INTO project_bindings (project_name, group_jid, group_description, sheets_tab, bound_by, bound_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, binding.ProjectName, binding.GroupJID, binding.GroupDescription, binding.SheetsTab, binding.BoundBy, binding.BoundAt)
+	return err
+}
+
+// Get all stored project bindings, oldest first
+func (store *MessageStore) GetProjectBindings() ([]ProjectBinding, error) {
+	rows, err := store.db.Query(`
+		SELECT project_name, group_jid, group_description, sheets_tab, bound_by, bound_at
+		FROM project_bindings ORDER BY bound_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bindings := []ProjectBinding{}
+	for rows.Next() {
+		var binding ProjectBinding
+		if err := rows.Scan(&binding.ProjectName, &binding.GroupJID, &binding.GroupDescription,
+			&binding.SheetsTab, &binding.BoundBy, &binding.BoundAt); err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, binding)
+	}
+	return bindings, rows.Err()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"maps"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Restore the project configuration and admin list a test changes
+func restoreProjects(t *testing.T) {
+	projects, tabs, admins := maps.Clone(PROJECTS), maps.Clone(PROJECT_SHEETS_TABS), adminJIDs
+	groups, runtimeTabs := maps.Clone(runtimeBoundGroups), maps.Clone(runtimeSheetsTabs)
+	t.Cleanup(func() {
+		PROJECTS, PROJECT_SHEETS_TABS, adminJIDs = projects, tabs, admins
+		runtimeBoundGroups, runtimeSheetsTabs = groups, runtimeTabs
+	})
+}
+
+func TestGroupCannotTakeOverBoundProject(t *testing.T) {
+	messageStore := newTestMessageStore(t)
+	restoreProjects(t)
+	adminJIDs = map[string]bool{"27820000009": true}
+
+	const first, second = "111@g.us", "222@g.us"
+	admin := types.NewJID("27820000009", types.DefaultUserServer)
+	member := types.NewJID("27820000001", types.DefaultUserServer)
+	marker := "Site group\nproject: Test Project"
+
+	if err := bindGroupToProject(messageStore, ProjectBinding{ProjectName: "Test Project", GroupJID: first, BoundBy: "api"}, true, false); err != nil {
+		t.Fatalf("first binding: %v", err)
+	}
+
+	// A description marker cannot move a project that already has a group, even an admin's
+	bindMarkedGroup(messageStore, second, marker, member)
+	bindMarkedGroup(messageStore, second, marker, admin)
+	if got := getProjectNameByJID(second); got != "" || !isRuntimeBoundGroup(first) || isRuntimeBoundGroup(second) {
+		t.Fatalf("marker moved the project: second group project %q, first tracked %v, second tracked %v",
+			got, isRuntimeBoundGroup(first), isRuntimeBoundGroup(second))
+	}
+
+	// Neither can the API without rebind
+	binding := ProjectBinding{ProjectName: "Test Project", GroupJID: second, BoundBy: "api"}
+	if err := bindGroupToProject(messageStore, binding, false, false); err == nil {
+		t.Fatalf("binding a bound project to another group without rebind succeeded")
+	}
+	if err := bindGroupToProject(messageStore, binding, false, true); err != nil {
+		t.Fatalf("rebind: %v", err)
+	}
+	if !isRuntimeBoundGroup(second) || isRuntimeBoundGroup(first) {
+		t.Errorf("after rebind: first tracked %v, second tracked %v", isRuntimeBoundGroup(first), isRuntimeBoundGroup(second))
+	}
+}
+
+func TestMarkerBindsUnboundProjectForAdminsOnly(t *testing.T) {
+	messageStore := newTestMessageStore(t)
+	restoreProjects(t)
+	adminJIDs = map[string]bool{"27820000009": true}
+	PROJECTS["Unbound"] = map[string]string{"project_name": "Unbound"}
+
+	const group = "333@g.us"
+	marker := "project: unbound"
+	bindMarkedGroup(messageStore, group, marker, types.NewJID("27820000001", types.DefaultUserServer))
+	if isRuntimeBoundGroup(group) {
+		t.Fatalf("a non-admin's marker bound the group")
+	}
+	bindMarkedGroup(messageStore, group, marker, types.NewJID("99999", types.HiddenUserServer), types.NewJID("27820000009", types.DefaultUserServer))
+	if !isRuntimeBoundGroup(group) || getProjectNameByJID(group) != "Unbound" {
+		t.Fatalf("an admin's marker did not bind the group")
+	}
+}
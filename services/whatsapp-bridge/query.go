@@ -0,0 +1,330 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Paging limits for the chat and message query API
+const (
+	QUERY_DEFAULT_LIMIT = 50
+	QUERY_MAX_LIMIT     = 500
+)
+
+// ChatSummary is a stored chat as returned by the query API
+type ChatSummary struct {
+	JID             string    `json:"jid"`
+	Name            string    `json:"name"`
+	ProjectName     string    `json:"project_name,omitempty"`
+	LastMessageTime time.Time `json:"last_message_time"`
+	MessageCount    int       `json:"message_count"`
+}
+
+// StoredMessage is a stored message as returned by the query API
+type StoredMessage struct {
+	ID          string     `json:"id"`
+	ChatJID     string     `json:"chat_jid"`
+	Sender      string     `json:"sender"`
+	Content     string     `json:"content"`
+	Timestamp   time.Time  `json:"timestamp"`
+	IsFromMe    bool       `json:"is_from_me"`
+	MediaType   string     `json:"media_type,omitempty"`
+	Filename    string     `json:"filename,omitempty"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"`
+	Revoked     bool       `json:"revoked"`
+	DropNumbers []string   `json:"drop_numbers"`
+}
+
+// MessageQuery filters and pages stored messages (newest first)
+type MessageQuery struct {
+	ChatJIDs  []string // empty for all chats
+	Sender    string
+	Since     time.Time
+	Until     time.Time
+	MediaType string // "none" for text-only messages
+	HasDrop   bool
+	Cursor    string
+	Limit     int
+}
+
+// Returned for a cursor that wasn't produced by the query API
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Encode a page cursor from the sort key of the last row returned
+func encodeCursor(timestamp time.Time, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(timestamp.Format(time.RFC3339Nano) + "|" + key))
+}
+
+// Decode a page cursor into the sort key it continues after
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+	value, key, found := strings.Cut(string(raw), "|")
+	if !found {
+		return time.Time{}, "", errInvalidCursor
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+	return timestamp, key, nil
+}
+
+// Parse an API time filter given as RFC 3339 or YYYY-MM-DD
+func parseQueryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// Parse the paging parameters shared by the query endpoints
+func parseQueryLimit(value string) (int, error) {
+	if value == "" {
+		return QUERY_DEFAULT_LIMIT, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > QUERY_MAX_LIMIT {
+		return 0, fmt.Errorf("limit must be between 1 and %d", QUERY_MAX_LIMIT)
+	}
+	return limit, nil
+}
+
+// Build a MessageQuery from request parameters (sender, since, until, media_type, has_drop,
+// project, cursor, limit). chatJID restricts the query to one chat when set.
+func parseMessageQuery(values url.Values, chatJID string) (MessageQuery, error) {
+	query := MessageQuery{
+		Sender:    normalizeContractorID(values.Get("sender")),
+		MediaType: values.Get("media_type"),
+		HasDrop:   values.Get("has_drop") == "true",
+		Cursor:    values.Get("cursor"),
+	}
+	if chatJID != "" {
+		query.ChatJIDs = []string{chatJID}
+	}
+	if project := values.Get("project"); project != "" {
+		projectName := findProjectName(project)
+		if projectName == "" {
+			return query, fmt.Errorf("unknown project %q", project)
+		}
+		groupJID := projectGroupJIDs()[projectName]
+		if chatJID != "" && chatJID != groupJID {
+			return query, fmt.Errorf("chat %s is not the %s group", chatJID, projectName)
+		}
+		query.ChatJIDs = []string{groupJID}
+	}
+
+	var err error
+	if value := values.Get("since"); value != "" {
+		if query.Since, err = parseQueryTime(value); err != nil {
+			return query, fmt.Errorf("invalid since: %v", err)
+		}
+	}
+	if value := values.Get("until"); value != "" {
+		if query.Until, err = parseQueryTime(value); err != nil {
+			return query, fmt.Errorf("invalid until: %v", err)
+		}
+	}
+	if query.Limit, err = parseQueryLimit(values.Get("limit")); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// List chats, most recently active first, optionally only a project's group
+func (store *MessageStore) ListChats(projectName, cursor string, limit int) ([]ChatSummary, string, error) {
+	query := `
+		SELECT c.jid, COALESCE(c.name, ''), c.last_message_time,
+			(SELECT COUNT(*) FROM messages m WHERE m.chat_jid = c.jid)
+		FROM chats c WHERE 1 = 1`
+	var args []interface{}
+	if projectName != "" {
+		query += " AND c.jid = ?"
+		args = append(args, projectGroupJIDs()[projectName])
+	}
+	if cursor != "" {
+		after, jid, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query += " AND (c.last_message_time < ? OR (c.last_message_time = ? AND c.jid < ?))"
+		args = append(args, after, after, jid)
+	}
+	query += " ORDER BY c.last_message_time DESC, c.jid DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	chats := []ChatSummary{}
+	for rows.Next() {
+		var chat ChatSummary
+		if err := rows.Scan(&chat.JID, &chat.Name, &chat.LastMessageTime, &chat.MessageCount); err != nil {
+			return nil, "", err
+		}
+		chat.ProjectName = getProjectNameByJID(chat.JID)
+		chats = append(chats, chat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(chats) > limit {
+		chats = chats[:limit]
+		last := chats[limit-1]
+		nextCursor = encodeCursor(last.LastMessageTime, last.JID)
+	}
+	return chats, nextCursor, nil
+}
+
+// SQL conditions (each prefixed with " AND ") and arguments for a query's filters and cursor,
+// on the messages table aliased as m. Timestamps are stored as local-time text, so time
+// arguments are converted to local time before binding to compare correctly.
+func (q MessageQuery) conditions() (string, []interface{}, error) {
+	var where strings.Builder
+	var args []interface{}
+	if len(q.ChatJIDs) > 0 {
+		where.WriteString(" AND m.chat_jid IN (?" + strings.Repeat(", ?", len(q.ChatJIDs)-1) + ")")
+		for _, jid := range q.ChatJIDs {
+			args = append(args, jid)
+		}
+	}
+	if q.Sender != "" {
+		where.WriteString(" AND m.sender = ?")
+		args = append(args, q.Sender)
+	}
+	if !q.Since.IsZero() {
+		where.WriteString(" AND m.timestamp >= ?")
+		args = append(args, q.Since.In(time.Local))
+	}
+	if !q.Until.IsZero() {
+		where.WriteString(" AND m.timestamp < ?")
+		args = append(args, q.Until.In(time.Local))
+	}
+	switch q.MediaType {
+	case "":
+	case "none":
+		where.WriteString(" AND COALESCE(m.media_type, '') = ''")
+	default:
+		where.WriteString(" AND m.media_type = ?")
+		args = append(args, q.MediaType)
+	}
+	if q.HasDrop {
+		where.WriteString(" AND UPPER(m.content) GLOB '*DR[0-9]*'")
+	}
+	if q.Cursor != "" {
+		after, key, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		where.WriteString(" AND (m.timestamp < ? OR (m.timestamp = ? AND m.id || '|' || m.chat_jid < ?))")
+		args = append(args, after.In(time.Local), after.In(time.Local), key)
+	}
+	return where.String(), args, nil
+}
+
+// Columns selected for a StoredMessage from the messages table aliased as m
+const storedMessageColumns = `m.id, m.chat_jid, COALESCE(m.sender, ''), COALESCE(m.content, ''), m.timestamp,
+	COALESCE(m.is_from_me, 0), COALESCE(m.media_type, ''), COALESCE(m.filename, ''), m.edited_at, COALESCE(m.revoked, 0)`
+
+// Newest-first ordering that matches the page cursor
+const storedMessageOrder = " ORDER BY m.timestamp DESC, m.id || '|' || m.chat_jid DESC"
+
+// Scan storedMessageColumns (followed by any extra destinations) into a StoredMessage
+func scanStoredMessage(rows *sql.Rows, extra ...interface{}) (StoredMessage, error) {
+	var msg StoredMessage
+	var editedAt sql.NullTime
+	dest := append([]interface{}{&msg.ID, &msg.ChatJID, &msg.Sender, &msg.Content, &msg.Timestamp, &msg.IsFromMe,
+		&msg.MediaType, &msg.Filename, &editedAt, &msg.Revoked}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return msg, err
+	}
+	if editedAt.Valid {
+		msg.EditedAt = &editedAt.Time
+	}
+	msg.DropNumbers = dropNumbersIn(msg.Content)
+	if msg.DropNumbers == nil {
+		msg.DropNumbers = []string{}
+	}
+	return msg, nil
+}
+
+// Cursor for the page after a full page of messages, or "" when there are no more
+func nextMessageCursor(messages []StoredMessage, limit int) string {
+	if len(messages) <= limit {
+		return ""
+	}
+	last := messages[limit-1]
+	return encodeCursor(last.Timestamp, last.ID+"|"+last.ChatJID)
+}
+
+// Query stored messages, newest first. Returns a cursor for the next page, or "" on the last page.
+func (store *MessageStore) QueryMessages(q MessageQuery) ([]StoredMessage, string, error) {
+	where, args, err := q.conditions()
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err := store.db.Query("SELECT "+storedMessageColumns+" FROM messages m WHERE 1 = 1"+where+storedMessageOrder+" LIMIT ?",
+		append(args, q.Limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	messages := []StoredMessage{}
+	for rows.Next() {
+		msg, err := scanStoredMessage(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := nextMessageCursor(messages, q.Limit)
+	if nextCursor != "" {
+		messages = messages[:q.Limit]
+	}
+	return messages, nextCursor, nil
+}
+
+// Answer a message query request with a page of messages and the next cursor
+func serveMessageQuery(w http.ResponseWriter, r *http.Request, messageStore *MessageStore, chatJID string) {
+	query, err := parseMessageQuery(r.URL.Query(), chatJID)
+	if err != nil {
+		writeAPIError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	messages, nextCursor, err := messageStore.QueryMessages(query)
+	if err == errInvalidCursor {
+		writeAPIError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, fmt.Sprintf("Failed to query messages: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MessagesResponse{
+		Messages:   messages,
+		NextCursor: nextCursor,
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	timestamp := time.Date(2026, 3, 14, 9, 30, 0, 123456789, time.FixedZone("SAST", 2*3600))
+	for _, key := range []string{"3EB0ABC|120363418298130331@g.us", "120363418298130331@g.us", ""} {
+		gotTime, gotKey, err := decodeCursor(encodeCursor(timestamp, key))
+		if err != nil || !gotTime.Equal(timestamp) || gotKey != key {
+			t.Errorf("decodeCursor(encodeCursor(%q)) = %v, %q, %v", key, gotTime, gotKey, err)
+		}
+	}
+
+	for _, cursor := range []string{
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("no separator")),
+		base64.RawURLEncoding.EncodeToString([]byte("yesterday|3EB0ABC")),
+		base64.StdEncoding.EncodeToString([]byte(timestamp.Format(time.RFC3339Nano) + "|3EB0ABC?")),
+	} {
+		if _, _, err := decodeCursor(cursor); err != errInvalidCursor {
+			t.Errorf("decodeCursor(%q) error = %v, want errInvalidCursor", cursor, err)
+		}
+	}
+}
+
+// Walking every page must return each row exactly once, in the same order as one big page,
+// including rows that share a timestamp
+func TestCursorPaging(t *testing.T) {
+	messageStore := newTestMessageStore(t)
+	base := time.Date(2026, 3, 14, 9, 0, 0, 0, time.Local)
+	chats := []struct {
+		jid  string
+		last time.Time
+	}{
+		{"a@g.us", base.Add(3 * time.Minute)},
+		{"b@g.us", base.Add(3 * time.Minute)},
+		{"c@g.us", base.Add(time.Minute)},
+	}
+	for _, chat := range chats {
+		if err := messageStore.StoreChat(chat.jid, chat.jid, chat.last); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages := []struct {
+		id, chat string
+		at       time.Duration
+	}{
+		{"m1", "a@g.us", 0},
+		{"m2", "a@g.us", time.Minute},
+		{"m3", "a@g.us", time.Minute},
+		{"m2", "b@g.us", time.Minute},
+		{"m4", "b@g.us", 2 * time.Minute},
+		{"m5", "a@g.us", 3 * time.Minute},
+		{"m6", "c@g.us", 3 * time.Minute},
+	}
+	for _, m := range messages {
+		if err := messageStore.StoreMessage(m.id, m.chat, "27820000001", "", "DR1234567 "+m.id, base.Add(m.at), false,
+			"", "", "", "", nil, nil, nil, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, filter := range []MessageQuery{{}, {ChatJIDs: []string{"a@g.us", "b@g.us"}}, {HasDrop: true}} {
+		all := filter
+		all.Limit = 100
+		want, cursor, err := messageStore.QueryMessages(all)
+		if err != nil || cursor != "" {
+			t.Fatalf("QueryMessages(%+v) = %v, %q, %v", all, want, cursor, err)
+		}
+		for limit := 1; limit <= 3; limit++ {
+			var got []StoredMessage
+			page := filter
+			page.Limit = limit
+			for pages := 0; ; pages++ {
+				if pages > len(messages) {
+					t.Fatalf("limit %d: paging does not terminate", limit)
+				}
+				rows, next, err := messageStore.QueryMessages(page)
+				if err != nil {
+					t.Fatalf("limit %d: %v", limit, err)
+				}
+				if len(rows) > limit {
+					t.Fatalf("limit %d: page of %d messages", limit, len(rows))
+				}
+				got = append(got, rows...)
+				if next == "" {
+					break
+				}
+				page.Cursor = next
+			}
+			if !slices.EqualFunc(got, want, func(a, b StoredMessage) bool { return a.ID == b.ID && a.ChatJID == b.ChatJID }) {
+				t.Errorf("filter %+v, limit %d: paged %v, want %v", filter, limit, messageKeys(got), messageKeys(want))
+			}
+		}
+	}
+
+	var jids []string
+	cursor := ""
+	for {
+		page, next, err := messageStore.ListChats("", cursor, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chat := range page {
+			jids = append(jids, chat.JID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if !slices.Equal(jids, []string{"b@g.us", "a@g.us", "c@g.us"}) {
+		t.Errorf("ListChats paged %v, want [b@g.us a@g.us c@g.us]", jids)
+	}
+
+	if _, _, err := messageStore.QueryMessages(MessageQuery{Cursor: "garbage!", Limit: 10}); err != errInvalidCursor {
+		t.Errorf("QueryMessages with a bad cursor: error %v, want errInvalidCursor", err)
+	}
+}
+
+func messageKeys(messages []StoredMessage) []string {
+	keys := make([]string, len(messages))
+	for i, m := range messages {
+		keys[i] = m.ChatJID + "/" + m.ID
+	}
+	return keys
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// QA reaction configuration (overridable through the environment). Reviewers are
+// phone numbers or JIDs; actions map a reaction emoji to the drop state it sets.
+var (
+	QA_REVIEWER_JIDS    = getEnv("QA_REVIEWER_JIDS", "")
+	QA_REACTION_ACTIONS = getEnv("QA_REACTION_ACTIONS", "✅=approved,❌=incomplete")
+)
+
+// Drop states set by QA
+const (
+	DROP_STATE_APPROVED   = "approved"
+	DROP_STATE_INCOMPLETE = "incomplete"
+	DROP_STATE_REOPENED   = "reopened"
+)
+
+// Sheets status (Column T) shown for each drop state
+var dropStateSheetStatus = map[string]string{
+	DROP_STATE_APPROVED:   "Approved",
+	DROP_STATE_INCOMPLETE: "Incomplete",
+	DROP_STATE_REOPENED:   "Processing",
+}
+
+// AuditEntry records who changed a drop and how
+type AuditEntry struct {
+	DropNumber  string    `json:"drop_number"`
+	ProjectName string    `json:"project_name,omitempty"`
+	Action      string    `json:"action"`
+	Actor       string    `json:"actor"`
+	Source      string    `json:"source"` // e.g. "reaction"
+	Details     string    `json:"details,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Parse a comma-separated list of phone numbers/JIDs into a set of user parts
+func parseJIDList(value string) map[string]bool {
+	users := map[string]bool{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimPrefix(strings.TrimSpace(entry), "+")
+		if user, _, found := strings.Cut(entry, "@"); found {
+			entry = user
+		}
+		if entry != "" {
+			users[entry] = true
+		}
+	}
+	return users
+}
+
+var qaReviewers = parseJIDList(QA_REVIEWER_JIDS)
+
+// Check whether a message sender is on an allowlist, by phone number or LID
+func senderAllowed(allowlist map[string]bool, info types.MessageInfo) bool {
+	return allowlist[info.Sender.User] || (!info.SenderAlt.IsEmpty() && allowlist[info.SenderAlt.User])
+}
+
+// Strip emoji variation selectors and skin tones so "✅" and "✅️" match
+func normalizeEmoji(emoji string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\ufe0f' || (r >= 0x1f3fb && r <= 0x1f3ff) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(emoji))
+}
+
+// Map of reaction emoji to drop state
+func qaReactionActions() map[string]string {
+	actions := map[string]string{}
+	for _, pair := range strings.Split(QA_REACTION_ACTIONS, ",") {
+		emoji, state, found := strings.Cut(pair, "=")
+		if found {
+			actions[normalizeEmoji(emoji)] = strings.TrimSpace(state)
+		}
+	}
+	return actions
+}
+
+// Apply a QA reviewer's reaction on a drop message to the drop's state
+func handleReaction(client *whatsmeow.Client, messageStore *MessageStore, msg *events.Message, reaction *waProto.ReactionMessage, logger waLog.Logger) {
+	if !senderAllowed(qaReviewers, msg.Info) {
+		return
+	}
+
+	chatJID := msg.Info.Chat.String()
+	projectName := getProjectNameByJID(chatJID)
+	if projectName == "" {
+		return
+	}
+	if messageStore.IsProjectPaused(projectName) {
+		fmt.Printf("⏸️  Project %s is paused, ignoring reaction on message %s\n", projectName, reaction.GetKey().GetID())
+		return
+	}
+
+	emoji := normalizeEmoji(reaction.GetText())
+	state, ok := qaReactionActions()[emoji]
+	if emoji != "" && !ok {
+		return
+	}
+
+	targetID := reaction.GetKey().GetID()
+	target, err := messageStore.GetMessage(targetID, chatJID)
+	if err != nil {
+		logger.Warnf("Reaction on unknown message %s in %s", targetID, chatJID)
+		return
+	}
+	dropNumbers := dropNumbersIn(target.Content)
+	if len(dropNumbers) == 0 {
+		if dropNumber := messageStore.ResolveDropForMedia(chatJID, target.Sender, target.Content, target.Time); dropNumber != "" {
+			dropNumbers = []string{dropNumber}
+		}
+	}
+	if len(dropNumbers) == 0 {
+		logger.Warnf("Reaction %q by %s on message %s without a drop number", emoji, msg.Info.Sender.User, targetID)
+		return
+	}
+
+	reviewer := canonicalSender(client, msg.Info.Sender, msg.Info.SenderAlt)
+	for _, dropNumber := range dropNumbers {
+		// Removing a reaction is recorded but leaves the drop as it is
+		if emoji == "" {
+			if err := messageStore.RecordAudit(AuditEntry{
+				DropNumber:  dropNumber,
+				ProjectName: projectName,
+				Action:      "reaction_removed",
+				Actor:       reviewer,
+				Source:      "reaction",
+				Details:     fmt.Sprintf("message %s", targetID),
+				CreatedAt:   msg.Info.Timestamp,
+			}); err != nil {
+				logger.Warnf("Failed to record audit entry for %s: %v", dropNumber, err)
+			}
+			continue
+		}
+		details := fmt.Sprintf("%s reaction on message %s", emoji, targetID)
+		if err := setDropState(messageStore, dropNumber, projectName, state, reviewer, "reaction", details, msg.Info.Timestamp); err != nil {
+			logger.Warnf("Failed to set %s to %s: %v", dropNumber, state, err)
+		}
+	}
+}
+
+// Set a drop's QA state locally, in Sheets (Column T) and in Neon, and record it in the audit trail
+func setDropState(messageStore *MessageStore, dropNumber, projectName, state, actor, source, details string, at time.Time) error {
+	status, ok := dropStateSheetStatus[state]
+	if !ok {
+		return fmt.Errorf("unknown drop state: %s", state)
+	}
+
+	if err := messageStore.SetDropState(dropNumber, projectName, state, actor, at); err != nil {
+		return fmt.Errorf("failed to store drop state: %v", err)
+	}
+	if err := messageStore.RecordAudit(AuditEntry{
+		DropNumber:  dropNumber,
+		ProjectName: projectName,
+		Action:      state,
+		Actor:       actor,
+		Source:      source,
+		Details:     details,
+		CreatedAt:   at,
+	}); err != nil {
+		fmt.Printf("⚠️  Failed to record audit entry for %s: %v\n", dropNumber, err)
+	}
+	fmt.Printf("🧾 %s marked %s by %s (%s)\n", dropNumber, state, actor, source)
+
+	if err := updateSheetsDropCell(dropNumber, projectName, "T", status); err != nil {
+		fmt.Printf("⚠️  Failed to update status for %s: %v\n", dropNumber, err)
+	} else {
+		fmt.Printf("📊 ✅ Updated Google Sheets: %s Column T=%s (Status)\n", dropNumber, status)
+	}
+	if err := setQAReviewIncomplete(dropNumber, state == DROP_STATE_INCOMPLETE,
+		fmt.Sprintf("%s by %s via WhatsApp %s", status, actor, source)); err != nil {
+		fmt.Printf("⚠️  Failed to update Neon QA review for %s: %v\n", dropNumber, err)
+	}
+	return nil
+}
+
+// Store a drop's current QA state
+func (store *MessageStore) SetDropState(dropNumber, projectName, state, actor string, at time.Time) error {
+	_, err := store.db.Exec(`
+		INSERT OR REPLACE INTO drop_states (drop_number, project_name, state, updated_by, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, dropNumber, projectName, state, actor, at)
+	return err
+}
+
+// Get a drop's current QA state ("" when QA hasn't acted on it yet)
+func (store *MessageStore) GetDropState(dropNumber string) (string, string, time.Time, error) {
+	var state, actor string
+	var updatedAt time.Time
+	err := store.db.QueryRow("SELECT state, updated_by, updated_at FROM drop_states WHERE drop_number = ?",
+		dropNumber).Scan(&state, &actor, &updatedAt)
+	if err == sql.ErrNoRows {
+		return "", "", time.Time{}, nil
+	}
+	return state, actor, updatedAt, err
+}
+
+// Append an entry to the audit trail
+func (store *MessageStore) RecordAudit(entry AuditEntry) error {
+	_, err := store.db.Exec(`
+		INSERT INTO audit_log (drop_number, project_name, action, actor, source, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, entry.DropNumber, entry.ProjectName, entry.Action, entry.Actor, entry.Source, entry.Details, entry.CreatedAt)
+	return err
+}
+
+// Get a drop's audit trail, oldest first
+func (store *MessageStore) GetAuditLog(dropNumber string) ([]AuditEntry, error) {
+	rows, err := store.db.Query(`
+		SELECT drop_number, project_name, action, actor, source, details, created_at
+		FROM audit_log WHERE drop_number = ? ORDER BY created_at ASC, id ASC
+	`, dropNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		if err := rows.Scan(&entry.DropNumber, &entry.ProjectName, &entry.Action, &entry.Actor, &entry.Source,
+			&entry.Details, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
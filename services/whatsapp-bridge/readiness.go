@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"golang.org/x/oauth2"
+)
+
+// Readiness settings (overridable through the environment)
+var (
+	READY_CHECK_TIMEOUT_SECS  = getEnvInt("READY_CHECK_TIMEOUT_SECS", 5)
+	READY_OUTBOX_MAX          = getEnvInt("READY_OUTBOX_MAX", 100)
+	READY_CRITICAL_COMPONENTS = getEnv("READY_CRITICAL_COMPONENTS", "whatsapp,messages_db")
+	READY_CACHE_SECS          = getEnvInt("READY_CACHE_SECS", 5)
+)
+
+// Component states reported by /ready
+const (
+	COMPONENT_OK       = "ok"
+	COMPONENT_DEGRADED = "degraded"
+	COMPONENT_DOWN     = "down"
+)
+
+// When the process started, for /health
+var processStartedAt = time.Now()
+
+// ComponentStatus is the state of one dependency as seen by the last readiness check
+type ComponentStatus struct {
+	Status      string     `json:"status"`
+	Critical    bool       `json:"critical"` // the bridge is not ready while this is not ok
+	Detail      string     `json:"detail,omitempty"`
+	Backlog     *int       `json:"backlog,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	CheckedAt   time.Time  `json:"checked_at"`
+}
+
+// ReadinessReport is the /ready response
+type ReadinessReport struct {
+	Status     string                     `json:"status"` // ok, degraded or unavailable
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// When each component last checked out fine, kept across /ready calls
+var (
+	componentSuccessMu sync.Mutex
+	componentSuccess   = map[string]time.Time{}
+)
+
+// Record that a component was working at the given time
+func markComponentSuccess(name string, at time.Time) {
+	componentSuccessMu.Lock()
+	defer componentSuccessMu.Unlock()
+	if at.After(componentSuccess[name]) {
+		componentSuccess[name] = at
+	}
+}
+
+// When a component last checked out fine (nil if it never has)
+func componentLastSuccess(name string) *time.Time {
+	componentSuccessMu.Lock()
+	defer componentSuccessMu.Unlock()
+	at, ok := componentSuccess[name]
+	if !ok {
+		return nil
+	}
+	return &at
+}
+
+// readinessCheck probes one dependency, returning a status, a detail and optionally a backlog
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) (string, string, *int)
+}
+
+// Shared Neon pool and last Sheets token for readiness checks, obtained on first use
+var (
+	readinessMu          sync.Mutex
+	readinessNeonDB      *sql.DB
+	readinessSheetsToken *oauth2.Token
+)
+
+func checkWhatsAppReady(client *whatsmeow.Client) (string, string, *int) {
+	switch {
+	case client == nil:
+		return COMPONENT_DOWN, "no WhatsApp client", nil
+	case !client.IsConnected():
+		return COMPONENT_DOWN, "disconnected", nil
+	case !client.IsLoggedIn():
+		return COMPONENT_DOWN, "connected but not logged in (scan the QR code)", nil
+	}
+	return COMPONENT_OK, fmt.Sprintf("connected as %s", client.Store.ID.User), nil
+}
+
+func checkMessagesDBReady(ctx context.Context, messageStore *MessageStore) (string, string, *int) {
+	if err := messageStore.ProbeWrite(ctx); err != nil {
+		return COMPONENT_DOWN, fmt.Sprintf("messages.db is not writable: %v", err), nil
+	}
+	return COMPONENT_OK, "writable", nil
+}
+
+func checkNeonReady(ctx context.Context) (string, string, *int) {
+	readinessMu.Lock()
+	if readinessNeonDB == nil {
+		db, err := sql.Open("postgres", NEON_DB_URL)
+		if err != nil {
+			readinessMu.Unlock()
+			return COMPONENT_DOWN, fmt.Sprintf("failed to open Neon connection: %v", err), nil
+		}
+		db.SetMaxOpenConns(1)
+		readinessNeonDB = db
+	}
+	db := readinessNeonDB
+	readinessMu.Unlock()
+
+	if err := db.PingContext(ctx); err != nil {
+		return COMPONENT_DOWN, fmt.Sprintf("Neon unreachable: %v", err), nil
+	}
+	return COMPONENT_OK, "reachable", nil
+}
+
+// The service account credentials are only valid if Google issues a token for them. A token is
+// reused until it expires; fetching a new one is bound to ctx so a slow Google stops with the check
+func checkSheetsReady(ctx context.Context) (string, string, *int) {
+	readinessMu.Lock()
+	token := readinessSheetsToken
+	readinessMu.Unlock()
+
+	if !token.Valid() {
+		creds, err := loadSheetsCredentials(ctx)
+		if err != nil {
+			return COMPONENT_DOWN, err.Error(), nil
+		}
+		token, err = creds.TokenSource.Token()
+		if err != nil {
+			return COMPONENT_DOWN, fmt.Sprintf("credentials rejected: %v", err), nil
+		}
+		readinessMu.Lock()
+		readinessSheetsToken = token
+		readinessMu.Unlock()
+	}
+	return COMPONENT_OK, fmt.Sprintf("token valid until %s", token.Expiry.Format(time.RFC3339)), nil
+}
+
+// Work waiting to leave the bridge: queued archive downloads and unanswered media retry requests
+func checkOutboxReady(ctx context.Context, messageStore *MessageStore) (string, string, *int) {
+	retries, err := messageStore.CountPendingMediaRetries(ctx)
+	if err != nil {
+		return COMPONENT_DOWN, fmt.Sprintf("failed to count media retries: %v", err), nil
+	}
+
+	backlog := retries
+	detail := fmt.Sprintf("archiver disabled, media retries pending %d", retries)
+	if mediaArchiver != nil {
+		queued := len(mediaArchiver.jobs)
+		backlog += queued
+		detail = fmt.Sprintf("archive queue %d/%d, media retries pending %d", queued, cap(mediaArchiver.jobs), retries)
+	}
+	if backlog > READY_OUTBOX_MAX {
+		return COMPONENT_DEGRADED, fmt.Sprintf("%s (over %d)", detail, READY_OUTBOX_MAX), &backlog
+	}
+	return COMPONENT_OK, detail, &backlog
+}
+
+// Check every dependency in parallel, each bounded by READY_CHECK_TIMEOUT_SECS
+func checkReadiness(ctx context.Context, client *whatsmeow.Client, messageStore *MessageStore) ReadinessReport {
+	checks := []readinessCheck{
+		{"whatsapp", func(ctx context.Context) (string, string, *int) { return checkWhatsAppReady(client) }},
+		{"messages_db", func(ctx context.Context) (string, string, *int) { return checkMessagesDBReady(ctx, messageStore) }},
+		{"neon", checkNeonReady},
+		{"sheets", checkSheetsReady},
+		{"outbox", func(ctx context.Context) (string, string, *int) { return checkOutboxReady(ctx, messageStore) }},
+	}
+	critical := map[string]bool{}
+	for _, name := range strings.Split(READY_CRITICAL_COMPONENTS, ",") {
+		critical[strings.TrimSpace(name)] = true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(READY_CHECK_TIMEOUT_SECS)*time.Second)
+	defer cancel()
+
+	type result struct {
+		name   string
+		status ComponentStatus
+	}
+	results := make(chan result, len(checks))
+	for _, check := range checks {
+		go func(check readinessCheck) {
+			done := make(chan ComponentStatus, 1)
+			go func() {
+				status, detail, backlog := check.check(ctx)
+				done <- ComponentStatus{Status: status, Detail: detail, Backlog: backlog}
+			}()
+			select {
+			case component := <-done:
+				results <- result{check.name, component}
+			case <-ctx.Done():
+				results <- result{check.name, ComponentStatus{Status: COMPONENT_DOWN, Detail: "check timed out"}}
+			}
+		}(check)
+	}
+
+	report := ReadinessReport{Status: "ok", Components: map[string]ComponentStatus{}}
+	for range checks {
+		r := <-results
+		r.status.Critical = critical[r.name]
+		r.status.CheckedAt = time.Now()
+		if r.status.Status == COMPONENT_OK {
+			markComponentSuccess(r.name, r.status.CheckedAt)
+		} else if r.status.Critical {
+			report.Status = "unavailable"
+		} else if report.Status == "ok" {
+			report.Status = "degraded"
+		}
+		r.status.LastSuccess = componentLastSuccess(r.name)
+		report.Components[r.name] = r.status
+	}
+	return report
+}
+
+// Last readiness report, reused for READY_CACHE_SECS so that polling the open /ready
+// endpoint does not ping Neon, write messages.db or refresh Google tokens on every call
+var readyCache struct {
+	sync.Mutex
+	report    ReadinessReport
+	checkedAt time.Time
+}
+
+// Readiness report from the cache, checking again once it has expired. Callers arriving
+// while a check runs wait for it and share its result. Returns a copy the caller may modify
+func cachedReadiness(ctx context.Context, client *whatsmeow.Client, messageStore *MessageStore) ReadinessReport {
+	readyCache.Lock()
+	defer readyCache.Unlock()
+	if readyCache.checkedAt.IsZero() || time.Since(readyCache.checkedAt) >= time.Duration(READY_CACHE_SECS)*time.Second {
+		// A caller hanging up must not leave a report of timed-out checks in the cache
+		readyCache.report = checkReadiness(context.WithoutCancel(ctx), client, messageStore)
+		readyCache.checkedAt = time.Now()
+	}
+	report := readyCache.report
+	report.Components = maps.Clone(report.Components)
+	return report
+}
+
+// Whether a /ready caller may see component details (account, raw errors): anyone while API auth
+// is off, otherwise only callers presenting a valid key with the read scope
+func readinessDetailsAllowed(r *http.Request, messageStore *MessageStore) bool {
+	if !API_AUTH_ENABLED {
+		return true
+	}
+	token := requestAPIKey(r)
+	if token == "" {
+		return false
+	}
+	key, err := messageStore.GetAPIKeyByHash(hashAPIKey(token))
+	return err == nil && key.RevokedAt == nil && key.HasScope(API_SCOPE_READ)
+}
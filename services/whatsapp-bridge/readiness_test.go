@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Reports are reused within READY_CACHE_SECS, and trimming a caller's copy leaves the cache intact
+func TestReadinessCache(t *testing.T) {
+	messageStore := newTestMessageStore(t)
+	cacheSecs := READY_CACHE_SECS
+	defer func() { READY_CACHE_SECS = cacheSecs }()
+	readyCache.Lock()
+	readyCache.checkedAt = time.Time{}
+	readyCache.Unlock()
+
+	READY_CACHE_SECS = 60
+	first := cachedReadiness(context.Background(), nil, messageStore)
+	for name, component := range first.Components {
+		component.Detail = "trimmed"
+		first.Components[name] = component
+	}
+	second := cachedReadiness(context.Background(), nil, messageStore)
+	for name, component := range second.Components {
+		if component.Detail == "trimmed" {
+			t.Errorf("%s: a caller's copy changed the cached report", name)
+		}
+		if !component.CheckedAt.Equal(first.Components[name].CheckedAt) {
+			t.Errorf("%s: checked again within READY_CACHE_SECS", name)
+		}
+	}
+
+	READY_CACHE_SECS = 0
+	third := cachedReadiness(context.Background(), nil, messageStore)
+	if third.Components["messages_db"].CheckedAt.Equal(second.Components["messages_db"].CheckedAt) {
+		t.Errorf("expired report was not checked again")
+	}
+}
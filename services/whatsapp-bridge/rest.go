@@ -0,0 +1,1218 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Header carrying the request ID, taken from the caller when valid or generated per request
+const REQUEST_ID_HEADER = "X-Request-ID"
+
+// Caller-supplied request IDs we are willing to echo back
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// APIError is the error every REST API endpoint returns on failure
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+// APIErrorResponse is the JSON envelope around an APIError
+type APIErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// Machine-readable error code for an HTTP status
+func apiErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusMethodNotAllowed:
+		return "method_not_allowed"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusRequestEntityTooLarge:
+		return "payload_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusBadGateway:
+		return "upstream_error"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	}
+	if status >= 500 {
+		return "internal"
+	}
+	return "error"
+}
+
+// Write an error as the JSON envelope; takes the same arguments as http.Error
+func writeAPIError(w http.ResponseWriter, message string, status int) {
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIErrorResponse{Error: APIError{
+		Code:      apiErrorCode(status),
+		Message:   message,
+		RequestID: header.Get(REQUEST_ID_HEADER),
+	}})
+}
+
+// Give every request an ID, echoed in the X-Request-ID response header, error bodies and the access log
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(REQUEST_ID_HEADER)
+		if !requestIDPattern.MatchString(requestID) {
+			var err error
+			if requestID, err = randomHex(8); err != nil {
+				requestID = strconv.FormatInt(time.Now().UnixNano(), 36)
+			}
+		}
+		w.Header().Set(REQUEST_ID_HEADER, requestID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiMux is a ServeMux that remembers its patterns so they can be checked against the spec
+type apiMux struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func newAPIMux() *apiMux {
+	return &apiMux{ServeMux: http.NewServeMux()}
+}
+
+func (mux *apiMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	mux.patterns = append(mux.patterns, pattern)
+	mux.ServeMux.HandleFunc(pattern, handler)
+}
+
+// Response bodies of the REST handlers; apiRoutes documents them by type
+type (
+	PhotoMetadataResponse struct {
+		DropNumber string                `json:"drop_number"`
+		Photos     []PhotoMetadataRecord `json:"photos"`
+	}
+	PhotoQualityResponse struct {
+		DropNumber string         `json:"drop_number"`
+		Failed     int            `json:"failed"`
+		Photos     []PhotoQuality `json:"photos"`
+	}
+	DuplicatePhotosResponse struct {
+		Count      int              `json:"count"`
+		Duplicates []PhotoDuplicate `json:"duplicates"`
+	}
+	DropMediaResponse struct {
+		DropNumber string           `json:"drop_number"`
+		Media      []DropMediaEntry `json:"media"`
+	}
+	DropSerialsResponse struct {
+		DropNumber string       `json:"drop_number"`
+		Serials    []DropSerial `json:"serials"`
+	}
+	DropReadingsResponse struct {
+		DropNumber string         `json:"drop_number"`
+		Readings   []PowerReading `json:"readings"`
+	}
+	DropAttributesResponse struct {
+		DropNumber string          `json:"drop_number"`
+		Attributes []DropAttribute `json:"attributes"`
+	}
+	DropLocationsResponse struct {
+		DropNumber string            `json:"drop_number"`
+		Expected   *ExpectedLocation `json:"expected"` // null when no coordinates were imported
+		Locations  []SiteLocation    `json:"locations"`
+	}
+	MessageHistoryResponse struct {
+		ChatJID   string        `json:"chat_jid"`
+		MessageID string        `json:"message_id"`
+		Edits     []MessageEdit `json:"edits"`
+	}
+	DropAuditResponse struct {
+		DropNumber string       `json:"drop_number"`
+		State      string       `json:"state"`
+		Audit      []AuditEntry `json:"audit"`
+		UpdatedBy  string       `json:"updated_by,omitempty"` // set once the drop has a state
+		UpdatedAt  *time.Time   `json:"updated_at,omitempty"`
+	}
+	AuditLogResponse struct {
+		Audit []AuditEntry `json:"audit"`
+	}
+	ContractorsResponse struct {
+		Contractors []Contractor `json:"contractors"`
+	}
+	ContractorLookupResponse struct {
+		Sender     string      `json:"sender"`
+		Name       string      `json:"name"`
+		Source     string      `json:"source"`
+		Contractor *Contractor `json:"contractor,omitempty"` // only when the sender is in the directory
+	}
+	ContractorDeletedResponse struct {
+		Deleted string `json:"deleted"`
+	}
+	CSVImportResponse struct {
+		Imported int `json:"imported"`
+		Skipped  int `json:"skipped"`
+	}
+	ChatsResponse struct {
+		Chats      []ChatSummary `json:"chats"`
+		NextCursor string        `json:"next_cursor"` // empty on the last page
+	}
+	MessagesResponse struct {
+		Messages   []StoredMessage `json:"messages"`
+		NextCursor string          `json:"next_cursor"`
+	}
+	SearchResponse struct {
+		Query      string         `json:"query"`
+		Results    []SearchResult `json:"results"`
+		NextCursor string         `json:"next_cursor"`
+	}
+	GroupsResponse struct {
+		Groups []JoinedGroup `json:"groups"`
+	}
+	GroupRosterResponse struct {
+		ChatJID string             `json:"chat_jid"`
+		Project string             `json:"project"`
+		Members []GroupParticipant `json:"members"`
+	}
+	SerialLookupResponse struct {
+		Serial string               `json:"serial"`
+		Kind   string               `json:"kind"`
+		Reused bool                 `json:"reused"`
+		Drops  []SerialRegistration `json:"drops"`
+	}
+	AccessLogResponse struct {
+		Access []APIAccess `json:"access"`
+	}
+	HealthResponse struct {
+		Status        string `json:"status"`
+		UptimeSeconds int64  `json:"uptime_seconds"`
+	}
+)
+
+// Start a REST API server to expose the WhatsApp client functionality
+func startRESTServer(client *whatsmeow.Client, messageStore *MessageStore, port int) {
+	handler, _ := newRESTHandler(client, messageStore)
+
+	if !API_AUTH_ENABLED {
+		fmt.Println("⚠️  API_AUTH_ENABLED=false: the REST API accepts unauthenticated requests")
+	}
+
+	// Start the server
+	serverAddr := fmt.Sprintf(":%d", port)
+	fmt.Printf("Starting REST API server on %s...\n", serverAddr)
+
+	// Run server in a goroutine so it doesn't block
+	go func() {
+		if err := http.ListenAndServe(serverAddr, handler); err != nil {
+			fmt.Printf("REST API server error: %v\n", err)
+		}
+	}()
+}
+
+// Build the REST API: every route on its own mux, behind API key auth and request IDs
+func newRESTHandler(client *whatsmeow.Client, messageStore *MessageStore) (http.Handler, *apiMux) {
+	mux := newAPIMux()
+	registerRESTRoutes(mux, client, messageStore)
+	return withRequestID(requireAPIKey(messageStore, mux)), mux
+}
+
+// Register the REST API handlers; every pattern must be documented in apiRoutes
+func registerRESTRoutes(mux *apiMux, client *whatsmeow.Client, messageStore *MessageStore) {
+	// Handler for sending messages
+	mux.HandleFunc("/api/send", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow POST requests
+		if r.Method != http.MethodPost {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Parse the request body
+		var req SendMessageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+
+		// Validate request
+		if req.Recipient == "" {
+			writeAPIError(w, "Recipient is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.Message == "" && req.MediaPath == "" {
+			writeAPIError(w, "Message or media path is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.MediaPath != "" {
+			mediaPath, err := resolveSendMediaPath(req.MediaPath)
+			if err != nil {
+				writeAPIError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.MediaPath = mediaPath
+		}
+
+		fmt.Println("Received request to send message", req.Message, req.MediaPath)
+
+		// Send the message
+		success, message := sendWhatsAppMessage(client, req.Recipient, req.Message, req.MediaPath)
+		fmt.Println("Message sent", success, message)
+		if !success {
+			writeAPIError(w, message, http.StatusInternalServerError)
+			return
+		}
+
+		// Send response
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SendMessageResponse{
+			Success: success,
+			Message: message,
+		})
+	})
+
+	// Handler for downloading media
+	mux.HandleFunc("/api/download", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow POST requests
+		if r.Method != http.MethodPost {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Parse the request body
+		var req DownloadMediaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+
+		// Validate request
+		if req.MessageID == "" || req.ChatJID == "" {
+			writeAPIError(w, "Message ID and Chat JID are required", http.StatusBadRequest)
+			return
+		}
+
+		// Download the media
+		success, mediaType, filename, key, err := downloadMedia(client, messageStore, req.MessageID, req.ChatJID)
+
+		// Hand back a URL the client can fetch instead of a path on the bridge host
+		var mediaURL string
+		if success && err == nil {
+			mediaURL, err = mediaStore.URL(r.Context(), key)
+		}
+
+		// Handle download result
+		if !success || err != nil {
+			errMsg := "Unknown error"
+			if err != nil {
+				errMsg = err.Error()
+			}
+			status := http.StatusInternalServerError
+			if errors.Is(err, errMediaRetryRequested) {
+				w.Header().Set("Retry-After", strconv.Itoa(MEDIA_RETRY_WAIT_SECONDS))
+				status = http.StatusServiceUnavailable
+			}
+			writeAPIError(w, fmt.Sprintf("Failed to download media: %s", errMsg), status)
+			return
+		}
+
+		// Send successful response
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DownloadMediaResponse{
+			Success:  true,
+			Message:  fmt.Sprintf("Successfully downloaded %s media", mediaType),
+			Filename: filename,
+			URL:      mediaURL,
+		})
+	})
+
+	// Handler for streaming the decrypted media of a message, downloading it first if needed
+	mux.HandleFunc("/api/media/", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET and HEAD requests
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Path format: /api/media/{chat}/{message_id}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/media/"), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			writeAPIError(w, "Expected /api/media/{chat}/{message_id}", http.StatusBadRequest)
+			return
+		}
+		chatJID, messageID := parts[0], parts[1]
+
+		// Don't hold the request open while the sender's phone re-uploads expired media;
+		// answer 503 with Retry-After and let the client come back
+		_, filename, key, _, _, err := storeMediaMessage(client, messageStore, messageID, chatJID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				writeAPIError(w, "Message not found", http.StatusNotFound)
+			case errors.Is(err, errNotMediaMessage):
+				writeAPIError(w, "Message has no media", http.StatusNotFound)
+			case errors.Is(err, errMediaRetryRequested):
+				w.Header().Set("Retry-After", strconv.Itoa(MEDIA_RETRY_WAIT_SECONDS))
+				writeAPIError(w, err.Error(), http.StatusServiceUnavailable)
+			default:
+				writeAPIError(w, fmt.Sprintf("Failed to download media: %v", err), http.StatusBadGateway)
+			}
+			return
+		}
+
+		object, info, err := mediaStore.Get(r.Context(), key)
+		if err != nil {
+			writeAPIError(w, "Media not found in store", http.StatusNotFound)
+			return
+		}
+		defer object.Close()
+
+		contentType := info.ContentType
+		if contentType == "" || contentType == "application/octet-stream" {
+			contentType = mediaContentType(filename)
+		}
+
+		// Files are content-addressed, so the SHA256 makes a strong, permanent ETag
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("ETag", fmt.Sprintf("\"%s\"", strings.TrimSuffix(path.Base(key), path.Ext(key))))
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+
+		// ServeContent takes care of Content-Length, Range requests and If-None-Match
+		http.ServeContent(w, r, filename, info.ModTime, object)
+	})
+
+	// Handler for photo metadata (capture time, GPS, camera) and QA flags,
+	// by drop_number or by chat_jid + message_id
+	mux.HandleFunc("/api/photos/metadata", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		dropNumber := strings.ToUpper(strings.TrimSpace(query.Get("drop_number")))
+		chatJID := query.Get("chat_jid")
+		messageID := query.Get("message_id")
+		if !dropPattern.MatchString(dropNumber) && (chatJID == "" || messageID == "") {
+			writeAPIError(w, "drop_number or chat_jid and message_id are required", http.StatusBadRequest)
+			return
+		}
+
+		records, err := messageStore.GetPhotoMetadata(dropNumber, chatJID, messageID)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load photo metadata: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PhotoMetadataResponse{
+			DropNumber: dropNumber,
+			Photos:     records,
+		})
+	})
+
+	// Handler for the photo quality verdicts of a drop
+	mux.HandleFunc("/api/photos/quality", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dropNumber := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("drop_number")))
+		if !dropPattern.MatchString(dropNumber) {
+			writeAPIError(w, "A valid drop_number is required", http.StatusBadRequest)
+			return
+		}
+
+		results, err := messageStore.GetPhotoQuality(dropNumber)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load photo quality: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		failed := 0
+		for _, result := range results {
+			if result.Verdict == "fail" {
+				failed++
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PhotoQualityResponse{
+			DropNumber: dropNumber,
+			Failed:     failed,
+			Photos:     results,
+		})
+	})
+
+	// Handler for the reused-photo fraud report (optional project, drop_number and since=YYYY-MM-DD filters)
+	mux.HandleFunc("/api/reports/duplicate-photos", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		since := time.Time{}
+		if value := query.Get("since"); value != "" {
+			parsed, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				writeAPIError(w, "since must be a date in YYYY-MM-DD format", http.StatusBadRequest)
+				return
+			}
+			since = parsed
+		}
+
+		duplicates, err := messageStore.GetPhotoDuplicates(query.Get("project"),
+			strings.ToUpper(strings.TrimSpace(query.Get("drop_number"))), since)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load duplicate photos: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DuplicatePhotosResponse{
+			Count:      len(duplicates),
+			Duplicates: duplicates,
+		})
+	})
+
+	// Handler for fetching stored media files through the bridge (proxied URLs)
+	mux.HandleFunc("/api/files/", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET and HEAD requests
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/api/files/")
+		if !validMediaKey(key) {
+			writeAPIError(w, "Invalid media key", http.StatusBadRequest)
+			return
+		}
+
+		object, info, err := mediaStore.Get(r.Context(), key)
+		if err != nil {
+			writeAPIError(w, "Media not found", http.StatusNotFound)
+			return
+		}
+		defer object.Close()
+
+		if info.ContentType != "" {
+			w.Header().Set("Content-Type", info.ContentType)
+		}
+		http.ServeContent(w, r, path.Base(key), info.ModTime, object)
+	})
+
+	// Handler for listing the archived media index of a drop
+	mux.HandleFunc("/api/drops/media", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dropNumber := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("drop_number")))
+		if !dropPattern.MatchString(dropNumber) {
+			writeAPIError(w, "A valid drop_number is required", http.StatusBadRequest)
+			return
+		}
+
+		entries, err := messageStore.GetDropMedia(dropNumber)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load drop media: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DropMediaResponse{
+			DropNumber: dropNumber,
+			Media:      entries,
+		})
+	})
+
+	// Handler for the serial numbers decoded from a drop's label photos
+	mux.HandleFunc("/api/drops/serials", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dropNumber := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("drop_number")))
+		if !dropPattern.MatchString(dropNumber) {
+			writeAPIError(w, "A valid drop_number is required", http.StatusBadRequest)
+			return
+		}
+
+		serials, err := messageStore.GetDropSerials(dropNumber)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load drop serials: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DropSerialsResponse{
+			DropNumber: dropNumber,
+			Serials:    serials,
+		})
+	})
+
+	// Handler for the power meter readings typed for a drop
+	mux.HandleFunc("/api/drops/readings", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dropNumber := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("drop_number")))
+		if !dropPattern.MatchString(dropNumber) {
+			writeAPIError(w, "A valid drop_number is required", http.StatusBadRequest)
+			return
+		}
+
+		readings, err := messageStore.GetPowerReadings(dropNumber)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load power readings: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DropReadingsResponse{
+			DropNumber: dropNumber,
+			Readings:   readings,
+		})
+	})
+
+	// Handler for the structured fields parsed from a drop's submission block
+	mux.HandleFunc("/api/drops/attributes", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dropNumber := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("drop_number")))
+		if !dropPattern.MatchString(dropNumber) {
+			writeAPIError(w, "A valid drop_number is required", http.StatusBadRequest)
+			return
+		}
+
+		attributes, err := messageStore.GetDropAttributes(dropNumber)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load drop attributes: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DropAttributesResponse{
+			DropNumber: dropNumber,
+			Attributes: attributes,
+		})
+	})
+
+	// Handler for the locations shared for a drop, with its expected coordinates
+	mux.HandleFunc("/api/drops/locations", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dropNumber := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("drop_number")))
+		if !dropPattern.MatchString(dropNumber) {
+			writeAPIError(w, "A valid drop_number is required", http.StatusBadRequest)
+			return
+		}
+
+		locations, err := messageStore.GetSiteLocations(dropNumber)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load drop locations: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		var expected *ExpectedLocation
+		if loc, err := messageStore.GetExpectedLocation(dropNumber); err == nil {
+			expected = &loc
+		} else if err != sql.ErrNoRows {
+			writeAPIError(w, fmt.Sprintf("Failed to load expected location: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DropLocationsResponse{
+			DropNumber: dropNumber,
+			Expected:   expected,
+			Locations:  locations,
+		})
+	})
+
+	// Handler for importing expected drop coordinates (CSV body: drop_number,latitude,longitude[,address])
+	mux.HandleFunc("/api/drops/expected-locations", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow POST requests
+		if r.Method != http.MethodPost {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		imported, skipped, err := messageStore.ImportExpectedLocations(http.MaxBytesReader(w, r.Body, 10<<20))
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to import locations: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(CSVImportResponse{
+			Imported: imported,
+			Skipped:  skipped,
+		})
+	})
+
+	// Handler for a message's edit and deletion history
+	mux.HandleFunc("/api/messages/history", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		chatJID := r.URL.Query().Get("chat_jid")
+		messageID := r.URL.Query().Get("message_id")
+		if chatJID == "" || messageID == "" {
+			writeAPIError(w, "chat_jid and message_id are required", http.StatusBadRequest)
+			return
+		}
+
+		edits, err := messageStore.GetMessageEdits(messageID, chatJID)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load message history: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MessageHistoryResponse{
+			ChatJID:   chatJID,
+			MessageID: messageID,
+			Edits:     edits,
+		})
+	})
+
+	// Handler for a drop's QA state and audit trail
+	mux.HandleFunc("/api/drops/audit", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dropNumber := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("drop_number")))
+		if !dropPattern.MatchString(dropNumber) {
+			writeAPIError(w, "A valid drop_number is required", http.StatusBadRequest)
+			return
+		}
+
+		state, updatedBy, updatedAt, err := messageStore.GetDropState(dropNumber)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load drop state: %v", err), http.StatusInternalServerError)
+			return
+		}
+		entries, err := messageStore.GetAuditLog(dropNumber)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load audit trail: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := DropAuditResponse{
+			DropNumber: dropNumber,
+			State:      state,
+			Audit:      entries,
+		}
+		if state != "" {
+			response.UpdatedBy = updatedBy
+			response.UpdatedAt = &updatedAt
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+
+	// Handler for the most recent audit entries (optional source filter, e.g. admin_dm)
+	mux.HandleFunc("/api/audit", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit := 100
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 1000 {
+				writeAPIError(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		entries, err := messageStore.GetRecentAudit(r.URL.Query().Get("source"), limit)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load audit trail: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AuditLogResponse{
+			Audit: entries,
+		})
+	})
+
+	// Handler for the contractor directory: GET lists (or resolves ?sender=), POST adds or
+	// updates one contractor, DELETE ?id= removes one
+	mux.HandleFunc("/api/contractors", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			if sender := r.URL.Query().Get("sender"); sender != "" {
+				name, source := resolveContractorName(client, messageStore, sender)
+				response := ContractorLookupResponse{
+					Sender: sender,
+					Name:   name,
+					Source: source,
+				}
+				if contractor, err := messageStore.GetContractor(sender); err == nil {
+					response.Contractor = &contractor
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+
+			contractors, err := messageStore.GetContractors(r.URL.Query().Get("project"))
+			if err != nil {
+				writeAPIError(w, fmt.Sprintf("Failed to load contractors: %v", err), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ContractorsResponse{
+				Contractors: contractors,
+			})
+
+		case http.MethodPost:
+			var contractor Contractor
+			if err := json.NewDecoder(r.Body).Decode(&contractor); err != nil {
+				writeAPIError(w, "Invalid request format", http.StatusBadRequest)
+				return
+			}
+			contractor.ID = normalizeContractorID(contractor.ID)
+			contractor.Name = strings.TrimSpace(contractor.Name)
+			if contractor.ID == "" || contractor.Name == "" {
+				writeAPIError(w, "id and name are required", http.StatusBadRequest)
+				return
+			}
+			contractor.UpdatedAt = time.Now()
+			if err := messageStore.SaveContractor(contractor); err != nil {
+				writeAPIError(w, fmt.Sprintf("Failed to save contractor: %v", err), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(contractor)
+
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				writeAPIError(w, "id is required", http.StatusBadRequest)
+				return
+			}
+			deleted, err := messageStore.DeleteContractor(id)
+			if err != nil {
+				writeAPIError(w, fmt.Sprintf("Failed to delete contractor: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if !deleted {
+				writeAPIError(w, "Contractor not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ContractorDeletedResponse{
+				Deleted: normalizeContractorID(id),
+			})
+
+		default:
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Handler for listing stored chats (filters: project; paging: cursor, limit)
+	mux.HandleFunc("/api/chats", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		projectName := ""
+		if project := r.URL.Query().Get("project"); project != "" {
+			if projectName = findProjectName(project); projectName == "" {
+				writeAPIError(w, "Unknown project", http.StatusNotFound)
+				return
+			}
+		}
+		limit, err := parseQueryLimit(r.URL.Query().Get("limit"))
+		if err != nil {
+			writeAPIError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		chats, nextCursor, err := messageStore.ListChats(projectName, r.URL.Query().Get("cursor"), limit)
+		if err == errInvalidCursor {
+			writeAPIError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to list chats: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatsResponse{
+			Chats:      chats,
+			NextCursor: nextCursor,
+		})
+	})
+
+	// Handler for a chat's messages: /api/chats/{jid}/messages (filters: sender, since, until,
+	// media_type, has_drop; paging: cursor, limit)
+	mux.HandleFunc("/api/chats/", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		chatJID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/chats/"), "/messages")
+		if !ok || chatJID == "" || strings.Contains(chatJID, "/") {
+			writeAPIError(w, "Not found", http.StatusNotFound)
+			return
+		}
+		serveMessageQuery(w, r, messageStore, chatJID)
+	})
+
+	// Handler for messages across all chats, with the same filters plus project
+	mux.HandleFunc("/api/messages", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		serveMessageQuery(w, r, messageStore, "")
+	})
+
+	// Handler for full-text search over stored messages: /api/search?q= (filters: project,
+	// sender, since, until; paging: cursor, limit)
+	mux.HandleFunc("/api/search", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		text := strings.TrimSpace(r.URL.Query().Get("q"))
+		if text == "" {
+			writeAPIError(w, "q is required", http.StatusBadRequest)
+			return
+		}
+		query, err := parseMessageQuery(r.URL.Query(), "")
+		if err != nil {
+			writeAPIError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		results, nextCursor, err := messageStore.SearchMessages(text, query)
+		if err == errInvalidCursor {
+			writeAPIError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Search failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SearchResponse{
+			Query:      text,
+			Results:    results,
+			NextCursor: nextCursor,
+		})
+	})
+
+	// Handler for listing every joined group with its project binding
+	mux.HandleFunc("/api/groups", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		groups, err := listJoinedGroups(client)
+		if err != nil {
+			writeAPIError(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(GroupsResponse{
+			Groups: groups,
+		})
+	})
+
+	// Handler for binding a group to a project, or creating a new project from a group
+	mux.HandleFunc("/api/groups/bind", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow POST requests
+		if r.Method != http.MethodPost {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req GroupBindRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		jid, err := types.ParseJID(strings.TrimSpace(req.GroupJID))
+		if err != nil || jid.Server != types.GroupServer {
+			writeAPIError(w, "group_jid must be a group JID", http.StatusBadRequest)
+			return
+		}
+		projectName := findProjectName(req.Project)
+		if projectName == "" {
+			projectName = strings.TrimSpace(req.Project)
+		}
+		if projectName == "" {
+			writeAPIError(w, "project is required", http.StatusBadRequest)
+			return
+		}
+		if findProjectName(projectName) == "" && !req.Create {
+			writeAPIError(w, "Unknown project (set create to add it)", http.StatusNotFound)
+			return
+		}
+
+		binding := ProjectBinding{
+			ProjectName:      projectName,
+			GroupJID:         jid.String(),
+			GroupDescription: req.Description,
+			SheetsTab:        req.SheetsTab,
+			BoundBy:          "api",
+			BoundAt:          time.Now(),
+		}
+		if err := bindGroupToProject(messageStore, binding, req.Create, req.Rebind); err != nil {
+			writeAPIError(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(binding)
+	})
+
+	// Handler for a tracked group's members with join dates and contractor records
+	mux.HandleFunc("/api/groups/roster", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		chatJID := r.URL.Query().Get("chat_jid")
+		if project := r.URL.Query().Get("project"); project != "" {
+			projectName := findProjectName(project)
+			if projectName == "" {
+				writeAPIError(w, "Unknown project", http.StatusNotFound)
+				return
+			}
+			chatJID = projectGroupJIDs()[projectName]
+		}
+		if chatJID == "" {
+			writeAPIError(w, "project or chat_jid is required", http.StatusBadRequest)
+			return
+		}
+
+		includeLeft := r.URL.Query().Get("include_left") == "true"
+		roster, err := messageStore.GetGroupRoster(chatJID, includeLeft)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load roster: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(GroupRosterResponse{
+			ChatJID: chatJID,
+			Project: getProjectNameByJID(chatJID),
+			Members: roster,
+		})
+	})
+
+	// Handler for importing the contractor directory from CSV (phone,name[,company,team,project])
+	mux.HandleFunc("/api/contractors/import", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow POST requests
+		if r.Method != http.MethodPost {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		imported, skipped, err := messageStore.ImportContractors(http.MaxBytesReader(w, r.Body, 10<<20))
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to import contractors: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(CSVImportResponse{
+			Imported: imported,
+			Skipped:  skipped,
+		})
+	})
+
+	// Handler for looking up which drops a serial number was installed on
+	mux.HandleFunc("/api/serials", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		serial := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("serial")))
+		if serial == "" {
+			writeAPIError(w, "serial is required", http.StatusBadRequest)
+			return
+		}
+
+		registrations, err := messageStore.LookupSerial(serial)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to look up serial: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(registrations) == 0 {
+			writeAPIError(w, "Serial not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SerialLookupResponse{
+			Serial: serial,
+			Kind:   registrations[0].Kind,
+			Reused: len(registrations) > 1,
+			Drops:  registrations,
+		})
+	})
+
+	// Handler for recent authenticated API calls (admin scope; optional key_id filter)
+	mux.HandleFunc("/api/access-log", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit := 100
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 1000 {
+				writeAPIError(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		entries, err := messageStore.GetAPIAccessLog(r.URL.Query().Get("key_id"), limit)
+		if err != nil {
+			writeAPIError(w, fmt.Sprintf("Failed to load access log: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AccessLogResponse{
+			Access: entries,
+		})
+	})
+
+	// Liveness: the process is up and serving HTTP (no dependencies checked, no API key needed)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET and HEAD requests
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(HealthResponse{
+			Status:        "ok",
+			UptimeSeconds: int64(time.Since(processStartedAt).Seconds()),
+		})
+	})
+
+	// Readiness: per-component dependency state; 503 while a critical component is not ok
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET and HEAD requests
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := cachedReadiness(r.Context(), client, messageStore)
+		if !readinessDetailsAllowed(r, messageStore) {
+			for name, component := range report.Components {
+				component.Detail = ""
+				report.Components[name] = component
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status == "unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+
+	// Handler for the OpenAPI 3 description of this API
+	mux.HandleFunc("/api/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests
+		if r.Method != http.MethodGet {
+			writeAPIError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(buildOpenAPISpec())
+	})
+
+	// Anything else under /api/ gets the error envelope rather than the mux's plain-text 404;
+	// registered on the underlying mux because it is not part of the documented API
+	mux.ServeMux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, "Unknown API endpoint", http.StatusNotFound)
+	})
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Markers around matched terms in search snippets. Snippets are HTML-escaped message text,
+// so these tags are the only markup in them.
+const (
+	SEARCH_HIGHLIGHT_START = "<mark>"
+	SEARCH_HIGHLIGHT_END   = "</mark>"
+)
+
+// Private-use characters that delimit matches until the snippet text around them is escaped
+const (
+	snippetMatchStart = "\uE000"
+	snippetMatchEnd   = "\uE001"
+)
+
+// SearchResult is a stored message matching a search, with a highlighted snippet
+type SearchResult struct {
+	StoredMessage
+	Snippet string `json:"snippet"` // HTML: escaped message text with <mark> around matches
+}
+
+// HTML-escape a snippet whose matches are delimited by snippetMatchStart/End and turn the
+// delimiters into highlight markers
+func escapeSnippet(snippet string) string {
+	return strings.NewReplacer(snippetMatchStart, SEARCH_HIGHLIGHT_START, snippetMatchEnd, SEARCH_HIGHLIGHT_END).
+		Replace(html.EscapeString(snippet))
+}
+
+// Escape LIKE wildcards so a search term only matches itself (used with ESCAPE '\')
+func escapeLikePattern(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
+
+// Create the FTS5 index over message content, kept in sync with the messages table by
+// triggers, and (re)build it from stored messages whenever the triggers were missing.
+// messages_fts_keys maps a message to its index row so re-stored and edited messages
+// replace their old entry.
+func initSearchIndex(db *sql.DB) error {
+	// Without FTS5 the triggers would make every message insert fail
+	if _, err := db.Exec("CREATE VIRTUAL TABLE temp.fts5_probe USING fts5(x); DROP TABLE temp.fts5_probe;"); err != nil {
+		db.Exec(`
+			DROP TRIGGER IF EXISTS messages_fts_insert;
+			DROP TRIGGER IF EXISTS messages_fts_update;
+			DROP TRIGGER IF EXISTS messages_fts_delete;
+		`)
+		return err
+	}
+
+	var synced int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'messages_fts_insert'").Scan(&synced); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+			content, id UNINDEXED, chat_jid UNINDEXED,
+			tokenize = 'unicode61 remove_diacritics 2'
+		);
+
+		CREATE TABLE IF NOT EXISTS messages_fts_keys (
+			id TEXT,
+			chat_jid TEXT,
+			fts_rowid INTEGER,
+			PRIMARY KEY (id, chat_jid)
+		);
+
+		CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+			DELETE FROM messages_fts WHERE rowid = (
+				SELECT fts_rowid FROM messages_fts_keys WHERE id = new.id AND chat_jid = new.chat_jid
+			);
+			INSERT INTO messages_fts (content, id, chat_jid) VALUES (COALESCE(new.content, ''), new.id, new.chat_jid);
+			INSERT OR REPLACE INTO messages_fts_keys (id, chat_jid, fts_rowid) VALUES (new.id, new.chat_jid, last_insert_rowid());
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+			DELETE FROM messages_fts WHERE rowid = (
+				SELECT fts_rowid FROM messages_fts_keys WHERE id = new.id AND chat_jid = new.chat_jid
+			);
+			INSERT INTO messages_fts (content, id, chat_jid) VALUES (COALESCE(new.content, ''), new.id, new.chat_jid);
+			INSERT OR REPLACE INTO messages_fts_keys (id, chat_jid, fts_rowid) VALUES (new.id, new.chat_jid, last_insert_rowid());
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+			DELETE FROM messages_fts WHERE rowid = (
+				SELECT fts_rowid FROM messages_fts_keys WHERE id = old.id AND chat_jid = old.chat_jid
+			);
+			DELETE FROM messages_fts_keys WHERE id = old.id AND chat_jid = old.chat_jid;
+		END;
+	`)
+	if err != nil {
+		return err
+	}
+	if synced > 0 {
+		return nil
+	}
+
+	// The index is new or missed messages stored without it: rebuild it
+	if _, err := db.Exec("DELETE FROM messages_fts; DELETE FROM messages_fts_keys;"); err != nil {
+		return fmt.Errorf("failed to clear search index: %v", err)
+	}
+	result, err := db.Exec(`
+		INSERT INTO messages_fts (content, id, chat_jid)
+		SELECT COALESCE(content, ''), id, chat_jid FROM messages
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to backfill search index: %v", err)
+	}
+	if _, err := db.Exec(`
+		INSERT OR REPLACE INTO messages_fts_keys (id, chat_jid, fts_rowid)
+		SELECT id, chat_jid, rowid FROM messages_fts
+	`); err != nil {
+		return fmt.Errorf("failed to backfill search index keys: %v", err)
+	}
+	indexed, _ := result.RowsAffected()
+	fmt.Printf("🔎 Built search index over %d stored message(s)\n", indexed)
+	return nil
+}
+
+// Split a search query into terms, keeping "quoted phrases" together
+func searchTerms(query string) []string {
+	var terms []string
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			if phrase := strings.TrimSpace(part); phrase != "" {
+				terms = append(terms, phrase)
+			}
+			continue
+		}
+		terms = append(terms, strings.Fields(part)...)
+	}
+	return terms
+}
+
+// Build an FTS5 match expression that requires every term, each as a quoted prefix so
+// partial serials and punctuation in addresses don't need FTS syntax
+func ftsMatchExpression(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Cut a snippet around the first matching term, highlight every term in it and HTML-escape
+// it (used when SQLite was built without FTS5)
+func highlightSnippet(content string, terms []string) string {
+	lower := strings.ToLower(content)
+	start := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, strings.ToLower(term)); i >= 0 && (start < 0 || i < start) {
+			start = i
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	const radius = 60
+	from, to := max(start-radius, 0), min(start+radius*2, len(content))
+	for from > 0 && !utf8.RuneStart(content[from]) {
+		from--
+	}
+	for to < len(content) && !utf8.RuneStart(content[to]) {
+		to++
+	}
+	snippet := strings.NewReplacer(snippetMatchStart, "", snippetMatchEnd, "").Replace(content[from:to])
+
+	// One pass over all terms, longest first, so highlights never nest
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	sort.Slice(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	pattern := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+	snippet = pattern.ReplaceAllString(snippet, snippetMatchStart+"$0"+snippetMatchEnd)
+
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(content) {
+		snippet += "…"
+	}
+	return escapeSnippet(snippet)
+}
+
+// Search stored message content, newest first, with the same filters and paging as QueryMessages
+func (store *MessageStore) SearchMessages(text string, q MessageQuery) ([]SearchResult, string, error) {
+	terms := searchTerms(text)
+	if len(terms) == 0 {
+		return []SearchResult{}, "", nil
+	}
+	where, args, err := q.conditions()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var rows *sql.Rows
+	if store.searchIndex {
+		rows, err = store.db.Query(`
+			SELECT `+storedMessageColumns+`,
+				snippet(messages_fts, 0, '`+snippetMatchStart+`', '`+snippetMatchEnd+`', '…', 16)
+			FROM messages_fts JOIN messages m ON m.id = messages_fts.id AND m.chat_jid = messages_fts.chat_jid
+			WHERE messages_fts MATCH ?`+where+storedMessageOrder+" LIMIT ?",
+			append(append([]interface{}{ftsMatchExpression(terms)}, args...), q.Limit+1)...)
+	} else {
+		for _, term := range terms {
+			where += ` AND m.content LIKE ? ESCAPE '\'`
+			args = append(args, "%"+escapeLikePattern(term)+"%")
+		}
+		rows, err = store.db.Query("SELECT "+storedMessageColumns+", '' FROM messages m WHERE 1 = 1"+where+storedMessageOrder+" LIMIT ?",
+			append(args, q.Limit+1)...)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var messages []StoredMessage
+	results := []SearchResult{}
+	for rows.Next() {
+		var snippet string
+		msg, err := scanStoredMessage(rows, &snippet)
+		if err != nil {
+			return nil, "", err
+		}
+		if store.searchIndex {
+			snippet = escapeSnippet(snippet)
+		} else {
+			snippet = highlightSnippet(msg.Content, terms)
+		}
+		messages = append(messages, msg)
+		results = append(results, SearchResult{StoredMessage: msg, Snippet: snippet})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := nextMessageCursor(messages, q.Limit)
+	if nextCursor != "" {
+		results = results[:q.Limit]
+	}
+	return results, nextCursor, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		content string
+		terms   []string
+		want    string
+	}{
+		{"ONT HWTC1234 installed", []string{"hwtc"}, "ONT <mark>HWTC</mark>1234 installed"},
+		{"<script>alert(1)</script> DR123", []string{"dr123"}, "&lt;script&gt;alert(1)&lt;/script&gt; <mark>DR123</mark>"},
+		{"a <b>mark</b> & co", []string{"mark", "b"}, "a &lt;<mark>b</mark>&gt;<mark>mark</mark>&lt;/<mark>b</mark>&gt; &amp; co"},
+		{"serial ZTEG0001 and ZTEG", []string{"zteg", "zteg0001"}, "serial <mark>ZTEG0001</mark> and <mark>ZTEG</mark>"},
+		{"no match here", []string{"xyz"}, "no match here"},
+	}
+	for _, tt := range tests {
+		if got := highlightSnippet(tt.content, tt.terms); got != tt.want {
+			t.Errorf("highlightSnippet(%q, %q) = %q, want %q", tt.content, tt.terms, got, tt.want)
+		}
+	}
+
+	long := strings.Repeat("x", 200) + " DR555 " + strings.Repeat("y", 200)
+	got := highlightSnippet(long, []string{"dr555"})
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") || !strings.Contains(got, "<mark>DR555</mark>") {
+		t.Errorf("long content snippet = %q", got)
+	}
+}
+
+func TestEscapeSnippet(t *testing.T) {
+	got := escapeSnippet("<img src=x onerror=alert(1)> " + snippetMatchStart + "DR1 & co" + snippetMatchEnd)
+	want := "&lt;img src=x onerror=alert(1)&gt; <mark>DR1 &amp; co</mark>"
+	if got != want {
+		t.Errorf("escapeSnippet = %q, want %q", got, want)
+	}
+}
+
+func TestSearchMessagesTreatsWildcardsLiterally(t *testing.T) {
+	messageStore := newTestMessageStore(t)
+	const chat = "group@g.us"
+	now := time.Now()
+	if err := messageStore.StoreChat(chat, "Velo Test", now); err != nil {
+		t.Fatal(err)
+	}
+	for i, content := range []string{"battery at 50% charge", "battery at 500 charge", "ont_serial HWTC1", "ontXserial HWTC2"} {
+		if err := messageStore.StoreMessage(string(rune('a'+i)), chat, "27820000001", "", content, now.Add(time.Duration(i)*time.Second), false,
+			"", "", "", "", nil, nil, nil, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"50%", []string{"battery at 50% charge"}},
+		{"ont_serial", []string{"ont_serial HWTC1"}},
+		{"battery", []string{"battery at 500 charge", "battery at 50% charge"}},
+	}
+	for _, tt := range tests {
+		results, _, err := messageStore.SearchMessages(tt.query, MessageQuery{Limit: 10})
+		if err != nil {
+			t.Fatalf("SearchMessages(%q): %v", tt.query, err)
+		}
+		var got []string
+		for _, result := range results {
+			got = append(got, result.Content)
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("SearchMessages(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFTSMatchExpression(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"splitter", `"splitter"*`},
+		{"HWTC 1234", `"HWTC"* "1234"*`},
+		{`"12 Main Road" DR123`, `"12 Main Road"* "DR123"*`},
+		{`say "hi`, `"say"* "hi"*`},
+		{`O"Brien`, `"O"* "Brien"*`},
+		{`NEAR(a b) OR c`, `"NEAR(a"* "b)"* "OR"* "c"*`},
+		{"  ", ``},
+	}
+	for _, tt := range tests {
+		if got := ftsMatchExpression(searchTerms(tt.query)); got != tt.want {
+			t.Errorf("ftsMatchExpression(searchTerms(%q)) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+	if got := ftsMatchExpression([]string{`a"b`}); got != `"a""b"*` {
+		t.Errorf(`ftsMatchExpression(a"b) = %s, want "a""b"*`, got)
+	}
+}
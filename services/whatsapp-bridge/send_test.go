@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSendMediaPath(t *testing.T) {
+	base := t.TempDir()
+	uploads := filepath.Join(base, "uploads")
+	if err := os.MkdirAll(filepath.Join(uploads, "photos"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{filepath.Join(uploads, "photos", "pole.jpg"), filepath.Join(base, "secret.db")} {
+		if err := os.WriteFile(name, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(base, "secret.db"), filepath.Join(uploads, "link.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(base, filepath.Join(uploads, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := SEND_MEDIA_DIR
+	defer func() { SEND_MEDIA_DIR = dir }()
+	SEND_MEDIA_DIR = uploads
+	want := filepath.Join(uploads, "photos", "pole.jpg")
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"photos/pole.jpg", true},
+		{want, true},
+		{"photos/../photos/pole.jpg", true},
+		{"../secret.db", false},
+		{filepath.Join(base, "secret.db"), false},
+		{filepath.Join(uploads, "..", "secret.db"), false},
+		{"link.jpg", false},
+		{"escape/secret.db", false},
+		{"photos", false},
+		{"photos/missing.jpg", false},
+		{".", false},
+	}
+	for _, tt := range tests {
+		got, err := resolveSendMediaPath(tt.path)
+		if tt.ok && (err != nil || got != want) {
+			t.Errorf("resolveSendMediaPath(%q) = %q, %v; want %q", tt.path, got, err, want)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("resolveSendMediaPath(%q) = %q, want an error", tt.path, got)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Columns holding a sender identity, rewritten when a sender's canonical ID becomes known
+var senderIdentityColumns = []struct{ table, column string }{
+	{"messages", "sender"},
+	{"drop_media", "sender"},
+	{"photo_duplicates", "sender"},
+	{"photo_duplicates", "match_sender"},
+	{"site_locations", "sender"},
+	{"message_edits", "editor"},
+	{"drop_states", "updated_by"},
+	{"audit_log", "actor"},
+	{"paused_projects", "paused_by"},
+	{"group_participants", "participant"},
+}
+
+// Rows keyed on the sender can't simply be renamed when the canonical ID already has one;
+// these fold the old ID's row (?1) into the canonical row (?2) before the old one is deleted
+var senderIdentityMerges = map[string]string{
+	"group_participants": `
+		UPDATE group_participants AS c SET
+			joined_at = COALESCE(MIN(c.joined_at, o.joined_at), c.joined_at, o.joined_at),
+			left_at = CASE WHEN c.left_at IS NULL OR o.left_at IS NULL THEN NULL ELSE MAX(c.left_at, o.left_at) END,
+			participant_jid = CASE WHEN c.left_at IS NOT NULL AND o.left_at IS NULL THEN o.participant_jid ELSE c.participant_jid END,
+			is_admin = CASE WHEN c.left_at IS NOT NULL AND o.left_at IS NULL THEN o.is_admin ELSE c.is_admin END,
+			is_super_admin = CASE WHEN c.left_at IS NOT NULL AND o.left_at IS NULL THEN o.is_super_admin ELSE c.is_super_admin END
+		FROM group_participants AS o
+		WHERE c.participant = ?2 AND o.participant = ?1 AND o.chat_jid = c.chat_jid`,
+}
+
+// LIDs whose stored rows were already merged into their phone number during this run
+var mergedSenderLIDs sync.Map
+
+// Resolve a sender JID to its canonical ID: the phone number user part when it is known
+// (from the message's alternate address or whatsmeow's LID↔PN mapping store), otherwise
+// the LID user part
+func canonicalSender(client *whatsmeow.Client, jid, alt types.JID) string {
+	if jid.Server != types.HiddenUserServer {
+		return jid.User
+	}
+	if alt.Server == types.DefaultUserServer && alt.User != "" {
+		return alt.User
+	}
+	if client != nil && client.Store != nil && client.Store.LIDs != nil {
+		pn, err := client.Store.LIDs.GetPNForLID(context.Background(), jid.ToNonAD())
+		if err == nil && !pn.IsEmpty() {
+			return pn.User
+		}
+	}
+	return jid.User
+}
+
+// Resolve a message's sender to its canonical ID. The first time a LID sender resolves to
+// a phone number, rows stored earlier under the LID are moved to the phone number.
+func resolveSender(client *whatsmeow.Client, messageStore *MessageStore, info types.MessageInfo) string {
+	sender := canonicalSender(client, info.Sender, info.SenderAlt)
+	if info.Sender.Server == types.HiddenUserServer && sender != info.Sender.User {
+		if _, merged := mergedSenderLIDs.LoadOrStore(info.Sender.User, true); !merged {
+			if updated, err := messageStore.MergeSenderIdentity(info.Sender.User, sender); err != nil {
+				fmt.Printf("⚠️  Failed to merge sender %s into %s: %v\n", info.Sender.User, sender, err)
+				mergedSenderLIDs.Delete(info.Sender.User)
+			} else if updated > 0 {
+				fmt.Printf("🪪 Merged %d row(s) stored under LID %s into %s\n", updated, info.Sender.User, sender)
+			}
+		}
+	}
+	return sender
+}
+
+// Migrate stored sender identities to canonical IDs: full JIDs become user parts and LIDs
+// with a known phone number become that phone number
+func migrateSenderIdentities(client *whatsmeow.Client, messageStore *MessageStore) error {
+	identities, err := messageStore.GetSenderIdentities()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	migrated := 0
+	for _, identity := range identities {
+		jid := types.NewJID(identity, types.HiddenUserServer)
+		if strings.Contains(identity, "@") {
+			parsed, err := types.ParseJID(identity)
+			if err != nil {
+				continue
+			}
+			jid = parsed
+		}
+		canonical := canonicalSender(client, jid, types.EmptyJID)
+		if canonical == "" || canonical == identity {
+			continue
+		}
+		updated, err := messageStore.MergeSenderIdentity(identity, canonical)
+		if err != nil {
+			return fmt.Errorf("failed to migrate sender %s: %v", identity, err)
+		}
+		total += updated
+		migrated++
+	}
+
+	if migrated > 0 {
+		fmt.Printf("🪪 Migrated %d sender ID(s) to canonical IDs (%d row(s) updated)\n", migrated, total)
+	}
+	return nil
+}
+
+// Get every distinct sender identity stored in the database
+func (store *MessageStore) GetSenderIdentities() ([]string, error) {
+	var selects []string
+	for _, c := range senderIdentityColumns {
+		selects = append(selects, fmt.Sprintf("SELECT %s FROM %s WHERE %s IS NOT NULL AND %s != ''", c.column, c.table, c.column, c.column))
+	}
+	selects = append(selects, "SELECT id FROM contractors")
+
+	rows, err := store.db.Query(strings.Join(selects, " UNION "))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []string
+	for rows.Next() {
+		var identity string
+		if err := rows.Scan(&identity); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// Move every row stored under one sender identity to another, leaving nothing under the old
+// one. A directory entry already present under the new identity wins over the old one;
+// clashing roster rows are merged (see senderIdentityMerges).
+func (store *MessageStore) MergeSenderIdentity(from, to string) (int64, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, c := range senderIdentityColumns {
+		result, err := tx.Exec(fmt.Sprintf("UPDATE OR IGNORE %s SET %s = ? WHERE %s = ?", c.table, c.column, c.column), to, from)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		affected, _ := result.RowsAffected()
+		total += affected
+
+		// Whatever is left under the old ID clashed with a row the canonical ID already has
+		if merge, ok := senderIdentityMerges[c.table]; ok {
+			if _, err := tx.Exec(merge, from, to); err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+		}
+		result, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = ?", c.table, c.column), from)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		affected, _ = result.RowsAffected()
+		total += affected
+	}
+
+	result, err := tx.Exec("UPDATE OR IGNORE contractors SET id = ? WHERE id = ?", to, from)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	affected, _ := result.RowsAffected()
+	total += affected
+	if _, err := tx.Exec("DELETE FROM contractors WHERE id = ?", from); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return total, tx.Commit()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// fakeLIDStore maps LIDs to phone numbers for canonicalSender
+type fakeLIDStore map[types.JID]types.JID
+
+func (f fakeLIDStore) PutManyLIDMappings(ctx context.Context, mappings []store.LIDMapping) error {
+	return errors.ErrUnsupported
+}
+
+func (f fakeLIDStore) PutLIDMapping(ctx context.Context, lid, jid types.JID) error {
+	return errors.ErrUnsupported
+}
+
+func (f fakeLIDStore) GetPNForLID(ctx context.Context, lid types.JID) (types.JID, error) {
+	return f[lid], nil
+}
+
+func (f fakeLIDStore) GetLIDForPN(ctx context.Context, pn types.JID) (types.JID, error) {
+	return types.EmptyJID, errors.ErrUnsupported
+}
+
+func (f fakeLIDStore) GetManyLIDsForPNs(ctx context.Context, pns []types.JID) (map[types.JID]types.JID, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func TestCanonicalSender(t *testing.T) {
+	phone := types.NewJID("27821234567", types.DefaultUserServer)
+	lid := types.NewJID("123456789012345", types.HiddenUserServer)
+	unmapped := types.NewJID("999999999999999", types.HiddenUserServer)
+	client := &whatsmeow.Client{Store: &store.Device{LIDs: fakeLIDStore{lid: phone}}}
+
+	tests := []struct {
+		name   string
+		client *whatsmeow.Client
+		jid    types.JID
+		alt    types.JID
+		want   string
+	}{
+		{"phone number sender", nil, phone, types.EmptyJID, "27821234567"},
+		{"phone number with a device", nil, types.JID{User: "27821234567", Device: 12, Server: types.DefaultUserServer}, types.EmptyJID, "27821234567"},
+		{"LID with a phone number alternate", nil, lid, phone, "27821234567"},
+		{"LID with a LID alternate", nil, lid, unmapped, "123456789012345"},
+		{"LID resolved through the mapping store", client, lid, types.EmptyJID, "27821234567"},
+		{"LID with a device resolved through the mapping store", client, types.JID{User: lid.User, Device: 3, Server: types.HiddenUserServer}, types.EmptyJID, "27821234567"},
+		{"unmapped LID", client, unmapped, types.EmptyJID, "999999999999999"},
+		{"LID without a client", nil, lid, types.EmptyJID, "123456789012345"},
+	}
+	for _, tt := range tests {
+		if got := canonicalSender(tt.client, tt.jid, tt.alt); got != tt.want {
+			t.Errorf("%s: canonicalSender = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
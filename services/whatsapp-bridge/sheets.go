@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+// Create a Google Sheets service from the service account credentials
+func newSheetsService(ctx context.Context) (*sheets.Service, error) {
+	config, err := loadSheetsCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	srv, err := sheets.NewService(ctx, option.WithCredentials(config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sheets service: %v", err)
+	}
+	return srv, nil
+}
+
+// Load the service account credentials for the Sheets scope
+func loadSheetsCredentials(ctx context.Context) (*google.Credentials, error) {
+	// Check if credentials file exists
+	if _, err := os.Stat(GOOGLE_CREDENTIALS_PATH); os.IsNotExist(err) {
+		return nil, fmt.Errorf("Google Sheets credentials not found at %s", GOOGLE_CREDENTIALS_PATH)
+	}
+
+	// Read service account credentials
+	creds, err := os.ReadFile(GOOGLE_CREDENTIALS_PATH)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %v", err)
+	}
+
+	config, err := google.CredentialsFromJSON(ctx, creds, sheets.SpreadsheetsScope)
+	if err != nil {
+		// Check for the specific JSON unmarshaling error
+		if strings.Contains(err.Error(), "cannot unmarshal string into Go value") {
+			fmt.Println("⚠️  Initial credential parsing failed. Retrying with un-escaping...")
+			var credsStr string
+			if json.Unmarshal(creds, &credsStr) == nil {
+				// The file content was a JSON string, so we use the un-escaped version
+				config, err = google.CredentialsFromJSON(ctx, []byte(credsStr), sheets.SpreadsheetsScope)
+			}
+		}
+		// If it's still an error after the retry, fail for real
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse credentials: %v", err)
+		}
+	}
+	return config, nil
+}
+
+// Find the 1-based sheet row holding a drop number (Column B)
+func findDropRow(srv *sheets.Service, tabName, dropNumber string, ctx context.Context) (int, error) {
+	result, err := srv.Spreadsheets.Values.Get(
+		GOOGLE_SHEETS_ID, fmt.Sprintf("%s!A:X", tabName)).Context(ctx).Do()
+	if err != nil {
+		return -1, fmt.Errorf("failed to read sheet data: %v", err)
+	}
+
+	for rowIndex, row := range result.Values {
+		if len(row) > 1 && row[1] != nil {
+			if strings.TrimSpace(fmt.Sprintf("%v", row[1])) == dropNumber {
+				return rowIndex + 1, nil // Convert to 1-based
+			}
+		}
+	}
+
+	return -1, fmt.Errorf("drop number %s not found in Google Sheets", dropNumber)
+}
+
+// One lock per "project|drop" serialising appendSheetsQANote
+var qaNoteLocks sync.Map
+
+// Append a line to a drop's QA Notes (Column U), skipping notes already present
+func appendSheetsQANote(dropNumber, projectName, note string) error {
+	tabName, exists := getSheetsTab(projectName)
+	if !exists {
+		return fmt.Errorf("no Google Sheets tab configured for project: %s", projectName)
+	}
+
+	// Archive workers and message hooks append notes concurrently; without this the
+	// read-modify-write below would drop all but the last note for the drop
+	lock, _ := qaNoteLocks.LoadOrStore(projectName+"|"+dropNumber, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	srv, err := newSheetsService(ctx)
+	if err != nil {
+		return err
+	}
+
+	targetRow, err := findDropRow(srv, tabName, dropNumber, ctx)
+	if err != nil {
+		return err
+	}
+
+	notesRange := fmt.Sprintf("%s!U%d", tabName, targetRow)
+	current, err := srv.Spreadsheets.Values.Get(GOOGLE_SHEETS_ID, notesRange).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to read QA notes: %v", err)
+	}
+
+	existing := ""
+	if len(current.Values) > 0 && len(current.Values[0]) > 0 {
+		existing = strings.TrimSpace(fmt.Sprintf("%v", current.Values[0][0]))
+	}
+	if strings.Contains(existing, note) {
+		return nil
+	}
+	if existing != "" {
+		note = existing + "\n" + note
+	}
+
+	vr := &sheets.ValueRange{
+		Values: [][]interface{}{{note}},
+	}
+	_, err = srv.Spreadsheets.Values.Update(GOOGLE_SHEETS_ID, notesRange, vr).
+		ValueInputOption("RAW").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return fmt.Errorf("failed to update QA notes: %v", err)
+	}
+
+	fmt.Printf("📊 ✅ Updated Google Sheets: %s Column U (QA Notes)\n", dropNumber)
+	return nil
+}
+
+// Write a single cell in a drop's sheet row
+func updateSheetsDropCell(dropNumber, projectName, column string, value interface{}) error {
+	tabName, exists := getSheetsTab(projectName)
+	if !exists {
+		return fmt.Errorf("no Google Sheets tab configured for project: %s", projectName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	srv, err := newSheetsService(ctx)
+	if err != nil {
+		return err
+	}
+
+	targetRow, err := findDropRow(srv, tabName, dropNumber, ctx)
+	if err != nil {
+		return err
+	}
+
+	cellRange := fmt.Sprintf("%s!%s%d", tabName, column, targetRow)
+	vr := &sheets.ValueRange{
+		Values: [][]interface{}{{value}},
+	}
+	_, err = srv.Spreadsheets.Values.Update(GOOGLE_SHEETS_ID, cellRange, vr).
+		ValueInputOption("USER_ENTERED").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %v", cellRange, err)
+	}
+	return nil
+}
+
+// Tick a drop's step checkbox (steps 1-14 live in Columns C-P)
+func tickSheetsStep(dropNumber, projectName string, step int) error {
+	if step < 1 || step > 14 {
+		return fmt.Errorf("invalid step number: %d", step)
+	}
+	column := string(rune('C' + step - 1))
+	if err := updateSheetsDropCell(dropNumber, projectName, column, "TRUE"); err != nil {
+		return err
+	}
+
+	fmt.Printf("📊 ✅ Updated Google Sheets: %s Column %s=TRUE (Step %d)\n", dropNumber, column, step)
+	return nil
+}
+
+// Clear a drop's sheet row (Columns A-X and the readings column) so the slot can be reused
+func clearSheetsDropRow(dropNumber, projectName string) error {
+	tabName, exists := getSheetsTab(projectName)
+	if !exists {
+		return fmt.Errorf("no Google Sheets tab configured for project: %s", projectName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	srv, err := newSheetsService(ctx)
+	if err != nil {
+		return err
+	}
+
+	targetRow, err := findDropRow(srv, tabName, dropNumber, ctx)
+	if err != nil {
+		return err
+	}
+
+	ranges := []string{fmt.Sprintf("%s!A%d:X%d", tabName, targetRow, targetRow)}
+	if column := readingsColumn(projectName); column != "" {
+		ranges = append(ranges, fmt.Sprintf("%s!%s%d", tabName, column, targetRow))
+	}
+	_, err = srv.Spreadsheets.Values.BatchClear(GOOGLE_SHEETS_ID, &sheets.BatchClearValuesRequest{Ranges: ranges}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to clear %s: %v", strings.Join(ranges, ", "), err)
+	}
+
+	fmt.Printf("📊 ✅ Cleared Google Sheets row %d for %s\n", targetRow, dropNumber)
+	return nil
+}
+
+// Read a project's sheet rows (Columns A-X) keyed by drop number
+func getSheetsDropRows(projectName string) (map[string][]interface{}, error) {
+	tabName, exists := getSheetsTab(projectName)
+	if !exists {
+		return nil, fmt.Errorf("no Google Sheets tab configured for project: %s", projectName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	srv, err := newSheetsService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := srv.Spreadsheets.Values.Get(
+		GOOGLE_SHEETS_ID, fmt.Sprintf("%s!A:X", tabName)).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sheet data: %v", err)
+	}
+
+	rows := make(map[string][]interface{})
+	for _, row := range result.Values {
+		if len(row) > 1 && row[1] != nil {
+			dropNumber := strings.TrimSpace(fmt.Sprintf("%v", row[1]))
+			if dropPattern.MatchString(dropNumber) {
+				rows[dropNumber] = row
+			}
+		}
+	}
+	return rows, nil
+}
+
+// Find first empty row starting from row 17
+func findFirstEmptyRow(srv *sheets.Service, tabName string, ctx context.Context) (int, error) {
+	// Start checking from row 17
+	startRow := 17
+
+	// Read rows 17-100 to find first empty one
+	readRange := fmt.Sprintf("%s!A%d:A%d", tabName, startRow, startRow + 83) // Check rows 17-100
+	resp, err := srv.Spreadsheets.Values.Get(GOOGLE_SHEETS_ID, readRange).Context(ctx).Do()
+	if err != nil {
+		return startRow, fmt.Errorf("failed to read rows to find empty spot: %v", err)
+	}
+
+	// If no data found, start at row 17
+	if len(resp.Values) == 0 {
+		return startRow, nil
+	}
+
+	// Find first row where Column A is empty
+	for i, row := range resp.Values {
+		if len(row) == 0 || row[0] == nil || row[0] == "" {
+			return startRow + i, nil
+		}
+	}
+
+	// If we reach here, all returned rows have data
+	// The next empty row is startRow + len(resp.Values)
+	nextEmptyRow := startRow + len(resp.Values)
+	
+	// Make sure we don't exceed reasonable bounds
+	if nextEmptyRow > 200 {
+		fmt.Printf("⚠️  Warning: Next empty row is %d, which seems very high. Using row 101 instead.\n", nextEmptyRow)
+		return 101, nil
+	}
+	
+	fmt.Printf("📍 Next empty row determined: %d (after %d filled rows)\n", nextEmptyRow, len(resp.Values))
+	return nextEmptyRow, nil
+}
+
+// Write drop number to Google Sheets
+func writeToGoogleSheets(dropNumber, projectName, userName string, reviewDate time.Time) error {
+	// Check if we have a sheets tab configured for this project
+	tabName, exists := getSheetsTab(projectName)
+	if !exists {
+		return fmt.Errorf("no Google Sheets tab configured for project: %s", projectName)
+	}
+
+	// Create Google Sheets service with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	srv, err := newSheetsService(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Prepare row data (matching the format from the monitoring services)
+	today := reviewDate.Format("2006/01/02")
+
+	// Find first empty row starting from row 17
+	targetRow, err := findFirstEmptyRow(srv, tabName, ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find empty row in %s: %v", tabName, err)
+	}
+
+	// Different row data formats for different tabs
+	var rowData []interface{}
+	var sheetRange string
+
+	// All tabs now use identical 24-column structure (A-X) with 14-step checkboxes
+	switch {
+	case tabName == "Velo Test", tabName == "Mohadin WA_Tool Monitor", tabName == "Lawley WA_Tool Monitor", isRuntimeSheetsTab(tabName):
+		// All tabs: 24 columns (A-X) with identical 14-step checkbox structure
+		rowData = []interface{}{
+			today,        // A: Date
+			dropNumber,   // B: Drop Number
+			"FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", // C-I: Steps 1-7 (checkboxes)
+			"FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", // J-P: Steps 8-14 (checkboxes)
+			0,            // Q: Completed Photos
+			14,           // R: Outstanding Photos
+			userName,     // S: Contractor Name
+			"Processing", // T: Status
+			"",           // U: QA Notes
+			"",           // V: Comments
+			"FALSE",      // W: Resubmitted
+			"",           // X: Additional Notes
+		}
+		sheetRange = fmt.Sprintf("%s!A%d:X%d", tabName, targetRow, targetRow)
+
+	default:
+		return fmt.Errorf("unknown tab format for: %s", tabName)
+	}
+
+	// Write to specific row instead of appending
+	vr := &sheets.ValueRange{
+		Values: [][]interface{}{rowData},
+	}
+	fmt.Printf("📝 Writing to Google Sheets - DR: %s, Tab: %s, Row: %d\n", dropNumber, tabName, targetRow)
+
+	_, err = srv.Spreadsheets.Values.Update(GOOGLE_SHEETS_ID, sheetRange, vr).
+		ValueInputOption("USER_ENTERED").
+		Context(ctx).
+		Do()
+
+	if err != nil {
+		return fmt.Errorf("failed to write to Google Sheets (tab: %s, row: %d): %v", tabName, targetRow, err)
+	}
+
+	// Apply checkbox data validation to the checkbox columns (C-P and W)
+	err = applyCheckboxValidation(srv, tabName, targetRow, ctx)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to apply checkbox validation (data still written): %v\n", err)
+		// Don't return error - data is written, validation is optional
+	}
+
+	// Only print success message if everything worked
+	fmt.Printf("✅ Added %s to '%s' Google Sheets tab with checkboxes\n", dropNumber, tabName)
+	return nil
+}
+
+// Copy checkbox formatting from existing rows to ensure proper checkbox display
+func applyCheckboxValidation(srv *sheets.Service, tabName string, targetRow int, ctx context.Context) error {
+	fmt.Printf("📝 Copying checkbox format to row %d from template row...\n", targetRow)
+	
+	// Copy checkbox data validation from row 17 (which has working checkboxes)
+	// to the new row to ensure proper checkbox display
+	
+	// Source: Row 17 columns C-P (checkbox columns)
+	sourceRange := &sheets.GridRange{
+		SheetId:          1654167750, // Velo Test sheet ID
+		StartRowIndex:    16, // Row 17 (0-based)
+		EndRowIndex:      17, // Row 17 (exclusive end)
+		StartColumnIndex: 2,  // Column C (0-based)
+		EndColumnIndex:   16, // Column P (exclusive end)
+	}
+	
+	// Destination: New row columns C-P
+	destinationRange := &sheets.GridRange{
+		SheetId:          1654167750,
+		StartRowIndex:    int64(targetRow - 1), // Convert to 0-based
+		EndRowIndex:      int64(targetRow),     // Exclusive end
+		StartColumnIndex: 2,                    // Column C
+		EndColumnIndex:   16,                   // Column P
+	}
+	
+	// Source: Row 17 column W (Resubmitted checkbox)
+	sourceRangeW := &sheets.GridRange{
+		SheetId:          1654167750,
+		StartRowIndex:    16, // Row 17
+		EndRowIndex:      17,
+		StartColumnIndex: 22, // Column W (0-based)
+		EndColumnIndex:   23,
+	}
+	
+	// Destination: New row column W
+	destinationRangeW := &sheets.GridRange{
+		SheetId:          1654167750,
+		StartRowIndex:    int64(targetRow - 1), // Convert to 0-based
+		EndRowIndex:      int64(targetRow),
+		StartColumnIndex: 22, // Column W
+		EndColumnIndex:   23,
+	}
+	
+	// Create batch request to copy formatting for both ranges
+	batchRequest := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{
+			{
+				CopyPaste: &sheets.CopyPasteRequest{
+					Source:      sourceRange,
+					Destination: destinationRange,
+					PasteType:   "PASTE_DATA_VALIDATION", // Only copy validation rules
+				},
+			},
+			{
+				CopyPaste: &sheets.CopyPasteRequest{
+					Source:      sourceRangeW,
+					Destination: destinationRangeW,
+					PasteType:   "PASTE_DATA_VALIDATION",
+				},
+			},
+		},
+	}
+	
+	_, err := srv.Spreadsheets.BatchUpdate(GOOGLE_SHEETS_ID, batchRequest).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to copy checkbox formatting: %v", err)
+	}
+	
+	fmt.Printf("✅ Successfully copied checkbox formatting to row %d\n", targetRow)
+	return nil
+}
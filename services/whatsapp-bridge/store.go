@@ -0,0 +1,506 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+)
+
+// Message represents a chat message for our client
+type Message struct {
+	Time      time.Time
+	Sender    string
+	Content   string
+	IsFromMe  bool
+	MediaType string
+	Filename  string
+}
+
+// Database handler for storing message history
+type MessageStore struct {
+	db          *sql.DB
+	searchIndex bool // FTS5 index available (requires building with -tags sqlite_fts5)
+}
+
+// Initialize message store
+func NewMessageStore() (*MessageStore, error) {
+	// Create directory for database if it doesn't exist
+	if err := os.MkdirAll("store", 0755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %v", err)
+	}
+
+	// Open SQLite database for messages
+	db, err := sql.Open("sqlite3", "file:store/messages.db?_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open message database: %v", err)
+	}
+
+	// Create tables if they don't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS chats (
+			jid TEXT PRIMARY KEY,
+			name TEXT,
+			last_message_time TIMESTAMP,
+			project_name TEXT
+		);
+		
+		CREATE TABLE IF NOT EXISTS messages (
+			id TEXT,
+			chat_jid TEXT,
+			sender TEXT,
+			content TEXT,
+			timestamp TIMESTAMP,
+			is_from_me BOOLEAN,
+			media_type TEXT,
+			filename TEXT,
+			url TEXT,
+			media_key BLOB,
+			file_sha256 BLOB,
+			file_enc_sha256 BLOB,
+			file_length INTEGER,
+			PRIMARY KEY (id, chat_jid),
+			FOREIGN KEY (chat_jid) REFERENCES chats(jid)
+		);
+
+		CREATE TABLE IF NOT EXISTS media_archive (
+			file_sha256 TEXT PRIMARY KEY,
+			media_type TEXT,
+			storage_key TEXT,
+			size INTEGER,
+			archived_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS drop_media (
+			drop_number TEXT,
+			message_id TEXT,
+			chat_jid TEXT,
+			project_name TEXT,
+			sender TEXT,
+			file_sha256 TEXT,
+			timestamp TIMESTAMP,
+			PRIMARY KEY (drop_number, message_id, chat_jid)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_drop_media_sha256 ON drop_media(file_sha256);
+		CREATE INDEX IF NOT EXISTS idx_drop_media_project_time ON drop_media(project_name, timestamp);
+
+		CREATE TABLE IF NOT EXISTS photo_metadata (
+			message_id TEXT,
+			chat_jid TEXT,
+			drop_number TEXT,
+			file_sha256 TEXT,
+			has_exif BOOLEAN,
+			capture_time TIMESTAMP,
+			posted_at TIMESTAMP,
+			latitude REAL,
+			longitude REAL,
+			camera_make TEXT,
+			camera_model TEXT,
+			flags TEXT,
+			analyzed_at TIMESTAMP,
+			PRIMARY KEY (message_id, chat_jid)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_photo_metadata_drop ON photo_metadata(drop_number);
+
+		CREATE TABLE IF NOT EXISTS photo_hashes (
+			file_sha256 TEXT PRIMARY KEY,
+			dhash INTEGER,
+			computed_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS photo_duplicates (
+			drop_number TEXT,
+			project_name TEXT,
+			message_id TEXT,
+			chat_jid TEXT,
+			sender TEXT,
+			file_sha256 TEXT,
+			posted_at TIMESTAMP,
+			match_drop_number TEXT,
+			match_project_name TEXT,
+			match_message_id TEXT,
+			match_chat_jid TEXT,
+			match_sender TEXT,
+			match_file_sha256 TEXT,
+			match_posted_at TIMESTAMP,
+			match_type TEXT,
+			distance INTEGER,
+			detected_at TIMESTAMP,
+			PRIMARY KEY (message_id, chat_jid, match_message_id, match_chat_jid)
+		);
+
+		CREATE TABLE IF NOT EXISTS photo_quality (
+			message_id TEXT,
+			chat_jid TEXT,
+			drop_number TEXT,
+			file_sha256 TEXT,
+			width INTEGER,
+			height INTEGER,
+			blur_score REAL,
+			mean_luminance REAL,
+			verdict TEXT,
+			reasons TEXT,
+			analyzed_at TIMESTAMP,
+			PRIMARY KEY (message_id, chat_jid)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_photo_quality_drop ON photo_quality(drop_number);
+
+		CREATE TABLE IF NOT EXISTS drop_serials (
+			message_id TEXT,
+			chat_jid TEXT,
+			drop_number TEXT,
+			project_name TEXT,
+			kind TEXT,
+			serial TEXT,
+			barcode_format TEXT,
+			decoded_at TIMESTAMP,
+			PRIMARY KEY (message_id, chat_jid, serial)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_drop_serials_drop ON drop_serials(drop_number);
+
+		CREATE TABLE IF NOT EXISTS serial_registry (
+			serial TEXT,
+			kind TEXT,
+			drop_number TEXT,
+			project_name TEXT,
+			chat_jid TEXT,
+			message_id TEXT,
+			source TEXT,
+			installed_at TIMESTAMP,
+			registered_at TIMESTAMP,
+			PRIMARY KEY (serial, drop_number)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_serial_registry_drop ON serial_registry(drop_number);
+
+		CREATE TABLE IF NOT EXISTS power_readings (
+			message_id TEXT,
+			chat_jid TEXT,
+			drop_number TEXT,
+			project_name TEXT,
+			position TEXT,
+			dbm REAL,
+			in_range BOOLEAN,
+			read_at TIMESTAMP,
+			PRIMARY KEY (message_id, chat_jid, position)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_power_readings_drop ON power_readings(drop_number);
+
+		CREATE TABLE IF NOT EXISTS drop_attributes (
+			drop_number TEXT,
+			field TEXT,
+			value TEXT,
+			project_name TEXT,
+			message_id TEXT,
+			chat_jid TEXT,
+			updated_at TIMESTAMP,
+			PRIMARY KEY (drop_number, field)
+		);
+
+		CREATE TABLE IF NOT EXISTS site_locations (
+			message_id TEXT,
+			chat_jid TEXT,
+			drop_number TEXT,
+			project_name TEXT,
+			sender TEXT,
+			latitude REAL,
+			longitude REAL,
+			accuracy_meters INTEGER,
+			is_live BOOLEAN,
+			description TEXT,
+			distance_meters REAL,
+			flagged BOOLEAN,
+			timestamp TIMESTAMP,
+			PRIMARY KEY (message_id, chat_jid)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_site_locations_drop ON site_locations(drop_number);
+
+		CREATE TABLE IF NOT EXISTS drop_expected_locations (
+			drop_number TEXT PRIMARY KEY,
+			latitude REAL,
+			longitude REAL,
+			address TEXT,
+			imported_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS message_edits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id TEXT,
+			chat_jid TEXT,
+			type TEXT,
+			previous_content TEXT,
+			new_content TEXT,
+			editor TEXT,
+			edited_at TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_message_edits_message ON message_edits(message_id, chat_jid);
+
+		CREATE TABLE IF NOT EXISTS drop_states (
+			drop_number TEXT PRIMARY KEY,
+			project_name TEXT,
+			state TEXT,
+			updated_by TEXT,
+			updated_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			drop_number TEXT,
+			project_name TEXT,
+			action TEXT,
+			actor TEXT,
+			source TEXT,
+			details TEXT,
+			created_at TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_audit_log_drop ON audit_log(drop_number);
+
+		CREATE TABLE IF NOT EXISTS paused_projects (
+			project_name TEXT PRIMARY KEY,
+			paused_by TEXT,
+			paused_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS contractors (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			company TEXT,
+			team TEXT,
+			project_name TEXT,
+			updated_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS group_participants (
+			chat_jid TEXT,
+			participant TEXT,
+			participant_jid TEXT,
+			is_admin BOOLEAN DEFAULT 0,
+			is_super_admin BOOLEAN DEFAULT 0,
+			joined_at TIMESTAMP,
+			left_at TIMESTAMP,
+			PRIMARY KEY (chat_jid, participant)
+		);
+
+		CREATE TABLE IF NOT EXISTS project_bindings (
+			project_name TEXT PRIMARY KEY,
+			group_jid TEXT,
+			group_description TEXT,
+			sheets_tab TEXT,
+			bound_by TEXT,
+			bound_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id TEXT PRIMARY KEY,
+			name TEXT,
+			key_hash TEXT UNIQUE,
+			scopes TEXT,
+			rate_limit INTEGER DEFAULT 0,
+			created_at TIMESTAMP,
+			revoked_at TIMESTAMP,
+			last_used_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS api_access_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			key_id TEXT,
+			method TEXT,
+			path TEXT,
+			status INTEGER,
+			remote_addr TEXT,
+			duration_ms INTEGER,
+			created_at TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_api_access_log_key ON api_access_log(key_id);
+
+		CREATE TABLE IF NOT EXISTS health_probe (
+			id INTEGER PRIMARY KEY,
+			checked_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS media_retries (
+			message_id TEXT,
+			chat_jid TEXT,
+			status TEXT,
+			error TEXT,
+			requested_at TIMESTAMP,
+			updated_at TIMESTAMP,
+			PRIMARY KEY (message_id, chat_jid)
+		);
+	`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create tables: %v", err)
+	}
+
+	// Columns added after the original schema
+	for _, column := range []struct{ table, name, definition string }{
+		{"messages", "sender_jid", "TEXT"},
+		{"messages", "direct_path", "TEXT"},
+		{"messages", "edited_at", "TIMESTAMP"},
+		{"messages", "revoked", "BOOLEAN DEFAULT 0"},
+		{"api_access_log", "request_id", "TEXT"},
+	} {
+		if err := addColumnIfMissing(db, column.table, column.name, column.definition); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to migrate %s table: %v", column.table, err)
+		}
+	}
+
+	// Full-text search index; without FTS5 support search falls back to LIKE scans
+	searchIndex := true
+	if err := initSearchIndex(db); err != nil {
+		fmt.Printf("⚠️  Full-text search index unavailable, search will scan messages: %v\n", err)
+		searchIndex = false
+	}
+
+	return &MessageStore{db: db, searchIndex: searchIndex}, nil
+}
+
+// Add a column to an existing table if an older database doesn't have it yet
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// Close the database connection
+func (store *MessageStore) Close() error {
+	return store.db.Close()
+}
+
+// Store a chat in the database
+func (store *MessageStore) StoreChat(jid, name string, lastMessageTime time.Time) error {
+	// Determine project name based on JID
+	projectName := getProjectNameByJID(jid)
+
+	fmt.Printf("💾 Storing chat: JID=%s, Name=%s, Project=%s\n", jid, name, projectName)
+
+	// Store all chats, but only set project_name for tracked projects
+	// This ensures foreign key constraints work for all messages
+	result, err := store.db.Exec(
+		"INSERT OR REPLACE INTO chats (jid, name, last_message_time, project_name) VALUES (?, ?, ?, ?)",
+		jid, name, lastMessageTime, projectName,
+	)
+
+	if err != nil {
+		fmt.Printf("❌ FAILED to store chat: %v\n", err)
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	fmt.Printf("✅ Chat stored successfully: %d rows affected\n", rowsAffected)
+	return nil
+}
+
+// Store a message in the database
+func (store *MessageStore) StoreMessage(id, chatJID, sender, senderJID, content string, timestamp time.Time, isFromMe bool,
+	mediaType, filename, url, directPath string, mediaKey, fileSHA256, fileEncSHA256 []byte, fileLength uint64) error {
+	// Only store if there's actual content or media
+	if content == "" && mediaType == "" {
+		return nil
+	}
+
+	_, err := store.db.Exec(
+		`INSERT OR REPLACE INTO messages 
+		(id, chat_jid, sender, sender_jid, content, timestamp, is_from_me, media_type, filename, url, direct_path, media_key, file_sha256, file_enc_sha256, file_length) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, chatJID, sender, senderJID, content, timestamp, isFromMe, mediaType, filename, url, directPath, mediaKey, fileSHA256, fileEncSHA256, fileLength,
+	)
+	return err
+}
+
+// Get messages from a chat
+func (store *MessageStore) GetMessages(chatJID string, limit int) ([]Message, error) {
+	rows, err := store.db.Query(
+		"SELECT sender, content, timestamp, is_from_me, media_type, filename FROM messages WHERE chat_jid = ? ORDER BY timestamp DESC LIMIT ?",
+		chatJID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		var timestamp time.Time
+		err := rows.Scan(&msg.Sender, &msg.Content, &timestamp, &msg.IsFromMe, &msg.MediaType, &msg.Filename)
+		if err != nil {
+			return nil, err
+		}
+		msg.Time = timestamp
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// Get all chats
+func (store *MessageStore) GetChats() (map[string]time.Time, error) {
+	rows, err := store.db.Query("SELECT jid, last_message_time FROM chats ORDER BY last_message_time DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chats := make(map[string]time.Time)
+	for rows.Next() {
+		var jid string
+		var lastMessageTime time.Time
+		err := rows.Scan(&jid, &lastMessageTime)
+		if err != nil {
+			return nil, err
+		}
+		chats[jid] = lastMessageTime
+	}
+
+	return chats, nil
+}
+
+// Extract text content from a message
+func extractTextContent(msg *waProto.Message) string {
+	if msg == nil {
+		return ""
+	}
+
+	// Try to get text content
+	if text := msg.GetConversation(); text != "" {
+		return text
+	} else if extendedText := msg.GetExtendedTextMessage(); extendedText != nil {
+		return extendedText.GetText()
+	}
+
+	// For now, we're ignoring non-text messages
+	return ""
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// Submission template configuration (overridable through the environment). Each
+// project can have a template file in SUBMISSION_TEMPLATES_DIR named after the
+// project (e.g. "velo_test.template") holding one `field: pattern` line per field.
+// Fields ending in "?" are optional; lines starting with # are comments.
+var (
+	SUBMISSION_TEMPLATES_DIR  = getEnv("SUBMISSION_TEMPLATES_DIR", "store/templates")
+	SUBMISSION_MIN_FIELDS     = getEnvInt("SUBMISSION_MIN_FIELDS", 2) // labelled lines needed before a message counts as a submission
+	SUBMISSION_REPLY_ON_ERROR = getEnvBool("SUBMISSION_REPLY_ON_ERROR", true)
+)
+
+var submissionLinePattern = regexp.MustCompile(`^\s*([^:=]{1,40}?)\s*[:=]\s*(.*?)\s*$`)
+
+// SubmissionField is one `field: pattern` line of a submission template
+type SubmissionField struct {
+	Name     string
+	Pattern  *regexp.Regexp
+	Optional bool
+}
+
+// SubmissionTemplate describes the structured block a project's teams post per drop
+type SubmissionTemplate struct {
+	Fields  []SubmissionField
+	modTime time.Time
+}
+
+// DropAttribute is a structured field parsed from a drop's submission block
+type DropAttribute struct {
+	DropNumber  string    `json:"drop_number"`
+	ProjectName string    `json:"project_name,omitempty"`
+	Field       string    `json:"field"`
+	Value       string    `json:"value"`
+	MessageID   string    `json:"message_id"`
+	ChatJID     string    `json:"chat_jid"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+var (
+	submissionTemplatesMu sync.Mutex
+	submissionTemplates   = make(map[string]*SubmissionTemplate)
+)
+
+// Normalise a field label so "ONT Serial", "ont_serial" and "ont-serial" match
+func normalizeFieldName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer("_", " ", "-", " ").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// Path of a project's submission template file
+func submissionTemplatePath(projectName string) string {
+	return filepath.Join(SUBMISSION_TEMPLATES_DIR, strings.ReplaceAll(strings.ToLower(projectName), " ", "_")+".template")
+}
+
+// Parse `field: pattern` lines into a submission template
+func parseSubmissionTemplate(data string) (*SubmissionTemplate, error) {
+	template := &SubmissionTemplate{}
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, pattern, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected `field: pattern`", i+1)
+		}
+		field := SubmissionField{Name: normalizeFieldName(name)}
+		if strings.HasSuffix(field.Name, "?") {
+			field.Optional = true
+			field.Name = strings.TrimSpace(strings.TrimSuffix(field.Name, "?"))
+		}
+		re, err := regexp.Compile(`(?i)^(?:` + strings.TrimSpace(pattern) + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern for %s: %v", i+1, field.Name, err)
+		}
+		field.Pattern = re
+		template.Fields = append(template.Fields, field)
+	}
+	return template, nil
+}
+
+// Get a project's submission template, re-reading the file when it changes.
+// Returns nil when the project has no template.
+func getSubmissionTemplate(projectName string) *SubmissionTemplate {
+	path := submissionTemplatePath(projectName)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	submissionTemplatesMu.Lock()
+	defer submissionTemplatesMu.Unlock()
+
+	if cached, ok := submissionTemplates[projectName]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to read submission template %s: %v\n", path, err)
+		return nil
+	}
+	template, err := parseSubmissionTemplate(string(data))
+	if err != nil {
+		fmt.Printf("⚠️  Invalid submission template %s: %v\n", path, err)
+		return nil
+	}
+	template.modTime = info.ModTime()
+	submissionTemplates[projectName] = template
+	fmt.Printf("📋 Loaded submission template for %s (%d fields)\n", projectName, len(template.Fields))
+	return template
+}
+
+// Match a message's `label: value` lines against a template. ok is false when the
+// message doesn't look like a submission block at all.
+func (t *SubmissionTemplate) Parse(content string) (values map[string]string, missing, malformed []string, ok bool) {
+	fields := make(map[string]SubmissionField, len(t.Fields))
+	for _, field := range t.Fields {
+		fields[field.Name] = field
+	}
+
+	values = map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		match := submissionLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		name := normalizeFieldName(match[1])
+		if _, known := fields[name]; known {
+			values[name] = match[2]
+		}
+	}
+	if len(values) < SUBMISSION_MIN_FIELDS {
+		return nil, nil, nil, false
+	}
+
+	for _, field := range t.Fields {
+		value, present := values[field.Name]
+		switch {
+		case !present || value == "":
+			delete(values, field.Name)
+			if !field.Optional {
+				missing = append(missing, field.Name)
+			}
+		case !field.Pattern.MatchString(value):
+			malformed = append(malformed, fmt.Sprintf("%s (%q)", field.Name, value))
+			delete(values, field.Name)
+		}
+	}
+	return values, missing, malformed, true
+}
+
+// Parse a structured submission block from a tracked-group message, store its
+// fields against the drop and tell the contractor what was missing or malformed
+func processSubmissionBlock(client *whatsmeow.Client, messageStore *MessageStore, messageID, chatJID, sender, content string, timestamp time.Time) {
+	projectName := getProjectNameByJID(chatJID)
+	if projectName == "" {
+		return
+	}
+	template := getSubmissionTemplate(projectName)
+	if template == nil {
+		return
+	}
+
+	values, missing, malformed, ok := template.Parse(content)
+	if !ok {
+		return
+	}
+	dropNumber := messageStore.ResolveDropForMedia(chatJID, sender, content, timestamp)
+	if dropNumber == "" {
+		fmt.Printf("⚠️  Submission block in message %s has no drop number\n", messageID)
+		missing = append([]string{"drop number"}, missing...)
+	}
+
+	if dropNumber != "" && len(values) > 0 {
+		var attributes []DropAttribute
+		for field, value := range values {
+			attributes = append(attributes, DropAttribute{
+				DropNumber:  dropNumber,
+				ProjectName: projectName,
+				Field:       field,
+				Value:       value,
+				MessageID:   messageID,
+				ChatJID:     chatJID,
+				UpdatedAt:   timestamp,
+			})
+		}
+		if err := messageStore.StoreDropAttributes(attributes); err != nil {
+			fmt.Printf("⚠️  Failed to store submission fields for %s: %v\n", dropNumber, err)
+		}
+		if err := storeNeonDropAttributes(attributes); err != nil {
+			fmt.Printf("⚠️  Failed to store submission fields for %s in Neon: %v\n", dropNumber, err)
+		}
+		fmt.Printf("📋 Parsed submission for %s: %d field(s), %d missing, %d malformed\n",
+			dropNumber, len(values), len(missing), len(malformed))
+	}
+
+	if len(missing) == 0 && len(malformed) == 0 || !SUBMISSION_REPLY_ON_ERROR {
+		return
+	}
+
+	var lines []string
+	for _, field := range missing {
+		lines = append(lines, "• missing: "+field)
+	}
+	for _, field := range malformed {
+		lines = append(lines, "• malformed: "+field)
+	}
+	label := dropNumber
+	if label == "" {
+		label = "Submission"
+	}
+	message := fmt.Sprintf("📋 %s: please fix and resend:\n%s", label, strings.Join(lines, "\n"))
+	if success, result := sendWhatsAppMessage(client, chatJID, message, ""); !success {
+		fmt.Printf("⚠️  Failed to send submission feedback for %s: %s\n", label, result)
+	}
+}
+
+// Store parsed submission fields, replacing earlier values of the same field
+func (store *MessageStore) StoreDropAttributes(attributes []DropAttribute) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, a := range attributes {
+		if _, err := tx.Exec(`
+			INSERT OR REPLACE INTO drop_attributes
+			(drop_number, field, value, project_name, message_id, chat_jid, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, a.DropNumber, a.Field, a.Value, a.ProjectName, a.MessageID, a.ChatJID, a.UpdatedAt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Get the structured fields parsed for a drop
+func (store *MessageStore) GetDropAttributes(dropNumber string) ([]DropAttribute, error) {
+	rows, err := store.db.Query(`
+		SELECT drop_number, field, value, project_name, message_id, chat_jid, updated_at
+		FROM drop_attributes WHERE drop_number = ? ORDER BY field ASC
+	`, dropNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attributes := []DropAttribute{}
+	for rows.Next() {
+		var a DropAttribute
+		if err := rows.Scan(&a.DropNumber, &a.Field, &a.Value, &a.ProjectName, &a.MessageID, &a.ChatJID, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, a)
+	}
+	return attributes, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+const testSubmissionTemplate = `
+# Velo Test drop submission
+dr: DR\d+
+address: .+
+ONT Serial: (HWTC|ZTEG)[0-9A-F]{8}
+power: -?\d+([.,]\d+)?\s*dBm
+pon?: \d+/\d+/\d+
+`
+
+func TestParseSubmissionTemplate(t *testing.T) {
+	template, err := parseSubmissionTemplate(testSubmissionTemplate)
+	if err != nil {
+		t.Fatalf("parseSubmissionTemplate: %v", err)
+	}
+	var names []string
+	for _, field := range template.Fields {
+		names = append(names, field.Name)
+		if field.Optional != (field.Name == "pon") {
+			t.Errorf("field %s optional = %v", field.Name, field.Optional)
+		}
+	}
+	if want := []string{"dr", "address", "ont serial", "power", "pon"}; !slices.Equal(names, want) {
+		t.Errorf("fields = %q, want %q", names, want)
+	}
+
+	for _, invalid := range []string{
+		"dr DR\\d+",       // no colon
+		"power: -?\\d+(",  // bad pattern
+		"dr: DR\\d+\nx y", // second line bad
+	} {
+		if _, err := parseSubmissionTemplate(invalid); err == nil {
+			t.Errorf("parseSubmissionTemplate(%q) succeeded, want an error", invalid)
+		}
+	}
+}
+
+func TestSubmissionTemplateParse(t *testing.T) {
+	template, err := parseSubmissionTemplate(testSubmissionTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		content   string
+		values    map[string]string
+		missing   []string
+		malformed []string
+		ok        bool
+	}{
+		{
+			name:    "complete block",
+			content: "DR: DR1234567\nAddress: 12 Main Rd\nont_serial: HWTC1234ABCD\nPower = -19.5 dBm\nPON: 1/2/3",
+			values:  map[string]string{"dr": "DR1234567", "address": "12 Main Rd", "ont serial": "HWTC1234ABCD", "power": "-19.5 dBm", "pon": "1/2/3"},
+			ok:      true,
+		},
+		{
+			name:    "optional field left out",
+			content: "dr: DR1\naddress: 1 Side St\nont-serial: ZTEG0000FFFF\npower: -20dBm",
+			values:  map[string]string{"dr": "DR1", "address": "1 Side St", "ont serial": "ZTEG0000FFFF", "power": "-20dBm"},
+			ok:      true,
+		},
+		{
+			name:    "missing and empty fields",
+			content: "dr: DR1\naddress:\npower: -20dBm",
+			values:  map[string]string{"dr": "DR1", "power": "-20dBm"},
+			missing: []string{"address", "ont serial"},
+			ok:      true,
+		},
+		{
+			name:      "malformed field",
+			content:   "dr: DR1\naddress: 1 Side St\nont serial: ABC\npower: -20dBm",
+			values:    map[string]string{"dr": "DR1", "address": "1 Side St", "power": "-20dBm"},
+			malformed: []string{`ont serial ("ABC")`},
+			ok:        true,
+		},
+		{
+			name:    "too few labelled lines",
+			content: "DR1 installed\nnote: all good\ndr: DR1",
+			ok:      false,
+		},
+		{
+			name:    "plain chat",
+			content: "DR1234567 done, power -19dBm",
+			ok:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, missing, malformed, ok := template.Parse(tt.content)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if !maps.Equal(values, tt.values) {
+				t.Errorf("values = %v, want %v", values, tt.values)
+			}
+			if !slices.Equal(missing, tt.missing) {
+				t.Errorf("missing = %q, want %q", missing, tt.missing)
+			}
+			if !slices.Equal(malformed, tt.malformed) {
+				t.Errorf("malformed = %q, want %q", malformed, tt.malformed)
+			}
+		})
+	}
+}
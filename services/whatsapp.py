@@ -5,10 +5,27 @@ from typing import Optional, List, Tuple
 import os.path
 import requests
 import json
+from urllib.parse import quote
 # import audio  # Audio functionality not needed yet
 
 MESSAGES_DB_PATH = os.path.join(os.path.dirname(os.path.abspath(__file__)), '..', 'whatsapp-bridge', 'store', 'messages.db')
 WHATSAPP_API_BASE_URL = os.getenv("WHATSAPP_API_URL", "http://localhost:8080/api")
+WHATSAPP_API_KEY = os.getenv("WHATSAPP_API_KEY", "")
+
+
+def _api_headers() -> dict:
+    """Authorization header for the bridge REST API (keys come from `whatsapp-bridge apikey create`)."""
+    return {"Authorization": f"Bearer {WHATSAPP_API_KEY}"} if WHATSAPP_API_KEY else {}
+
+
+def _api_error(response: requests.Response) -> str:
+    """Describe a failed bridge API call from its error envelope ({"error": {"code", "message", "request_id"}})."""
+    try:
+        error = response.json()["error"]
+        return f"HTTP {response.status_code} {error['code']}: {error['message']} (request {error['request_id']})"
+    except (ValueError, KeyError, TypeError):
+        return f"HTTP {response.status_code} - {response.text}"
+
 
 @dataclass
 class Message:
@@ -634,14 +651,14 @@ def send_message(recipient: str, message: str) -> Tuple[bool, str]:
             "message": message,
         }
         
-        response = requests.post(url, json=payload)
+        response = requests.post(url, json=payload, headers=_api_headers())
         
         # Check if the request was successful
         if response.status_code == 200:
             result = response.json()
             return result.get("success", False), result.get("message", "Unknown response")
         else:
-            return False, f"Error: HTTP {response.status_code} - {response.text}"
+            return False, f"Error: {_api_error(response)}"
             
     except requests.RequestException as e:
         return False, f"Request error: {str(e)}"
@@ -677,14 +694,14 @@ def send_message_reply(recipient: str, message: str, reply_to_message_id: str) -
             "reply_to": reply_to_message_id  # This makes it a reply
         }
         
-        response = requests.post(url, json=payload)
+        response = requests.post(url, json=payload, headers=_api_headers())
         
         # Check if the request was successful
         if response.status_code == 200:
             result = response.json()
             return result.get("success", False), result.get("message", "Unknown response")
         else:
-            return False, f"Error: HTTP {response.status_code} - {response.text}"
+            return False, f"Error: {_api_error(response)}"
             
     except requests.RequestException as e:
         return False, f"Request error: {str(e)}"
@@ -711,14 +728,14 @@ def send_file(recipient: str, media_path: str) -> Tuple[bool, str]:
             "media_path": media_path
         }
         
-        response = requests.post(url, json=payload)
+        response = requests.post(url, json=payload, headers=_api_headers())
         
         # Check if the request was successful
         if response.status_code == 200:
             result = response.json()
             return result.get("success", False), result.get("message", "Unknown response")
         else:
-            return False, f"Error: HTTP {response.status_code} - {response.text}"
+            return False, f"Error: {_api_error(response)}"
             
     except requests.RequestException as e:
         return False, f"Request error: {str(e)}"
@@ -749,14 +766,14 @@ def send_audio_message(recipient: str, media_path: str) -> Tuple[bool, str]:
             "media_path": media_path
         }
         
-        response = requests.post(url, json=payload)
+        response = requests.post(url, json=payload, headers=_api_headers())
         
         # Check if the request was successful
         if response.status_code == 200:
             result = response.json()
             return result.get("success", False), result.get("message", "Unknown response")
         else:
-            return False, f"Error: HTTP {response.status_code} - {response.text}"
+            return False, f"Error: {_api_error(response)}"
             
     except requests.RequestException as e:
         return False, f"Request error: {str(e)}"
@@ -766,14 +783,14 @@ def send_audio_message(recipient: str, media_path: str) -> Tuple[bool, str]:
         return False, f"Unexpected error: {str(e)}"
 
 def download_media(message_id: str, chat_jid: str) -> Optional[str]:
-    """Download media from a message and return the local file path.
+    """Download media from a message and return a URL to fetch it from.
     
     Args:
         message_id: The ID of the message containing the media
         chat_jid: The JID of the chat containing the message
     
     Returns:
-        The local file path if download was successful, None otherwise
+        A presigned or bridge-proxied URL if download was successful, None otherwise
     """
     try:
         url = f"{WHATSAPP_API_BASE_URL}/download"
@@ -782,19 +799,19 @@ def download_media(message_id: str, chat_jid: str) -> Optional[str]:
             "chat_jid": chat_jid
         }
         
-        response = requests.post(url, json=payload)
+        response = requests.post(url, json=payload, headers=_api_headers())
         
         if response.status_code == 200:
             result = response.json()
             if result.get("success", False):
-                path = result.get("path")
-                print(f"Media downloaded successfully: {path}")
-                return path
+                media_url = result.get("url")
+                print(f"Media downloaded successfully: {media_url}")
+                return media_url
             else:
                 print(f"Download failed: {result.get('message', 'Unknown error')}")
                 return None
         else:
-            print(f"Error: HTTP {response.status_code} - {response.text}")
+            print(f"Error: {_api_error(response)}")
             return None
             
     except requests.RequestException as e:
@@ -806,3 +823,32 @@ def download_media(message_id: str, chat_jid: str) -> Optional[str]:
     except Exception as e:
         print(f"Unexpected error: {str(e)}")
         return None
+
+def fetch_media(message_id: str, chat_jid: str) -> Optional[bytes]:
+    """Fetch the decrypted bytes of a message's media from the bridge.
+    
+    The bridge downloads the media first if it hasn't been cached yet.
+    
+    Args:
+        message_id: The ID of the message containing the media
+        chat_jid: The JID of the chat containing the message
+    
+    Returns:
+        The media bytes if the fetch was successful, None otherwise
+    """
+    try:
+        url = f"{WHATSAPP_API_BASE_URL}/media/{quote(chat_jid, safe='')}/{quote(message_id, safe='')}"
+        response = requests.get(url, headers=_api_headers(), timeout=60)
+        
+        if response.status_code == 200:
+            return response.content
+        else:
+            print(f"Error: {_api_error(response)}")
+            return None
+            
+    except requests.RequestException as e:
+        print(f"Request error: {str(e)}")
+        return None
+    except Exception as e:
+        print(f"Unexpected error: {str(e)}")
+        return None
@@ -38,7 +38,7 @@ start_service() {
 
 echo ""
 echo "📱 Step 1: Starting WhatsApp Bridge..."
-start_service "whatsapp_bridge" "cd services/whatsapp-bridge && go run main.go" "logs/whatsapp_bridge.log"
+start_service "whatsapp_bridge" "cd services/whatsapp-bridge && go run ." "logs/whatsapp_bridge.log"
 
 echo ""
 echo "🔍 Step 2: Starting Drop Monitor..."
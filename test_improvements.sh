@@ -14,28 +14,28 @@ echo "✅ Test 2: Code Improvements Validation"
 echo "Checking for key improvements in the code..."
 
 # Check for Receipt event handler
-if grep -q "case \*events.Receipt:" /home/louisdup/VF/deployments/WA_monitor\ _Velo_Test/services/whatsapp-bridge/main.go; then
+if grep -rq --include=*.go "case \*events.Receipt:" /home/louisdup/VF/deployments/WA_monitor\ _Velo_Test/services/whatsapp-bridge/; then
     echo "  ✅ Receipt event handler added"
 else
     echo "  ❌ Receipt event handler missing"
 fi
 
 # Check for completion message detection
-if grep -q "isCompletionMessage" /home/louisdup/VF/deployments/WA_monitor\ _Velo_Test/services/whatsapp-bridge/main.go; then
+if grep -rq --include=*.go "isCompletionMessage" /home/louisdup/VF/deployments/WA_monitor\ _Velo_Test/services/whatsapp-bridge/; then
     echo "  ✅ Completion message detection added"
 else
     echo "  ❌ Completion message detection missing"
 fi
 
 # Check for resubmission handling in createQAPhotoReview
-if grep -q "updating as resubmission" /home/louisdup/VF/deployments/WA_monitor\ _Velo_Test/services/whatsapp-bridge/main.go; then
+if grep -rq --include=*.go "updating as resubmission" /home/louisdup/VF/deployments/WA_monitor\ _Velo_Test/services/whatsapp-bridge/; then
     echo "  ✅ Resubmission handling in QA review creation added"
 else
     echo "  ❌ Resubmission handling missing"
 fi
 
 # Check for Google Sheets resubmission update function
-if grep -q "updateSheetsForResubmission" /home/louisdup/VF/deployments/WA_monitor\ _Velo_Test/services/whatsapp-bridge/main.go; then
+if grep -rq --include=*.go "updateSheetsForResubmission" /home/louisdup/VF/deployments/WA_monitor\ _Velo_Test/services/whatsapp-bridge/; then
     echo "  ✅ Google Sheets resubmission update function added"
 else
     echo "  ❌ Google Sheets resubmission update function missing"